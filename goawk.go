@@ -40,6 +40,7 @@ import (
 	"github.com/benhoyt/goawk/internal/compiler"
 	"github.com/benhoyt/goawk/internal/cover"
 	"github.com/benhoyt/goawk/internal/parseutil"
+	"github.com/benhoyt/goawk/internal/profile"
 	"github.com/benhoyt/goawk/internal/resolver"
 	"github.com/benhoyt/goawk/interp"
 	"github.com/benhoyt/goawk/lexer"
@@ -47,7 +48,7 @@ import (
 )
 
 const (
-	version    = "v1.23.1"
+	version    = interp.Version
 	copyright  = "GoAWK " + version + " - Copyright (c) 2022 Ben Hoyt"
 	shortUsage = "usage: goawk [-F fs] [-v var=value] [-f progfile | 'prog'] [file ...]"
 	longUsage  = `Standard AWK arguments:
@@ -59,21 +60,31 @@ Additional GoAWK features:
   -E progfile       load program, treat as last option, disable var=value args
   -H                parse header row and enable @"field" in CSV input mode
   -h, --help        show this help message
+  -I[suffix]        edit input files in place, keeping backups with suffix
+                    (for example -I.bak) if given
+  -M                use arbitrary-precision arithmetic (see PREC, ROUNDMODE)
   -i mode           parse input into fields using CSV format (ignore FS and RS)
-                    'csv|tsv [separator=<char>] [comment=<char>] [header]'
+                    'csv|tsv [separator=<char>] [comment=<char>] [header]
+                    [header=<name>,...] [skipheader] [trimspace]'
   -o mode           use CSV output for print with args (ignore OFS and ORS)
-                    'csv|tsv [separator=<char>]'
+                    'csv|tsv [separator=<char>] [header]'
   -version          show GoAWK version and exit
+  -W lint           warn about dubious constructs at runtime
+  -z                decompress gzip, bzip2, and zlib input files
 
 GoAWK debugging arguments:
+  -awkprofile fn    write AWK execution profile (annotated listing) to file
   -coverappend      append to coverage profile instead of overwriting
-  -covermode mode   set coverage mode: set, count (default "set")
+  -covermode mode   set coverage mode: set, count, branch (default "set")
   -coverprofile fn  write coverage profile to file
+  -coverreport fmt  write report for coverage profile (given as the only
+                    argument) to stdout; fmt is html or text
   -cpuprofile fn    write CPU profile to file
   -d                print parsed syntax tree to stdout and exit
   -da               print VM assembly instructions to stdout and exit
   -dt               print variable type information to stdout and exit
   -memprofile fn    write memory profile to file
+  -O0               disable bytecode optimizations (for example, with -da)
 `
 )
 
@@ -96,6 +107,14 @@ func main() {
 	coverMode := cover.ModeUnspecified
 	coverProfile := ""
 	coverAppend := false
+	coverReport := ""
+	lint := false
+	noOptimize := false
+	bignum := false
+	awkProfile := ""
+	decompress := false
+	inPlace := false
+	inPlaceSuffix := ""
 
 	var i int
 argsLoop:
@@ -125,6 +144,18 @@ argsLoop:
 			coverProfile = os.Args[i]
 		case "-coverappend":
 			coverAppend = true
+		case "-coverreport":
+			if i+1 >= len(os.Args) {
+				errorExitf("flag needs an argument: -coverreport")
+			}
+			i++
+			coverReport = coverReportFromString(os.Args[i])
+		case "-awkprofile":
+			if i+1 >= len(os.Args) {
+				errorExitf("flag needs an argument: -awkprofile")
+			}
+			i++
+			awkProfile = os.Args[i]
 		case "-E":
 			if i+1 >= len(os.Args) {
 				errorExitf("flag needs an argument: -E")
@@ -175,12 +206,16 @@ argsLoop:
 			}
 			i++
 			inputMode = os.Args[i]
+		case "-M":
+			bignum = true
 		case "-memprofile":
 			if i+1 >= len(os.Args) {
 				errorExitf("flag needs an argument: -memprofile")
 			}
 			i++
 			memProfile = os.Args[i]
+		case "-O0":
+			noOptimize = true
 		case "-o":
 			if i+1 >= len(os.Args) {
 				errorExitf("flag needs an argument: -o")
@@ -190,6 +225,14 @@ argsLoop:
 		case "-version", "--version":
 			fmt.Println(version)
 			os.Exit(0)
+		case "-W":
+			if i+1 >= len(os.Args) {
+				errorExitf("flag needs an argument: -W")
+			}
+			i++
+			lint = warningOptionFromString(os.Args[i])
+		case "-z":
+			decompress = true
 		default:
 			switch {
 			case strings.HasPrefix(arg, "-E"):
@@ -199,6 +242,9 @@ argsLoop:
 				break argsLoop
 			case strings.HasPrefix(arg, "-F"):
 				fieldSep = arg[2:]
+			case strings.HasPrefix(arg, "-I"):
+				inPlace = true
+				inPlaceSuffix = arg[2:]
 			case strings.HasPrefix(arg, "-f"):
 				progFiles = append(progFiles, arg[2:])
 			case strings.HasPrefix(arg, "-i"):
@@ -207,6 +253,8 @@ argsLoop:
 				outputMode = arg[2:]
 			case strings.HasPrefix(arg, "-v"):
 				vars = append(vars, arg[2:])
+			case strings.HasPrefix(arg, "-W"):
+				lint = warningOptionFromString(arg[2:])
 			case strings.HasPrefix(arg, "-cpuprofile="):
 				cpuProfile = arg[len("-cpuprofile="):]
 			case strings.HasPrefix(arg, "-memprofile="):
@@ -215,6 +263,10 @@ argsLoop:
 				coverMode = coverModeFromString(arg[len("-covermode="):])
 			case strings.HasPrefix(arg, "-coverprofile="):
 				coverProfile = arg[len("-coverprofile="):]
+			case strings.HasPrefix(arg, "-coverreport="):
+				coverReport = coverReportFromString(arg[len("-coverreport="):])
+			case strings.HasPrefix(arg, "-awkprofile="):
+				awkProfile = arg[len("-awkprofile="):]
 			default:
 				errorExitf("flag provided but not defined: %s", arg)
 			}
@@ -227,6 +279,17 @@ argsLoop:
 	// Any remaining args are program and input files
 	args := os.Args[i:]
 
+	if coverReport != "" {
+		if len(args) != 1 {
+			errorExitf("usage: goawk -coverreport html|text profile")
+		}
+		err := cover.WriteReport(os.Stdout, coverReport, args[0])
+		if err != nil {
+			errorExitf("unable to write coverage report: %v", err)
+		}
+		return
+	}
+
 	fileReader := &parseutil.FileReader{}
 	if len(progFiles) > 0 {
 		// Read source: the concatenation of all source files specified
@@ -265,6 +328,10 @@ argsLoop:
 	parserConfig := &parser.ParserConfig{
 		DebugTypes:  debugTypes,
 		DebugWriter: os.Stdout,
+		// Constant folding uses float64 arithmetic, so bignum mode needs
+		// an unoptimized program (the interpreter would otherwise compile
+		// it again).
+		NoOptimize: noOptimize || bignum,
 	}
 	prog, err := parser.ParseProgram(fileReader.Source(), parserConfig)
 	if err != nil {
@@ -290,7 +357,7 @@ argsLoop:
 			DebugWriter: parserConfig.DebugWriter})
 
 		// re-compile it
-		prog.Compiled, err = compiler.Compile(&prog.ResolvedProgram)
+		prog.Compiled, err = compiler.Compile(&prog.ResolvedProgram, !parserConfig.NoOptimize)
 		if err != nil {
 			errorExitf("%s", err)
 		}
@@ -327,10 +394,17 @@ argsLoop:
 	}
 
 	config := &interp.Config{
-		Argv0:     filepath.Base(os.Args[0]),
-		Args:      expandWildcardsOnWindows(args),
-		NoArgVars: noArgVars,
-		Output:    stdout,
+		Argv0:         filepath.Base(os.Args[0]),
+		Args:          expandWildcardsOnWindows(args),
+		NoArgVars:     noArgVars,
+		Output:        stdout,
+		Lint:          lint,
+		SourceLine:    fileReader.FileLine,
+		Profiling:     awkProfile != "",
+		Decompress:    decompress,
+		InPlace:       inPlace,
+		InPlaceSuffix: inPlaceSuffix,
+		Bignum:        bignum,
 		Vars: []string{
 			"FS", fieldSep,
 			"INPUTMODE", inputMode,
@@ -366,16 +440,27 @@ argsLoop:
 	status, err := interpreter.Execute(config)
 
 	if err != nil {
+		if err, ok := err.(*interp.Error); ok && err.Position.Line > 0 {
+			showRuntimeError(fileReader, err)
+			os.Exit(1)
+		}
 		errorExit(err)
 	}
 
 	if coverProfile != "" {
-		err := coverage.WriteProfile(coverProfile, interpreter.Array(cover.ArrayName))
+		err := coverage.WriteProfile(coverProfile, interpreter.Array)
 		if err != nil {
 			errorExitf("unable to write coverage profile: %v", err)
 		}
 	}
 
+	if awkProfile != "" {
+		err := writeAWKProfile(awkProfile, interpreter.Profile(), fileReader)
+		if err != nil {
+			errorExitf("unable to write AWK profile: %v", err)
+		}
+	}
+
 	if cpuProfile != "" {
 		pprof.StopCPUProfile()
 	}
@@ -394,18 +479,47 @@ argsLoop:
 	os.Exit(status)
 }
 
+func writeAWKProfile(path string, prof *interp.Profile, fileReader *parseutil.FileReader) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = profile.WriteListing(f, prof, fileReader)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
 func coverModeFromString(mode string) cover.Mode {
 	switch mode {
 	case "set":
 		return cover.ModeSet
 	case "count":
 		return cover.ModeCount
+	case "branch":
+		return cover.ModeBranch
 	default:
-		errorExitf("-covermode can only be one of: set, count")
+		errorExitf("-covermode can only be one of: set, count, branch")
 		return cover.ModeUnspecified
 	}
 }
 
+func coverReportFromString(format string) string {
+	if format != "html" && format != "text" {
+		errorExitf("-coverreport can only be one of: html, text")
+	}
+	return format
+}
+
+func warningOptionFromString(option string) bool {
+	if option != "lint" {
+		errorExitf("-W option can only be: lint")
+	}
+	return true
+}
+
 // Show source line and position of error, for example:
 //
 //	BEGIN { x*; }
@@ -419,6 +533,29 @@ func showSourceLine(src []byte, pos lexer.Position) {
 	fmt.Fprintln(os.Stderr, strings.Repeat(" ", runeColumn)+strings.Repeat("   ", numTabs)+"^")
 }
 
+// Show runtime error with its source position and the stack of function
+// calls, for example:
+//
+//	prog.awk:2:5: division by zero
+//	    return 1/x
+//	    ^
+//	    in function f called from prog.awk:5:9
+func showRuntimeError(fileReader *parseutil.FileReader, err *interp.Error) {
+	name, line := fileReader.FileLine(err.Position.Line)
+	fmt.Fprintf(os.Stderr, "%s:%d:%d: %s\n", name, line, err.Position.Column, err)
+	showSourceLine(fileReader.Source(), err.Position)
+	const maxFrames = 10
+	for i, frame := range err.Stack {
+		if i == maxFrames {
+			fmt.Fprintf(os.Stderr, "    ... and %d more calls\n", len(err.Stack)-i)
+			break
+		}
+		name, line := fileReader.FileLine(frame.Position.Line)
+		fmt.Fprintf(os.Stderr, "    in function %s called from %s:%d:%d\n",
+			frame.Function, name, line, frame.Position.Column)
+	}
+}
+
 func errorExit(err error) {
 	pathErr, ok := err.(*os.PathError)
 	if ok && os.IsNotExist(err) {
@@ -415,9 +415,9 @@ func TestCommandLine(t *testing.T) {
 		{[]string{"-F"}, "", "", "flag needs an argument: -F"},
 		{[]string{"-f"}, "", "", "flag needs an argument: -f"},
 		{[]string{"-v"}, "", "", "flag needs an argument: -v"},
-		{[]string{"-z"}, "", "", "flag provided but not defined: -z"},
+		{[]string{"-y"}, "", "", "flag provided but not defined: -y"},
 		{[]string{"{ print }", "notexist"}, "", "", `file "notexist" not found`},
-		{[]string{"BEGIN { print 1/0 }"}, "", "", "division by zero"},
+		{[]string{"BEGIN { print 1/0 }"}, "", "", "<cmdline>:1:9: division by zero\nBEGIN { print 1/0 }\n        ^"},
 		{[]string{"-v", "foo", "BEGIN {}"}, "", "", "-v flag must be in format name=value"},
 		{[]string{"--", "{ print $1 }", "-file"}, "", "", `file "-file" not found`},
 		{[]string{"{ print $1 }", "-file"}, "", "", `file "-file" not found`},
@@ -625,6 +625,27 @@ func TestGoAWKSpecificOptions(t *testing.T) {
 		{[]string{"-oxyz", `{}`}, "", "", "invalid output mode \"xyz\"\n"},
 		{[]string{"-H", `{}`}, "", "", "-H only allowed together with -i\n"},
 
+		// Lint options
+		{[]string{"-W", "lint", `BEGIN { print 1 }`}, "", "1\n", ""},
+		{[]string{"-Wfoo", `BEGIN { print 1 }`}, "", "", "-W option can only be: lint\n"},
+
+		// Arbitrary-precision arithmetic
+		{[]string{"-M", `{ print $1 + 1, 2^64 }`}, "12345678901234567890\n", "12345678901234567891 18446744073709551616\n", ""},
+		{[]string{"-M", "-v", "PREC=quad", `BEGIN { printf "%.30f\n", 1/3 }`}, "", "0.333333333333333333333333333333\n", ""},
+
+		// Runtime error formatting
+		{[]string{"BEGIN {\n\tx = 1\n\tx %= 0\n}"}, "", "", "<cmdline>:3:2: division by zero in mod\n    x %= 0\n    ^\n"},
+		{[]string{"-f", "testdata/runtimeerror/lib.awk", "-f", "testdata/runtimeerror/main.awk"}, "", "",
+			"testdata/runtimeerror/lib.awk:2:5: division by zero\n    return a / b\n    ^\n" +
+				"    in function div called from testdata/runtimeerror/main.awk:2:5\n"},
+		{[]string{`function f(n) { if (n > 0) return f(n-1); printf "%d" } BEGIN { f(2) }`}, "", "",
+			"<cmdline>:1:43: format error: got 0 args, expected 1\n" +
+				"function f(n) { if (n > 0) return f(n-1); printf \"%d\" } BEGIN { f(2) }\n" +
+				"                                          ^\n" +
+				"    in function f called from <cmdline>:1:28\n" +
+				"    in function f called from <cmdline>:1:28\n" +
+				"    in function f called from <cmdline>:1:65\n"},
+
 		// Debug options
 		{[]string{"-dt", `
 BEGIN { x=42; a[1]=x; print f(a, 1) }
@@ -635,7 +656,9 @@ globals
   ARGV: array 0
   ENVIRON: array 1
   FIELDS: array 2
-  a: array 3
+  OFIELDS: array 3
+  PROCINFO: array 4
+  a: array 5
   x: scalar 0
 function f(b, y, z)  # index 0
   b: array 0
@@ -653,14 +676,22 @@ $1 {
         // pattern
 0000    FieldInt 1
 
+        // { body }
+0000    Num 2 (0)
+0002    Print 1
+
+`[1:], ""},
+		{[]string{"-da", `$1 == "x" { x = x + 1; print $2 }`}, "", `
+        // pattern
+0000    FieldIntEqualsStr 1 "x" (0)
+
         // { body }
 0000    Num 1 (0)
-0002    Num 1 (0)
-0004    Add
-0005    Print 1
+0002    AugAssignGlobal AugOpAdd x
+0005    PrintField 2
 
 `[1:], ""},
-		{[]string{"-d", "-da", `$1 { print 1+1 }`}, "", `
+		{[]string{"-d", "-da", "-O0", `$1 { print 1+1 }`}, "", `
 $1 {
     print 1 + 1
 }
@@ -673,6 +704,14 @@ $1 {
 0004    Add
 0005    Print 1
 
+`[1:], ""},
+		{[]string{"-M", "-da", `BEGIN { print 1+1 }`}, "", `
+        // BEGIN
+0000    Num 1 (0)
+0002    Num 1 (0)
+0004    Add
+0005    Print 1
+
 `[1:], ""},
 	}
 
@@ -694,6 +733,23 @@ $1 {
 	}
 }
 
+func TestLintWarnings(t *testing.T) {
+	stdout, stderr, err := runGoAWK([]string{"-W", "lint", `BEGIN { y = x; print $1 }`}, "")
+	if err != nil {
+		t.Fatalf("expected no error, got %v (%q)", err, stderr)
+	}
+	if stdout != "\n" {
+		t.Fatalf("expected empty line, got %q", stdout)
+	}
+	expected := `
+<cmdline>:1:9: warning: reference to uninitialized variable x
+<cmdline>:1:16: warning: reference to field $1 past NF
+`[1:]
+	if stderr != expected {
+		t.Fatalf("expected %q, got %q", expected, stderr)
+	}
+}
+
 func TestMultipleCSVFiles(t *testing.T) {
 	// Ensure CSV handling works across multiple files with different headers (field names).
 	src := `
@@ -721,6 +777,53 @@ age,email,name Sarah 25
 	}
 }
 
+func TestBeginFileEndFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("ERRNO message is different on Windows")
+	}
+	src := `
+BEGINFILE {
+    if (ERRNO != "") {
+        print "skipping " FILENAME ": " ERRNO
+        nextfile
+    }
+    print "start " FILENAME
+}
+{ print FNR ": " $0 }
+FNR == 2 { nextfile }
+ENDFILE { print "end " FILENAME " after " FNR }
+END { print NR " records" }
+`
+	stdout, stderr, err := runGoAWK([]string{src, "testdata/g.5", "testdata/nonexistent", "testdata/g.6"}, "")
+	if err != nil {
+		t.Fatalf("expected no error, got %v (%q)", err, stderr)
+	}
+	expected := `
+start testdata/g.5
+1: one
+2: two 2
+end testdata/g.5 after 2
+skipping testdata/nonexistent: no such file or directory
+start testdata/g.6
+1: Uno
+2: Duo
+end testdata/g.6 after 2
+4 records
+`[1:]
+	if stdout != expected {
+		t.Fatalf("expected %q, got %q", expected, stdout)
+	}
+
+	// Unreadable file is still an error if BEGINFILE doesn't skip it
+	_, stderr, err = runGoAWK([]string{`BEGINFILE { print ERRNO }`, "testdata/nonexistent"}, "")
+	if err == nil {
+		t.Fatalf("expected error, got none")
+	}
+	if !strings.Contains(stderr, "testdata/nonexistent") {
+		t.Fatalf("expected error about testdata/nonexistent, got %q", stderr)
+	}
+}
+
 func TestCSVDocExamples(t *testing.T) {
 	f, err := os.Open("docs/csv.md")
 	if err != nil {
@@ -839,6 +942,7 @@ func TestCoverPrintAnnotatedSource(t *testing.T) {
 		{[]string{"a2.awk"}, "count", "a2_covermode_count.awk"},
 		{[]string{"a1.awk", "a2.awk"}, "count", "a1_a2_covermode_count.awk"},
 		{[]string{"a3.awk"}, "set", "a3_covermode_set.awk"},
+		{[]string{"a5.awk"}, "branch", "a5_covermode_branch.awk"},
 	}
 
 	for _, test := range tests {
@@ -877,8 +981,12 @@ func TestCoverInvalidArgs(t *testing.T) {
 	}{
 		{[]string{"-coverprofile"}, "flag needs an argument: -coverprofile"},
 		{[]string{"-covermode"}, "flag needs an argument: -covermode"},
-		{[]string{"-covermode", "wrong"}, "-covermode can only be one of: set, count"},
-		{[]string{"-covermode=wrong"}, "-covermode can only be one of: set, count"},
+		{[]string{"-covermode", "wrong"}, "-covermode can only be one of: set, count, branch"},
+		{[]string{"-covermode=wrong"}, "-covermode can only be one of: set, count, branch"},
+		{[]string{"-coverreport"}, "flag needs an argument: -coverreport"},
+		{[]string{"-coverreport", "xml", "cover.out"}, "-coverreport can only be one of: html, text"},
+		{[]string{"-coverreport=html"}, "usage: goawk -coverreport html|text profile"},
+		{[]string{"-coverreport", "text", "testdata/cover/nonexistent.cov"}, "unable to write coverage report: open testdata/cover/nonexistent.cov: no such file or directory"},
 	}
 
 	for _, test := range tests {
@@ -910,6 +1018,7 @@ func TestCover(t *testing.T) {
 		{"count", true, [][]string{{"a2.awk", "a1.awk"}, {"a2.awk", "a1.awk"}}, "test_2file2runs_count.cov"},
 		{"set", false, [][]string{{"a1.awk"}, {"a1.awk"}}, "test_1file2runs_set_truncated.cov"},
 		{"count", false, [][]string{{"a2.awk", "a1.awk"}, {"a2.awk", "a1.awk"}}, "test_2file2runs_count_truncated.cov"},
+		{"branch", false, [][]string{{"a5.awk"}}, "test_a5_branch.cov"},
 	}
 
 	for _, test := range tests {
@@ -965,6 +1074,52 @@ func TestCover(t *testing.T) {
 	}
 }
 
+func TestCoverReport(t *testing.T) {
+	tempFile, err := ioutil.TempFile("", "testCov*.txt")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = tempFile.Close()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	coverProfile := tempFile.Name()
+	defer os.Remove(coverProfile)
+
+	_, _, err = runGoAWK([]string{"-f", "testdata/cover/a4.awk", "-coverprofile", coverProfile}, "")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	stdout, stderr, err := runGoAWK([]string{"-coverreport", "text", coverProfile}, "")
+	if err != nil {
+		t.Fatalf("%v: %s", err, stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(string(normalizeNewlines([]byte(stdout)))), "\n")
+	for i, line := range lines {
+		// Remove absolute path and whitespace to make comparison easier
+		fields := strings.Fields(line)
+		fields[0] = filepath.Base(fields[0])
+		lines[i] = strings.Join(fields, " ")
+	}
+	expected := []string{
+		"a4.awk:1: f 66.7%",
+		"a4.awk:6: g 0.0%",
+		"a4.awk: (file) 60.0%",
+		"total: (statements) 60.0%",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("wrong coverage report, expected:\n%s\n\nactual:\n%s", strings.Join(expected, "\n"), stdout)
+	}
+
+	stdout, stderr, err = runGoAWK([]string{"-coverreport=html", coverProfile}, "")
+	if err != nil {
+		t.Fatalf("%v: %s", err, stderr)
+	}
+	if !strings.Contains(stdout, `<span class="cov0" title="0">`) || !strings.Contains(stdout, `<span class="cov8" title="1">`) {
+		t.Fatalf("expected covered and uncovered blocks in HTML report, got:\n%s", stdout)
+	}
+}
+
 func convertPathsToFilenames(t *testing.T, str string) string {
 	lines := strings.Split(str, "\n")
 	for i, line := range lines {
@@ -985,3 +1140,47 @@ func convertPathsToFilenames(t *testing.T, str string) string {
 	}
 	return strings.Join(lines, "\n")
 }
+
+func TestAWKProfile(t *testing.T) {
+	tempFile, err := ioutil.TempFile("", "testProfile*.txt")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = tempFile.Close()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	awkProfile := tempFile.Name()
+	defer os.Remove(awkProfile)
+
+	src := "function double(n) { return n*2 }\n{ s += double($1) }\nEND { print s }"
+	stdout, stderr, err := runGoAWK([]string{"-awkprofile", awkProfile, src}, "1\n2\n3\n")
+	if err != nil {
+		t.Fatalf("expected no error, got %v (%q)", err, stderr)
+	}
+	if stdout != "12\n" {
+		t.Fatalf("expected %q, got %q", "12\n", stdout)
+	}
+	result, err := ioutil.ReadFile(awkProfile)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	// Times vary from run to run, so only check the counts.
+	var counts []string
+	for _, line := range strings.Split(string(normalizeNewlines(result)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[0] == "#" {
+			continue
+		}
+		counts = append(counts, fields[0]+" "+strings.Join(fields[3:], " "))
+	}
+	expected := []string{
+		"3 function double(n) { return n*2 }",
+		"3 { s += double($1) }",
+		"1 END { print s }",
+		"3 double (<cmdline>:1)",
+	}
+	if strings.Join(counts, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("expected counts:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(counts, "\n"))
+	}
+}
@@ -13,7 +13,9 @@ import (
 // Program is a parsed AWK program.
 type Program struct {
 	Begin     []Stmts
+	BeginFile []Stmts
 	Actions   []*Action
+	EndFile   []Stmts
 	End       []Stmts
 	Functions []*Function
 }
@@ -25,9 +27,15 @@ func (p *Program) String() string {
 	for _, ss := range p.Begin {
 		parts = append(parts, "BEGIN {\n"+ss.String()+"}")
 	}
+	for _, ss := range p.BeginFile {
+		parts = append(parts, "BEGINFILE {\n"+ss.String()+"}")
+	}
 	for _, a := range p.Actions {
 		parts = append(parts, a.String())
 	}
+	for _, ss := range p.EndFile {
+		parts = append(parts, "ENDFILE {\n"+ss.String()+"}")
+	}
 	for _, ss := range p.End {
 		parts = append(parts, "END {\n"+ss.String()+"}")
 	}
@@ -53,8 +61,10 @@ func (ss Stmts) String() string {
 
 // Action is pattern-action section of a program.
 type Action struct {
-	Pattern []Expr
-	Stmts   Stmts
+	Pattern    []Expr
+	Stmts      Stmts
+	PatternPos []Position // start position of each expression in Pattern
+	PatternEnd []Position // position immediately after each expression in Pattern
 }
 
 func (a *Action) String() string {
@@ -270,18 +280,26 @@ func (e *InExpr) String() string {
 
 // CondExpr is an expression like cond ? 1 : 0.
 type CondExpr struct {
-	Cond  Expr
-	True  Expr
-	False Expr
+	Cond    Expr
+	True    Expr
+	False   Expr
+	CondPos Position // start position of Cond
+	CondEnd Position // position of the "?"
 }
 
 func (e *CondExpr) String() string {
-	return parenthesize(e.Cond, e) + " ? " + parenthesize(e.True, e) + " : " + parenthesize(e.False, e)
+	cond := parenthesize(e.Cond, e)
+	if _, ok := e.Cond.(*CondExpr); ok {
+		// Conditional expressions are right-associative
+		cond = "(" + cond + ")"
+	}
+	return cond + " ? " + parenthesize(e.True, e) + " : " + parenthesize(e.False, e)
 }
 
 // NumExpr is a literal number like 1234.
 type NumExpr struct {
 	Value float64
+	Text  string // source text of the literal ("" if not from source)
 }
 
 func (e *NumExpr) String() string {
@@ -419,15 +437,19 @@ func (e *MultiExpr) String() string {
 
 // GetlineExpr is an expression read from file or pipe input.
 type GetlineExpr struct {
-	Command Expr
-	Target  Expr
-	File    Expr
+	Command   Expr
+	Target    Expr
+	File      Expr
+	Coprocess bool // Command is a two-way pipe (cmd |& getline)
 }
 
 func (e *GetlineExpr) String() string {
 	s := ""
 	if e.Command != nil {
 		s += parenthesize(e.Command, e) + " |"
+		if e.Coprocess {
+			s += "&"
+		}
 	}
 	s += "getline"
 	if e.Target != nil {
@@ -453,7 +475,7 @@ func (e *GroupingExpr) String() string {
 // operation, or as the third argument to sub or gsub).
 func IsLValue(expr Expr) bool {
 	switch expr.(type) {
-	case *VarExpr, *IndexExpr, *FieldExpr:
+	case *VarExpr, *IndexExpr, *FieldExpr, *NamedFieldExpr:
 		return true
 	default:
 		return false
@@ -646,10 +668,11 @@ func (s *WhileStmt) String() string {
 
 // DoWhileStmt is a do-while loop.
 type DoWhileStmt struct {
-	Body  Stmts
-	Cond  Expr
-	Start Position
-	End   Position
+	Body     Stmts
+	Cond     Expr
+	Start    Position
+	End      Position
+	WhilePos Position // position of the "while" keyword
 }
 
 func (s *DoWhileStmt) String() string {
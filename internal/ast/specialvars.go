@@ -10,6 +10,7 @@ const (
 	V_ILLEGAL = iota
 	V_ARGC
 	V_CONVFMT
+	V_ERRNO
 	V_FILENAME
 	V_FNR
 	V_FS
@@ -20,7 +21,9 @@ const (
 	V_OFS
 	V_ORS
 	V_OUTPUTMODE
+	V_PREC
 	V_RLENGTH
+	V_ROUNDMODE
 	V_RS
 	V_RSTART
 	V_RT
@@ -32,6 +35,7 @@ const (
 var specialVars = map[string]int{
 	"ARGC":       V_ARGC,
 	"CONVFMT":    V_CONVFMT,
+	"ERRNO":      V_ERRNO,
 	"FILENAME":   V_FILENAME,
 	"FNR":        V_FNR,
 	"FS":         V_FS,
@@ -42,7 +46,9 @@ var specialVars = map[string]int{
 	"OFS":        V_OFS,
 	"ORS":        V_ORS,
 	"OUTPUTMODE": V_OUTPUTMODE,
+	"PREC":       V_PREC,
 	"RLENGTH":    V_RLENGTH,
+	"ROUNDMODE":  V_ROUNDMODE,
 	"RS":         V_RS,
 	"RSTART":     V_RSTART,
 	"RT":         V_RT,
@@ -64,6 +70,8 @@ func SpecialVarName(index int) string {
 		return "ARGC"
 	case V_CONVFMT:
 		return "CONVFMT"
+	case V_ERRNO:
+		return "ERRNO"
 	case V_FILENAME:
 		return "FILENAME"
 	case V_FNR:
@@ -84,8 +92,12 @@ func SpecialVarName(index int) string {
 		return "ORS"
 	case V_OUTPUTMODE:
 		return "OUTPUTMODE"
+	case V_PREC:
+		return "PREC"
 	case V_RLENGTH:
 		return "RLENGTH"
+	case V_ROUNDMODE:
+		return "ROUNDMODE"
 	case V_RS:
 		return "RS"
 	case V_RSTART:
@@ -12,6 +12,7 @@ func TestNameIndex(t *testing.T) {
 		{"ILLEGAL", V_ILLEGAL},
 		{"ARGC", V_ARGC},
 		{"CONVFMT", V_CONVFMT},
+		{"ERRNO", V_ERRNO},
 		{"FILENAME", V_FILENAME},
 		{"FNR", V_FNR},
 		{"FS", V_FS},
@@ -22,7 +23,9 @@ func TestNameIndex(t *testing.T) {
 		{"OFS", V_OFS},
 		{"ORS", V_ORS},
 		{"OUTPUTMODE", V_OUTPUTMODE},
+		{"PREC", V_PREC},
 		{"RLENGTH", V_RLENGTH},
+		{"ROUNDMODE", V_ROUNDMODE},
 		{"RS", V_RS},
 		{"RSTART", V_RSTART},
 		{"RT", V_RT},
@@ -152,9 +152,15 @@ func Walk(v Visitor, node Node) {
 		for _, stmts := range n.Begin {
 			WalkStmtList(v, stmts)
 		}
+		for _, stmts := range n.BeginFile {
+			WalkStmtList(v, stmts)
+		}
 		for _, action := range n.Actions {
 			Walk(v, action)
 		}
+		for _, stmts := range n.EndFile {
+			WalkStmtList(v, stmts)
+		}
 		for _, function := range n.Functions {
 			Walk(v, function)
 		}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math"
 	"regexp"
+	"sort"
 	"strconv"
 
 	"github.com/benhoyt/goawk/internal/ast"
@@ -15,17 +16,125 @@ import (
 // Program holds an entire compiled program.
 type Program struct {
 	Begin     []Opcode
+	BeginFile []Opcode
 	Actions   []Action
+	EndFile   []Opcode
 	End       []Opcode
 	Functions []Function
 	Nums      []float64
 	Strs      []string
 	Regexes   []*regexp.Regexp
 
+	// Source text of each number in Nums that came from a literal, or ""
+	// if it didn't (so that bignum mode can get its exact value)
+	NumLiterals []string
+
+	// Regex constants that are simple enough to match without the regexp
+	// engine (see LiteralRegex)
+	LiteralRegexes []LiteralRegex
+
+	// String constants folded from expressions that convert non-integer
+	// numbers to strings (see ConvertedStr)
+	ConvertedStrs []ConvertedStr
+
+	// Highest field number the program uses ($1, $2, and so on), or -1 if
+	// it may use any field (for example, it uses NF or $i). This lets the
+	// interpreter avoid splitting fields it doesn't need.
+	MaxField int
+
+	// True if the program was compiled with optimizations, which fold
+	// constant expressions using float64 arithmetic
+	Optimized bool
+
 	// For disassembly
 	scalarNames     []string
 	arrayNames      []string
 	nativeFuncNames []string
+
+	// Source positions of instructions in each block of code (for lint
+	// warnings and runtime errors)
+	blocks []codeBlock
+}
+
+// A block of code (BEGIN, BEGINFILE, ENDFILE, END, a pattern, an action
+// body, or a function body) and its position table.
+type codeBlock struct {
+	code      []Opcode
+	funcIndex int // index into Program.Functions, or -1 if not a function
+	positions []position
+}
+
+// A position table entry: instructions from addr up to the next entry's
+// addr were compiled from the source code at pos.
+type position struct {
+	addr int
+	pos  lexer.Position
+}
+
+// Position returns the source position of the instruction at ip in code.
+// The code slice must be one of the program's blocks of code (BEGIN, END,
+// a pattern, an action body, or a function body), or a sub-slice of one
+// (as the interpreter uses for the body of a for-in loop). If code is part
+// of a function body, that function is returned too.
+//
+// The zero Position is returned if the position isn't known.
+func (p *Program) Position(code []Opcode, ip int) (lexer.Position, *Function) {
+	index, _, offset := p.Block(code)
+	if index < 0 {
+		return lexer.Position{}, nil
+	}
+	b := &p.blocks[index]
+	var f *Function
+	if b.funcIndex >= 0 {
+		f = &p.Functions[b.funcIndex]
+	}
+	addr := offset + ip
+	j := sort.Search(len(b.positions), func(j int) bool {
+		return b.positions[j].addr > addr
+	})
+	if j == 0 {
+		return lexer.Position{}, f
+	}
+	return b.positions[j-1].pos, f
+}
+
+// Block returns the index of the block of code that code is part of (see
+// Position), the entire block, and the offset of code within the block. The
+// index is -1 if code isn't part of the program.
+func (p *Program) Block(code []Opcode) (index int, block []Opcode, offset int) {
+	if len(code) == 0 {
+		return -1, nil, 0
+	}
+	for i := range p.blocks {
+		b := &p.blocks[i]
+		// If code is a sub-slice of this block, they share the same
+		// underlying array, so the difference in capacity is the offset.
+		offset := cap(b.code) - cap(code)
+		if offset >= 0 && offset < len(b.code) && &b.code[offset] == &code[0] {
+			return i, b.code, offset
+		}
+	}
+	return -1, nil, 0
+}
+
+// IterPositions calls fn for each entry in the position tables of the
+// program's blocks of code: the instructions from start up to end in the
+// block with the given index were compiled from the source code at pos. If
+// the block is a function body, f is that function (otherwise it's nil).
+func (p *Program) IterPositions(fn func(index int, f *Function, start, end int, pos lexer.Position)) {
+	for i, b := range p.blocks {
+		var f *Function
+		if b.funcIndex >= 0 {
+			f = &p.Functions[b.funcIndex]
+		}
+		for j, entry := range b.positions {
+			end := len(b.code)
+			if j+1 < len(b.positions) {
+				end = b.positions[j+1].addr
+			}
+			fn(i, f, entry.addr, end, entry.pos)
+		}
+	}
 }
 
 // Action holds a compiled pattern-action block.
@@ -56,7 +165,9 @@ func (e *compileError) Error() string {
 }
 
 // Compile compiles an AST (parsed program) into virtual machine instructions.
-func Compile(resolved *resolver.ResolvedProgram) (compiledProg *Program, err error) {
+// If optimize is true, the code is also run through the peephole optimizer
+// (see optimize.go).
+func Compile(resolved *resolver.ResolvedProgram, optimize bool) (compiledProg *Program, err error) {
 	defer func() {
 		// The compiler uses panic with a *compileError to signal compile
 		// errors internally, and they're caught here. This avoids the
@@ -67,13 +178,19 @@ func Compile(resolved *resolver.ResolvedProgram) (compiledProg *Program, err err
 		}
 	}()
 
-	p := &Program{}
+	p := &Program{Optimized: optimize}
+
+	// Conversions of non-integer numbers to strings can only be folded if
+	// the program doesn't change CONVFMT.
+	foldConvfmt := optimize && !assignsConvfmt(&resolved.Program)
 
 	// Reuse identical constants across entire program.
 	indexes := constantIndexes{
-		nums:    make(map[float64]int),
-		strs:    make(map[string]int),
-		regexes: make(map[string]int),
+		nums:        make(map[float64]int),
+		numLiterals: make(map[string]int),
+		strs:        make(map[string]int),
+		regexes:     make(map[string]int),
+		literals:    make(map[string]int),
 	}
 
 	// Compile functions. For functions called before they're defined or
@@ -100,17 +217,29 @@ func Compile(resolved *resolver.ResolvedProgram) (compiledProg *Program, err err
 		p.Functions[i] = compiledFunc
 	}
 	for i, astFunc := range resolved.Functions {
-		c := compiler{resolved: resolved, program: p, indexes: indexes, funcName: astFunc.Name}
+		c := compiler{resolved: resolved, program: p, indexes: indexes, optimize: optimize, foldConvfmt: foldConvfmt, funcName: astFunc.Name}
 		c.stmts(astFunc.Body)
 		p.Functions[i].Body = c.finish()
+		p.addBlock(p.Functions[i].Body, i, c.positions)
 	}
 
-	// Compile BEGIN blocks.
-	for _, stmts := range resolved.Begin {
-		c := compiler{resolved: resolved, program: p, indexes: indexes}
-		c.stmts(stmts)
-		p.Begin = append(p.Begin, c.finish()...)
+	// Compile BEGIN and BEGINFILE blocks (each kind is concatenated into a
+	// single block of code).
+	compileBlocks := func(stmtsList []ast.Stmts) []Opcode {
+		var code []Opcode
+		var positions []position
+		for _, stmts := range stmtsList {
+			c := compiler{resolved: resolved, program: p, indexes: indexes, optimize: optimize, foldConvfmt: foldConvfmt}
+			c.stmts(stmts)
+			blockCode := c.finish()
+			positions = appendPositions(positions, len(code), c.positions)
+			code = append(code, blockCode...)
+		}
+		p.addBlock(code, -1, positions)
+		return code
 	}
+	p.Begin = compileBlocks(resolved.Begin)
+	p.BeginFile = compileBlocks(resolved.BeginFile)
 
 	// Compile pattern-action blocks.
 	for _, action := range resolved.Actions {
@@ -118,23 +247,23 @@ func Compile(resolved *resolver.ResolvedProgram) (compiledProg *Program, err err
 		switch len(action.Pattern) {
 		case 0:
 			// Always considered a match
-		case 1:
-			c := compiler{resolved: resolved, program: p, indexes: indexes}
-			c.expr(action.Pattern[0])
-			pattern = [][]Opcode{c.finish()}
-		case 2:
-			c := compiler{resolved: resolved, program: p, indexes: indexes}
-			c.expr(action.Pattern[0])
-			pattern = append(pattern, c.finish())
-			c = compiler{resolved: resolved, program: p, indexes: indexes}
-			c.expr(action.Pattern[1])
-			pattern = append(pattern, c.finish())
+		default:
+			for i, expr := range action.Pattern {
+				c := compiler{resolved: resolved, program: p, indexes: indexes, optimize: optimize, foldConvfmt: foldConvfmt}
+				if i < len(action.PatternPos) {
+					c.pos = action.PatternPos[i]
+				}
+				c.expr(expr)
+				pattern = append(pattern, c.finish())
+				p.addBlock(pattern[i], -1, c.positions)
+			}
 		}
 		var body []Opcode
 		if len(action.Stmts) > 0 {
-			c := compiler{resolved: resolved, program: p, indexes: indexes}
+			c := compiler{resolved: resolved, program: p, indexes: indexes, optimize: optimize, foldConvfmt: foldConvfmt}
 			c.stmts(action.Stmts)
 			body = c.finish()
+			p.addBlock(body, -1, c.positions)
 		}
 		p.Actions = append(p.Actions, Action{
 			Pattern: pattern,
@@ -142,12 +271,9 @@ func Compile(resolved *resolver.ResolvedProgram) (compiledProg *Program, err err
 		})
 	}
 
-	// Compile END blocks.
-	for _, stmts := range resolved.End {
-		c := compiler{resolved: resolved, program: p, indexes: indexes}
-		c.stmts(stmts)
-		p.End = append(p.End, c.finish()...)
-	}
+	// Compile ENDFILE and END blocks.
+	p.EndFile = compileBlocks(resolved.EndFile)
+	p.End = compileBlocks(resolved.End)
 
 	// Build slices that map indexes to names (for variables and functions).
 	// These are only used for disassembly, but set them up here.
@@ -174,22 +300,44 @@ func Compile(resolved *resolver.ResolvedProgram) (compiledProg *Program, err err
 	return p, nil
 }
 
+func (p *Program) addBlock(code []Opcode, funcIndex int, positions []position) {
+	if len(code) == 0 {
+		return
+	}
+	p.blocks = append(p.blocks, codeBlock{code, funcIndex, positions})
+}
+
+// Append position table entries for a block of code that will be appended
+// at the given offset.
+func appendPositions(dst []position, offset int, src []position) []position {
+	for _, entry := range src {
+		dst = append(dst, position{offset + entry.addr, entry.pos})
+	}
+	return dst
+}
+
 // So we can look up the indexes of constants that have been used before.
 type constantIndexes struct {
-	nums    map[float64]int
-	strs    map[string]int
-	regexes map[string]int
+	nums        map[float64]int
+	numLiterals map[string]int
+	strs        map[string]int
+	regexes     map[string]int
+	literals    map[string]int
 }
 
 // Holds the compilation state.
 type compiler struct {
-	resolved  *resolver.ResolvedProgram
-	program   *Program
-	indexes   constantIndexes
-	funcName  string
-	code      []Opcode
-	breaks    [][]int
-	continues [][]int
+	resolved    *resolver.ResolvedProgram
+	program     *Program
+	indexes     constantIndexes
+	funcName    string
+	optimize    bool
+	foldConvfmt bool // see fold.go
+	code        []Opcode
+	breaks      [][]int
+	continues   [][]int
+	pos         lexer.Position // source position of code being compiled
+	positions   []position
 }
 
 func (c *compiler) scalarInfo(name string) (scope resolver.Scope, index int) {
@@ -209,10 +357,20 @@ func (c *compiler) arrayInfo(name string) (scope resolver.Scope, index int) {
 }
 
 func (c *compiler) add(ops ...Opcode) {
+	if len(ops) == 0 {
+		return
+	}
+	n := len(c.positions)
+	if n == 0 || c.positions[n-1].pos != c.pos {
+		c.positions = append(c.positions, position{len(c.code), c.pos})
+	}
 	c.code = append(c.code, ops...)
 }
 
 func (c *compiler) finish() []Opcode {
+	if c.optimize {
+		c.optimizeCode()
+	}
 	return c.code
 }
 
@@ -223,6 +381,15 @@ func (c *compiler) stmts(stmts []ast.Stmt) {
 }
 
 func (c *compiler) stmt(stmt ast.Stmt) {
+	// Record the statement's position for the code generated for it, and
+	// restore the enclosing statement's position afterwards (for example,
+	// for the condition check at the end of a loop).
+	enclosingPos := c.pos
+	c.pos = stmt.StartPos()
+	defer func() {
+		c.pos = enclosingPos
+	}()
+
 	switch s := stmt.(type) {
 	case *ast.ExprStmt:
 		// Optimize assignment expressions to avoid the extra Dupe and Drop
@@ -243,11 +410,17 @@ func (c *compiler) stmt(stmt ast.Stmt) {
 				case resolver.Local:
 					c.add(IncrLocal, incrAmount(expr.Op), opcodeInt(index))
 				default: // ScopeSpecial
+					c.useSpecial(index)
 					c.add(IncrSpecial, incrAmount(expr.Op), opcodeInt(index))
 				}
 			case *ast.FieldExpr:
+				c.useField(target.Index, true)
 				c.expr(target.Index)
 				c.add(IncrField, incrAmount(expr.Op))
+			case *ast.NamedFieldExpr:
+				c.useField(nil, true)
+				c.expr(target.Field)
+				c.add(IncrFieldByName, incrAmount(expr.Op))
 			case *ast.IndexExpr:
 				c.index(target.Index)
 				scope, index := c.arrayInfo(target.Array)
@@ -288,11 +461,17 @@ func (c *compiler) stmt(stmt ast.Stmt) {
 				case resolver.Local:
 					c.add(AugAssignLocal, Opcode(augOp), opcodeInt(index))
 				default: // ScopeSpecial
+					c.useSpecial(index)
 					c.add(AugAssignSpecial, Opcode(augOp), opcodeInt(index))
 				}
 			case *ast.FieldExpr:
+				c.useField(target.Index, true)
 				c.expr(target.Index)
 				c.add(AugAssignField, Opcode(augOp))
+			case *ast.NamedFieldExpr:
+				c.useField(nil, true)
+				c.expr(target.Field)
+				c.add(AugAssignFieldByName, Opcode(augOp))
 			case *ast.IndexExpr:
 				c.index(target.Index)
 				scope, index := c.arrayInfo(target.Array)
@@ -463,7 +642,7 @@ func (c *compiler) stmt(stmt ast.Stmt) {
 		if s.Status != nil {
 			c.expr(s.Status)
 		} else {
-			c.expr(&ast.NumExpr{0})
+			c.expr(&ast.NumExpr{Value: 0})
 		}
 		c.add(Exit)
 
@@ -494,6 +673,33 @@ func incrAmount(op lexer.Token) Opcode {
 	}
 }
 
+// Record that the program uses the field $index (or assigns to it, if
+// assign is true), to update Program.MaxField. A nil or non-constant index
+// means it may use any field.
+func (c *compiler) useField(index ast.Expr, assign bool) {
+	n := -1
+	if num, ok := index.(*ast.NumExpr); ok && num.Value == float64(int(num.Value)) {
+		n = int(num.Value)
+	}
+	switch {
+	case n == 0:
+		// $0 itself doesn't need the fields split
+	case n < 0 || assign:
+		// Assigning a field rebuilds $0 from all the fields
+		c.program.MaxField = -1
+	case c.program.MaxField >= 0 && n > c.program.MaxField:
+		c.program.MaxField = n
+	}
+}
+
+// Record that the program uses the special variable with the given index
+// (NF needs all the fields split).
+func (c *compiler) useSpecial(index int) {
+	if index == ast.V_NF {
+		c.program.MaxField = -1
+	}
+}
+
 // Generate opcodes for an assignment.
 func (c *compiler) assign(target ast.Expr) {
 	switch target := target.(type) {
@@ -505,11 +711,17 @@ func (c *compiler) assign(target ast.Expr) {
 		case resolver.Local:
 			c.add(AssignLocal, opcodeInt(index))
 		case resolver.Special:
+			c.useSpecial(index)
 			c.add(AssignSpecial, opcodeInt(index))
 		}
 	case *ast.FieldExpr:
+		c.useField(target.Index, true)
 		c.expr(target.Index)
 		c.add(AssignField)
+	case *ast.NamedFieldExpr:
+		c.useField(nil, true)
+		c.expr(target.Field)
+		c.add(AssignFieldByName)
 	case *ast.IndexExpr:
 		c.index(target.Index)
 		scope, index := c.arrayInfo(target.Array)
@@ -585,6 +797,12 @@ func (c *compiler) condition(expr ast.Expr, invert bool) Opcode {
 		return normal
 	}
 
+	if _, ok := c.fold(expr); ok {
+		// Constant condition (the optimizer folds the jump)
+		c.expr(expr)
+		return jumpOp(JumpTrue, JumpFalse)
+	}
+
 	switch cond := expr.(type) {
 	case *ast.BinaryExpr:
 		// Optimize binary comparison expressions like "x < 10" into just
@@ -629,15 +847,22 @@ func (c *compiler) condition(expr ast.Expr, invert bool) Opcode {
 }
 
 func (c *compiler) expr(expr ast.Expr) {
+	// Evaluate constant expressions like 2^10 or "a" "b" at compile time.
+	if v, ok := c.fold(expr); ok && c.constant(v) {
+		return
+	}
+
 	switch e := expr.(type) {
 	case *ast.NumExpr:
-		c.add(Num, opcodeInt(c.numIndex(e.Value)))
+		c.add(Num, opcodeInt(c.numLiteralIndex(e.Value, e.Text)))
 
 	case *ast.StrExpr:
 		c.add(Str, opcodeInt(c.strIndex(e.Value)))
 
 	case *ast.FieldExpr:
-		switch index := e.Index.(type) {
+		fieldIndex := c.foldExpr(e.Index)
+		c.useField(fieldIndex, false)
+		switch index := fieldIndex.(type) {
 		case *ast.NumExpr:
 			if index.Value == float64(Opcode(index.Value)) {
 				// Optimize $i to FieldInt opcode with integer argument
@@ -645,11 +870,12 @@ func (c *compiler) expr(expr ast.Expr) {
 				return
 			}
 		}
-		c.expr(e.Index)
+		c.expr(fieldIndex)
 		c.add(Field)
 
 	case *ast.NamedFieldExpr:
-		switch index := e.Field.(type) {
+		c.useField(nil, false)
+		switch index := c.foldExpr(e.Field).(type) {
 		case *ast.StrExpr:
 			c.add(FieldByNameStr, opcodeInt(c.strIndex(index.Value)))
 			return
@@ -665,10 +891,16 @@ func (c *compiler) expr(expr ast.Expr) {
 		case resolver.Local:
 			c.add(Local, opcodeInt(index))
 		case resolver.Special:
+			c.useSpecial(index)
 			c.add(Special, opcodeInt(index))
 		}
 
 	case *ast.RegExpr:
+		if index, ok := c.literalIndex(e.Regex); ok {
+			// Simple regex like /foo/ doesn't need the regexp engine
+			c.add(RegexLiteral, opcodeInt(index))
+			return
+		}
 		c.add(Regex, opcodeInt(c.regexIndex(e.Regex)))
 
 	case *ast.BinaryExpr:
@@ -692,6 +924,21 @@ func (c *compiler) expr(expr ast.Expr) {
 			c.add(Boolean)
 		case lexer.CONCAT:
 			c.concatOp(e)
+		case lexer.MATCH, lexer.NOT_MATCH:
+			c.expr(e.Left)
+			if regex, ok := c.foldExpr(e.Right).(*ast.StrExpr); ok {
+				if index, ok := c.literalIndex(regex.Value); ok {
+					// Simple regex constant like $1 ~ /foo/
+					if e.Op == lexer.MATCH {
+						c.add(MatchLiteral, opcodeInt(index))
+					} else {
+						c.add(NotMatchLiteral, opcodeInt(index))
+					}
+					return
+				}
+			}
+			c.expr(e.Right)
+			c.binaryOp(e.Op)
 		default:
 			// All other binary expressions
 			c.expr(e.Left)
@@ -707,15 +954,15 @@ func (c *compiler) expr(expr ast.Expr) {
 		}
 		if e.Pre {
 			c.expr(e.Expr)
-			c.expr(&ast.NumExpr{1})
+			c.expr(&ast.NumExpr{Value: 1})
 			c.add(op)
 			c.add(Dupe)
 		} else {
 			c.expr(e.Expr)
-			c.expr(&ast.NumExpr{0})
+			c.expr(&ast.NumExpr{Value: 0})
 			c.add(Add)
 			c.add(Dupe)
-			c.expr(&ast.NumExpr{1})
+			c.expr(&ast.NumExpr{Value: 1})
 			c.add(op)
 		}
 		c.assign(e.Expr)
@@ -768,12 +1015,26 @@ func (c *compiler) expr(expr ast.Expr) {
 				c.add(CallSplit, Opcode(scope), opcodeInt(index))
 			}
 			return
+		case lexer.F_PRINTROW:
+			varExpr := e.Args[0].(*ast.VarExpr) // printrow()'s args are always arrays
+			scope, index := c.arrayInfo(varExpr.Name)
+			var fieldsScope resolver.Scope
+			var fieldsIndex int
+			if len(e.Args) > 1 {
+				fieldsScope, fieldsIndex = c.arrayInfo(e.Args[1].(*ast.VarExpr).Name)
+			} else {
+				// Default order of fields is given by global OFIELDS array
+				_, info, _ := c.resolved.LookupVar("", "OFIELDS")
+				fieldsScope, fieldsIndex = resolver.Global, info.Index
+			}
+			c.add(CallPrintrow, Opcode(scope), opcodeInt(index), Opcode(fieldsScope), opcodeInt(fieldsIndex))
+			return
 		case lexer.F_SUB, lexer.F_GSUB:
 			op := BuiltinSub
 			if e.Func == lexer.F_GSUB {
 				op = BuiltinGsub
 			}
-			var target ast.Expr = &ast.FieldExpr{&ast.NumExpr{0}} // default value and target is $0
+			var target ast.Expr = &ast.FieldExpr{&ast.NumExpr{Value: 0}} // default value and target is $0
 			if len(e.Args) == 3 {
 				target = e.Args[2]
 			}
@@ -808,7 +1069,11 @@ func (c *compiler) expr(expr ast.Expr) {
 		case lexer.F_ATAN2:
 			c.add(CallBuiltin, Opcode(BuiltinAtan2))
 		case lexer.F_CLOSE:
-			c.add(CallBuiltin, Opcode(BuiltinClose))
+			if len(e.Args) > 1 {
+				c.add(CallBuiltin, Opcode(BuiltinCloseHow))
+			} else {
+				c.add(CallBuiltin, Opcode(BuiltinClose))
+			}
 		case lexer.F_COS:
 			c.add(CallBuiltin, Opcode(BuiltinCos))
 		case lexer.F_EXP:
@@ -911,6 +1176,9 @@ func (c *compiler) expr(expr ast.Expr) {
 			switch {
 			case e.Command != nil:
 				c.expr(e.Command)
+				if e.Coprocess {
+					return Opcode(lexer.PIPE_AMP)
+				}
 				return Opcode(lexer.PIPE)
 			case e.File != nil:
 				c.expr(e.File)
@@ -928,11 +1196,17 @@ func (c *compiler) expr(expr ast.Expr) {
 			case resolver.Local:
 				c.add(GetlineLocal, redirect(), opcodeInt(index))
 			case resolver.Special:
+				c.useSpecial(index)
 				c.add(GetlineSpecial, redirect(), opcodeInt(index))
 			}
 		case *ast.FieldExpr:
+			c.useField(target.Index, true)
 			c.expr(target.Index)
 			c.add(GetlineField, redirect())
+		case *ast.NamedFieldExpr:
+			c.useField(nil, true)
+			c.expr(target.Field)
+			c.add(GetlineFieldByName, redirect())
 		case *ast.IndexExpr:
 			c.index(target.Index)
 			scope, index := c.arrayInfo(target.Array)
@@ -966,19 +1240,46 @@ func (c *compiler) concatOp(expr *ast.BinaryExpr) {
 
 	// values are appended right to left
 	// but need to pushed left to right
-
-	if len(values) == 2 {
-		c.expr(values[1])
-		c.expr(values[0])
-		c.add(Concat)
-		return
+	for i, j := 0, len(values)-1; i < j; i, j = i+1, j-1 {
+		values[i], values[j] = values[j], values[i]
 	}
 
-	for i := len(values) - 1; i >= 0; i-- {
-		c.expr(values[i])
+	// Concatenate runs of adjacent constants at compile time, as in
+	// "prefix" "-" $1.
+	type concatValue struct {
+		expr     ast.Expr
+		constant constant
+		isConst  bool
+	}
+	var folded []concatValue
+	for _, value := range values {
+		v, ok := c.fold(value)
+		n := len(folded)
+		if ok && n > 0 && folded[n-1].isConst {
+			prev, ok1 := c.toStr(folded[n-1].constant)
+			next, ok2 := c.toStr(v)
+			if ok1 && ok2 {
+				merged := strConstant(prev.s + next.s)
+				if prev.parts != nil || next.parts != nil {
+					merged.parts = append(strParts(prev), strParts(next)...)
+				}
+				folded[n-1].constant = merged
+				continue
+			}
+		}
+		folded = append(folded, concatValue{value, v, ok})
 	}
 
-	c.add(ConcatMulti, opcodeInt(len(values)))
+	for _, value := range folded {
+		if !value.isConst || !c.constant(value.constant) {
+			c.expr(value.expr)
+		}
+	}
+	if len(folded) == 2 {
+		c.add(Concat)
+	} else {
+		c.add(ConcatMulti, opcodeInt(len(folded)))
+	}
 }
 
 // Add (or reuse) a number constant and returns its index.
@@ -988,10 +1289,28 @@ func (c *compiler) numIndex(n float64) int {
 	}
 	index := len(c.program.Nums)
 	c.program.Nums = append(c.program.Nums, n)
+	c.program.NumLiterals = append(c.program.NumLiterals, "")
 	c.indexes.nums[n] = index
 	return index
 }
 
+// Add (or reuse) a number constant from a literal with the given source
+// text and return its index. Literals with different text may have the
+// same float64 value, so these are looked up by text.
+func (c *compiler) numLiteralIndex(n float64, text string) int {
+	if text == "" {
+		return c.numIndex(n)
+	}
+	if index, ok := c.indexes.numLiterals[text]; ok {
+		return index
+	}
+	index := len(c.program.Nums)
+	c.program.Nums = append(c.program.Nums, n)
+	c.program.NumLiterals = append(c.program.NumLiterals, text)
+	c.indexes.numLiterals[text] = index
+	return index
+}
+
 // Add (or reuse) a string constant and returns its index.
 func (c *compiler) strIndex(s string) int {
 	if index, ok := c.indexes.strs[s]; ok {
@@ -1014,6 +1333,22 @@ func (c *compiler) regexIndex(r string) int {
 	return index
 }
 
+// Add (or reuse) a LiteralRegex constant and return its index, or report
+// false if the regex isn't simple enough to be one.
+func (c *compiler) literalIndex(r string) (int, bool) {
+	if index, ok := c.indexes.literals[r]; ok {
+		return index, true // reuse existing constant
+	}
+	literal, ok := parseLiteralRegex(r)
+	if !ok {
+		return 0, false
+	}
+	index := len(c.program.LiteralRegexes)
+	c.program.LiteralRegexes = append(c.program.LiteralRegexes, literal)
+	c.indexes.literals[r] = index
+	return index, true
+}
+
 // AddRegexFlags add the necessary flags to regex to make it work like other
 // AWKs (exported so we can also use this in the interpreter).
 func AddRegexFlags(regex string) string {
@@ -1061,6 +1396,7 @@ func (c *compiler) binaryOp(op lexer.Token) {
 // Generate an array index, handling multi-indexes properly.
 func (c *compiler) index(index []ast.Expr) {
 	for _, expr := range index {
+		expr = c.foldExpr(expr)
 		if e, ok := expr.(*ast.NumExpr); ok && e.Value == float64(int(e.Value)) {
 			// If index expression is integer constant, optimize to string "n"
 			// to avoid toString() at runtime.
@@ -0,0 +1,216 @@
+package compiler_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/benhoyt/goawk/parser"
+)
+
+func TestMaxField(t *testing.T) {
+	tests := []struct {
+		src      string
+		maxField int
+	}{
+		{`{ print }`, 0},
+		{`{ print $0; $0 = "x"; sub(/a/, "b") }`, 0},
+		{`{ print $1 }`, 1},
+		{`$3 > 0 { print $1, $2 }`, 3},
+		{`function f() { return $5 } { print $2, f() }`, 5},
+		{`{ print NF }`, -1},
+		{`{ print $NF }`, -1},
+		{`{ for (i=1; i<=3; i++) print $i }`, -1},
+		{`{ print $1.5 }`, -1},
+		{`{ $2 = "x"; print $1 }`, -1},
+		{`{ $1++ }`, -1},
+		{`{ $1 += 2 }`, -1},
+		{`{ sub(/a/, "b", $1) }`, -1},
+		{`{ getline $1 }`, -1},
+		{`{ NF = 2 }`, -1},
+		{`{ print @"name" }`, -1},
+		{`{ print $1 } END { print NF }`, -1},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			prog, err := parser.ParseProgram([]byte(test.src), nil)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			if prog.Compiled.MaxField != test.maxField {
+				t.Fatalf("expected MaxField %d, got %d", test.maxField, prog.Compiled.MaxField)
+			}
+		})
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{`BEGIN { x = 2*3+1; y = -5; z = 1/0 }`, `
+0000    Num 7 (0)
+0002    AssignGlobal x
+0004    Num -5 (1)
+0006    AssignGlobal y
+0008    Num 1 (2)
+000a    Num 0 (3)
+000c    Divide
+000d    AssignGlobal z
+`},
+		{`BEGIN { if (x) exit; else print "a"; print "b" }`, `
+0000    Global x
+0002    JumpFalse 0x0007
+0004    Num 0 (0)
+0006    Exit
+0007    Str "a" (0)
+0009    Print 1
+000c    Str "b" (1)
+000e    Print 1
+`},
+		{`function f(n) { n = n - 1; return n; print "dead" }`, `
+0000    Num 1 (0)
+0002    AugAssignLocal AugOpSub n
+0005    Local n
+0007    Return
+`},
+		{`BEGIN { while (1) { if (y) continue; y++ } }`, `
+0000    Global y
+0002    JumpTrue 0x0000
+0004    IncrGlobal 1 y
+0007    Jump 0x0000
+`},
+		{`{ for (k in a) { if (k) continue; print k } }`, `
+0000    ForIn k a 0x000f
+0006    Global k
+0008    JumpTrue 0x000f
+000a    Global k
+000c    Print 1
+`},
+		{`$1 == 1 { print $3 > "out" }`, `
+0000    FieldIntEqualsNum 1 1 (0)
+0000    Str "out" (0)
+0002    PrintField 3 >
+`},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			prog, err := parser.ParseProgram([]byte(test.src), nil)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			var buf bytes.Buffer
+			err = prog.Disassemble(&buf)
+			if err != nil {
+				t.Fatalf("error disassembling: %v", err)
+			}
+			// Only compare the instructions, not the block headers.
+			var lines []string
+			for _, line := range strings.Split(buf.String(), "\n") {
+				if line != "" && !strings.HasPrefix(strings.TrimSpace(line), "//") {
+					lines = append(lines, line)
+				}
+			}
+			disassembly := strings.Join(lines, "\n")
+			expected := strings.TrimSpace(test.expected)
+			if disassembly != expected {
+				t.Fatalf("expected:\n%s\ngot:\n%s", expected, disassembly)
+			}
+
+			// Ensure NoOptimize leaves the code as compiled.
+			config := &parser.ParserConfig{NoOptimize: true}
+			unoptimized, err := parser.ParseProgram([]byte(test.src), config)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			buf.Reset()
+			err = unoptimized.Disassemble(&buf)
+			if err != nil {
+				t.Fatalf("error disassembling: %v", err)
+			}
+			if strings.Contains(buf.String(), "AugAssign") || strings.Contains(buf.String(), "FieldIntEquals") ||
+				strings.Contains(buf.String(), "PrintField") {
+				t.Fatalf("unexpected superinstruction in unoptimized code:\n%s", buf.String())
+			}
+		})
+	}
+}
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected string // first instruction of "x = expr" (without constant index)
+	}{
+		{`"prefix" "-" "x"`, `Str "prefix-x"`},
+		{`2^10`, `Num 1024`},
+		{`length("abc")`, `Num 3`},
+		{`-(1+2)*3 % 5`, `Num -4`},
+		{`1 "" 2.5`, `Str "12.5"`},
+		{`"a" < "b" && 3 >= 3`, `Num 1`},
+		{`!"" || 0`, `Num 1`},
+		{`0 && f()`, `Num 0`},
+		{`1 ? "t" : f()`, `Str "t"`},
+		{`substr("hello", 2, 3) toupper("x") index("abc", "c")`, `Str "ellX3"`},
+		{`int(-3.9) + sqrt(16)`, `Num 1`},
+		{`1/0`, `Num 1`},       // division by zero is a runtime error
+		{`0^-1`, `Num 0`},      // lint warning at runtime
+		{`"3" + 1`, `Str "3"`}, // strings aren't converted to numbers
+		{`"10" < 9`, `Str "10"`},
+		{`-0`, `Num 0`},
+		{`"a" ~ "a"`, `Str "a"`},
+		{`length()`, `CallBuiltin BuiltinLength`},
+		{`"a" y "b" "c"`, `Str "a"`},
+	}
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			src := "function f() { return 1 } BEGIN { x = " + test.expr + " }"
+			prog, err := parser.ParseProgram([]byte(src), nil)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			var buf bytes.Buffer
+			err = prog.Disassemble(&buf)
+			if err != nil {
+				t.Fatalf("error disassembling: %v", err)
+			}
+			lines := strings.Split(buf.String(), "\n")
+			first := strings.TrimSpace(lines[1][4:])
+			if i := strings.LastIndex(first, " ("); i >= 0 {
+				first = first[:i]
+			}
+			if first != test.expected {
+				t.Fatalf("expected %s, got %s:\n%s", test.expected, first, buf.String())
+			}
+		})
+	}
+}
+
+func TestFoldConvfmt(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{`BEGIN { x = 0.5 "" }`, `Str "0.5"`},
+		{`BEGIN { CONVFMT = "%.2g" } END { x = 0.5 "" }`, `Num 0.5`},
+		{`BEGIN { getline CONVFMT; x = 0.5 "" }`, `Num 0.5`},
+		{`BEGIN { sub(/a/, "b", CONVFMT); x = 0.5 "" }`, `Num 0.5`},
+		{`BEGIN { CONVFMT = "%.2g"; x = 1 "" }`, `Str "1"`},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			prog, err := parser.ParseProgram([]byte(test.src), nil)
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			var buf bytes.Buffer
+			err = prog.Disassemble(&buf)
+			if err != nil {
+				t.Fatalf("error disassembling: %v", err)
+			}
+			if !strings.Contains(buf.String(), test.expected) {
+				t.Fatalf("expected %s in disassembly:\n%s", test.expected, buf.String())
+			}
+		})
+	}
+}
@@ -28,6 +28,19 @@ func (p *Program) Disassemble(writer io.Writer) error {
 		}
 	}
 
+	if p.BeginFile != nil {
+		d := &disassembler{
+			program:         p,
+			writer:          writer,
+			code:            p.BeginFile,
+			nativeFuncNames: p.nativeFuncNames,
+		}
+		err := d.disassemble("BEGINFILE")
+		if err != nil {
+			return err
+		}
+	}
+
 	for _, action := range p.Actions {
 		switch len(action.Pattern) {
 		case 0:
@@ -79,6 +92,19 @@ func (p *Program) Disassemble(writer io.Writer) error {
 		}
 	}
 
+	if p.EndFile != nil {
+		d := &disassembler{
+			program:         p,
+			writer:          writer,
+			code:            p.EndFile,
+			nativeFuncNames: p.nativeFuncNames,
+		}
+		err := d.disassemble("ENDFILE")
+		if err != nil {
+			return err
+		}
+	}
+
 	if p.End != nil {
 		d := &disassembler{
 			program:         p,
@@ -214,6 +240,10 @@ func (d *disassembler) disassemble(prefix string) error {
 			amount := d.fetch()
 			d.writeOpf("IncrField %d", amount)
 
+		case IncrFieldByName:
+			amount := d.fetch()
+			d.writeOpf("IncrFieldByName %d", amount)
+
 		case IncrGlobal:
 			amount := d.fetch()
 			index := d.fetch()
@@ -243,6 +273,10 @@ func (d *disassembler) disassemble(prefix string) error {
 			operation := AugOp(d.fetch())
 			d.writeOpf("AugAssignField %s", operation)
 
+		case AugAssignFieldByName:
+			operation := AugOp(d.fetch())
+			d.writeOpf("AugAssignFieldByName %s", operation)
+
 		case AugAssignGlobal:
 			operation := AugOp(d.fetch())
 			index := d.fetch()
@@ -272,6 +306,18 @@ func (d *disassembler) disassemble(prefix string) error {
 			regexIndex := d.fetch()
 			d.writeOpf("Regex %q (%d)", d.program.Regexes[regexIndex], regexIndex)
 
+		case RegexLiteral:
+			index := d.fetch()
+			d.writeOpf("RegexLiteral %q (%d)", d.program.LiteralRegexes[index].Regex, index)
+
+		case MatchLiteral:
+			index := d.fetch()
+			d.writeOpf("MatchLiteral %q (%d)", d.program.LiteralRegexes[index].Regex, index)
+
+		case NotMatchLiteral:
+			index := d.fetch()
+			d.writeOpf("NotMatchLiteral %q (%d)", d.program.LiteralRegexes[index].Regex, index)
+
 		case IndexMulti:
 			num := d.fetch()
 			d.writeOpf("IndexMulti %d", num)
@@ -343,6 +389,13 @@ func (d *disassembler) disassemble(prefix string) error {
 			arrayIndex := int(d.fetch())
 			d.writeOpf("CallSplitSep %s", d.arrayName(arrayScope, arrayIndex))
 
+		case CallPrintrow:
+			arrayScope := resolver.Scope(d.fetch())
+			arrayIndex := int(d.fetch())
+			fieldsScope := resolver.Scope(d.fetch())
+			fieldsIndex := int(d.fetch())
+			d.writeOpf("CallPrintrow %s %s", d.arrayName(arrayScope, arrayIndex), d.arrayName(fieldsScope, fieldsIndex))
+
 		case CallSprintf:
 			numArgs := d.fetch()
 			d.writeOpf("CallSprintf %d", numArgs)
@@ -393,6 +446,10 @@ func (d *disassembler) disassemble(prefix string) error {
 			redirect := lexer.Token(d.fetch())
 			d.writeOpf("GetlineField %s", redirect)
 
+		case GetlineFieldByName:
+			redirect := lexer.Token(d.fetch())
+			d.writeOpf("GetlineFieldByName %s", redirect)
+
 		case GetlineGlobal:
 			redirect := lexer.Token(d.fetch())
 			index := d.fetch()
@@ -414,6 +471,30 @@ func (d *disassembler) disassemble(prefix string) error {
 			arrayIndex := int(d.fetch())
 			d.writeOpf("GetlineArray %s %s", redirect, d.arrayName(arrayScope, arrayIndex))
 
+		case FieldIntEqualsNum:
+			index := d.fetch()
+			numIndex := d.fetch()
+			num := d.program.Nums[numIndex]
+			if num == float64(int(num)) {
+				d.writeOpf("FieldIntEqualsNum %d %d (%d)", index, int(num), numIndex)
+			} else {
+				d.writeOpf("FieldIntEqualsNum %d %.6g (%d)", index, num, numIndex)
+			}
+
+		case FieldIntEqualsStr:
+			index := d.fetch()
+			strIndex := d.fetch()
+			d.writeOpf("FieldIntEqualsStr %d %q (%d)", index, d.program.Strs[strIndex], strIndex)
+
+		case PrintField:
+			index := d.fetch()
+			redirect := lexer.Token(d.fetch())
+			if redirect == lexer.ILLEGAL {
+				d.writeOpf("PrintField %d", index)
+			} else {
+				d.writeOpf("PrintField %d %s", index, redirect)
+			}
+
 		default:
 			// Handles all other opcodes with no arguments
 			d.writeOpf("%s", op)
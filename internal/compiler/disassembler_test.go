@@ -26,6 +26,7 @@ func TestDisassembler(t *testing.T) {
 				Nums:            []float64{0},
 				Strs:            []string{""},
 				Regexes:         []*regexp.Regexp{regexp.MustCompile("")},
+				LiteralRegexes:  []LiteralRegex{{Regex: ""}},
 				scalarNames:     []string{"s"},
 				arrayNames:      []string{"a"},
 				nativeFuncNames: []string{"n"},
@@ -0,0 +1,455 @@
+// Constant folding: compile-time evaluation of pure expressions
+
+package compiler
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/benhoyt/goawk/internal/ast"
+	"github.com/benhoyt/goawk/lexer"
+)
+
+// ConvertedStr is a string constant the compiler folded from an expression
+// that converts non-integer numbers to strings, like 0.5 "x". Those
+// conversions use CONVFMT, so they're only folded if the program never
+// assigns CONVFMT, and the interpreter rebuilds the string from its parts
+// if CONVFMT is set another way (for example, with -v CONVFMT=%.2g).
+type ConvertedStr struct {
+	Index int       // index into Program.Strs
+	Parts []StrPart // concatenated to make the string
+}
+
+// StrPart is one part of a ConvertedStr: a string, or a number that's
+// converted to a string using CONVFMT.
+type StrPart struct {
+	Str   string
+	Num   float64
+	IsNum bool
+}
+
+// A constant value computed at compile time. It's a string if isStr is
+// true, otherwise a number.
+type constant struct {
+	isStr bool
+	n     float64
+	s     string
+	parts []StrPart // if not nil, s uses the default CONVFMT (see ConvertedStr)
+}
+
+func numConstant(n float64) constant {
+	return constant{n: n}
+}
+
+func strConstant(s string) constant {
+	return constant{isStr: true, s: s}
+}
+
+func boolConstant(b bool) constant {
+	if b {
+		return constant{n: 1}
+	}
+	return constant{n: 0}
+}
+
+// Report whether the constant is true, following AWK's rules.
+func (v constant) boolean() bool {
+	if v.isStr {
+		return v.s != ""
+	}
+	return v.n != 0
+}
+
+// Convert the constant to a string the way the interpreter does. Integers
+// (and NaN and infinity) don't depend on CONVFMT, but other numbers do, so
+// they can only be converted if the program never assigns CONVFMT.
+func (c *compiler) toStr(v constant) (constant, bool) {
+	if v.isStr {
+		return v, true
+	}
+	switch {
+	case math.IsNaN(v.n):
+		return strConstant("nan"), true
+	case math.IsInf(v.n, 0):
+		if v.n < 0 {
+			return strConstant("-inf"), true
+		}
+		return strConstant("inf"), true
+	case v.n == float64(int(v.n)):
+		return strConstant(strconv.Itoa(int(v.n))), true
+	case c.foldConvfmt:
+		s := strconv.FormatFloat(v.n, 'g', 6, 64) // default CONVFMT of "%.6g"
+		return constant{isStr: true, s: s, parts: []StrPart{{Num: v.n, IsNum: true}}}, true
+	default:
+		return constant{}, false
+	}
+}
+
+// Convert the constant to a string that doesn't depend on CONVFMT (for
+// operations other than concatenation).
+func (c *compiler) toPlainStr(v constant) (string, bool) {
+	v, ok := c.toStr(v)
+	if !ok || v.parts != nil {
+		return "", false
+	}
+	return v.s, true
+}
+
+// Evaluate expr at compile time if it's a constant expression: one that
+// only uses literals and pure operators and builtin functions. Reports
+// false if it's not constant (or if folding is disabled).
+//
+// Strings are only converted to numbers if they're literals used as a
+// boolean, and operations that would be runtime errors (or lint warnings)
+// are left for the interpreter.
+func (c *compiler) fold(expr ast.Expr) (constant, bool) {
+	if !c.optimize {
+		return constant{}, false
+	}
+	switch e := expr.(type) {
+	case *ast.NumExpr:
+		return numConstant(e.Value), true
+
+	case *ast.StrExpr:
+		return strConstant(e.Value), true
+
+	case *ast.GroupingExpr:
+		return c.fold(e.Expr)
+
+	case *ast.UnaryExpr:
+		v, ok := c.fold(e.Value)
+		if !ok {
+			return constant{}, false
+		}
+		switch e.Op {
+		case lexer.NOT:
+			return boolConstant(!v.boolean()), true
+		case lexer.SUB:
+			if v.isStr {
+				return constant{}, false
+			}
+			return numConstant(-v.n), true
+		default: // ADD
+			if v.isStr {
+				return constant{}, false
+			}
+			return v, true
+		}
+
+	case *ast.BinaryExpr:
+		return c.foldBinaryExpr(e)
+
+	case *ast.CondExpr:
+		cond, ok := c.fold(e.Cond)
+		if !ok {
+			return constant{}, false
+		}
+		if cond.boolean() {
+			return c.fold(e.True)
+		}
+		return c.fold(e.False)
+
+	case *ast.CallExpr:
+		return c.foldCall(e)
+	}
+	return constant{}, false
+}
+
+func (c *compiler) foldBinaryExpr(e *ast.BinaryExpr) (constant, bool) {
+	l, ok := c.fold(e.Left)
+	if !ok {
+		return constant{}, false
+	}
+
+	// Short-circuit operators don't evaluate the right side if the
+	// left side determines the result.
+	switch {
+	case e.Op == lexer.AND && !l.boolean():
+		return boolConstant(false), true
+	case e.Op == lexer.OR && l.boolean():
+		return boolConstant(true), true
+	}
+
+	r, ok := c.fold(e.Right)
+	if !ok {
+		return constant{}, false
+	}
+
+	switch e.Op {
+	case lexer.AND, lexer.OR:
+		return boolConstant(r.boolean()), true
+
+	case lexer.CONCAT:
+		ls, ok := c.toStr(l)
+		if !ok {
+			return constant{}, false
+		}
+		rs, ok := c.toStr(r)
+		if !ok {
+			return constant{}, false
+		}
+		v := strConstant(ls.s + rs.s)
+		if ls.parts != nil || rs.parts != nil {
+			v.parts = append(strParts(ls), strParts(rs)...)
+		}
+		return v, true
+
+	case lexer.ADD, lexer.SUB, lexer.MUL, lexer.DIV, lexer.MOD, lexer.POW:
+		if l.isStr || r.isStr {
+			return constant{}, false
+		}
+		var op Opcode
+		switch e.Op {
+		case lexer.ADD:
+			op = Add
+		case lexer.SUB:
+			op = Subtract
+		case lexer.MUL:
+			op = Multiply
+		case lexer.DIV:
+			op = Divide
+		case lexer.MOD:
+			op = Modulo
+		default: // POW
+			op = Power
+		}
+		n, ok := foldBinary(op, l.n, r.n)
+		if !ok {
+			return constant{}, false
+		}
+		return numConstant(n), true
+
+	case lexer.EQUALS, lexer.NOT_EQUALS, lexer.LESS, lexer.LTE, lexer.GREATER, lexer.GTE:
+		// Comparisons of a string with a number are left to the
+		// interpreter, as they're the subject of a lint warning.
+		if l.isStr != r.isStr {
+			return constant{}, false
+		}
+		var cmp int
+		if l.isStr {
+			if l.parts != nil || r.parts != nil {
+				return constant{}, false
+			}
+			cmp = strings.Compare(l.s, r.s)
+		} else {
+			switch {
+			case l.n < r.n:
+				cmp = -1
+			case l.n > r.n:
+				cmp = 1
+			case l.n != r.n:
+				return constant{}, false // NaN isn't ordered
+			}
+		}
+		switch e.Op {
+		case lexer.EQUALS:
+			return boolConstant(cmp == 0), true
+		case lexer.NOT_EQUALS:
+			return boolConstant(cmp != 0), true
+		case lexer.LESS:
+			return boolConstant(cmp < 0), true
+		case lexer.LTE:
+			return boolConstant(cmp <= 0), true
+		case lexer.GREATER:
+			return boolConstant(cmp > 0), true
+		default: // GTE
+			return boolConstant(cmp >= 0), true
+		}
+	}
+
+	// Regex matches aren't folded.
+	return constant{}, false
+}
+
+// Return the parts of a string constant (see ConvertedStr).
+func strParts(v constant) []StrPart {
+	if v.parts != nil {
+		return v.parts
+	}
+	return []StrPart{{Str: v.s}}
+}
+
+// Fold a call to a pure builtin function with constant arguments (using
+// the same logic as the interpreter).
+func (c *compiler) foldCall(e *ast.CallExpr) (constant, bool) {
+	switch e.Func {
+	case lexer.F_LENGTH, lexer.F_SUBSTR, lexer.F_INDEX, lexer.F_TOLOWER, lexer.F_TOUPPER,
+		lexer.F_INT, lexer.F_SQRT, lexer.F_EXP, lexer.F_LOG, lexer.F_SIN, lexer.F_COS, lexer.F_ATAN2:
+	default:
+		return constant{}, false
+	}
+	if len(e.Args) == 0 {
+		return constant{}, false // length() is the length of $0
+	}
+	args := make([]constant, len(e.Args))
+	for i, arg := range e.Args {
+		v, ok := c.fold(arg)
+		if !ok {
+			return constant{}, false
+		}
+		args[i] = v
+	}
+
+	switch e.Func {
+	case lexer.F_LENGTH:
+		s, ok := c.toPlainStr(args[0])
+		if !ok {
+			return constant{}, false
+		}
+		return numConstant(float64(len(s))), true
+
+	case lexer.F_SUBSTR:
+		s, ok := c.toPlainStr(args[0])
+		if !ok || args[1].isStr {
+			return constant{}, false
+		}
+		pos := int(args[1].n)
+		if pos > len(s) {
+			pos = len(s) + 1
+		}
+		if pos < 1 {
+			pos = 1
+		}
+		maxLength := len(s) - pos + 1
+		length := maxLength
+		if len(args) > 2 {
+			if args[2].isStr {
+				return constant{}, false
+			}
+			length = int(args[2].n)
+			if length < 0 {
+				length = 0
+			}
+			if length > maxLength {
+				length = maxLength
+			}
+		}
+		return strConstant(s[pos-1 : pos-1+length]), true
+
+	case lexer.F_INDEX:
+		s, ok := c.toPlainStr(args[0])
+		if !ok {
+			return constant{}, false
+		}
+		substr, ok := c.toPlainStr(args[1])
+		if !ok {
+			return constant{}, false
+		}
+		return numConstant(float64(strings.Index(s, substr) + 1)), true
+
+	case lexer.F_TOLOWER, lexer.F_TOUPPER:
+		s, ok := c.toPlainStr(args[0])
+		if !ok {
+			return constant{}, false
+		}
+		if e.Func == lexer.F_TOLOWER {
+			return strConstant(strings.ToLower(s)), true
+		}
+		return strConstant(strings.ToUpper(s)), true
+	}
+
+	// The rest are numeric functions.
+	for _, arg := range args {
+		if arg.isStr {
+			return constant{}, false
+		}
+	}
+	var n float64
+	switch e.Func {
+	case lexer.F_INT:
+		n = float64(int(args[0].n))
+	case lexer.F_SQRT:
+		n = math.Sqrt(args[0].n)
+	case lexer.F_EXP:
+		n = math.Exp(args[0].n)
+	case lexer.F_LOG:
+		n = math.Log(args[0].n)
+	case lexer.F_SIN:
+		n = math.Sin(args[0].n)
+	case lexer.F_COS:
+		n = math.Cos(args[0].n)
+	default: // F_ATAN2
+		n = math.Atan2(args[0].n, args[1].n)
+	}
+	return numConstant(n), true
+}
+
+// Generate code for a constant, reporting false if it can't be stored as
+// a constant (-0, as -0 == 0 when constants are reused).
+func (c *compiler) constant(v constant) bool {
+	switch {
+	case v.parts != nil:
+		// Don't reuse this string constant, as the interpreter may
+		// change it if CONVFMT changes.
+		index := len(c.program.Strs)
+		c.program.Strs = append(c.program.Strs, v.s)
+		c.program.ConvertedStrs = append(c.program.ConvertedStrs, ConvertedStr{index, v.parts})
+		c.add(Str, opcodeInt(index))
+	case v.isStr:
+		c.add(Str, opcodeInt(c.strIndex(v.s)))
+	case v.n == 0 && math.Signbit(v.n):
+		return false
+	default:
+		c.add(Num, opcodeInt(c.numIndex(v.n)))
+	}
+	return true
+}
+
+// Return expr folded to a NumExpr or StrExpr if it's a constant expression
+// (other than a ConvertedStr), otherwise return expr itself. This is for
+// code that handles literal operands specially, like $1 or a[1].
+func (c *compiler) foldExpr(expr ast.Expr) ast.Expr {
+	v, ok := c.fold(expr)
+	switch {
+	case !ok || v.parts != nil:
+		return expr
+	case v.isStr:
+		return &ast.StrExpr{Value: v.s}
+	case v.n == 0 && math.Signbit(v.n):
+		return expr
+	default:
+		return &ast.NumExpr{Value: v.n}
+	}
+}
+
+// Report whether the program may assign the special variable CONVFMT.
+func assignsConvfmt(prog *ast.Program) bool {
+	v := &assignVisitor{name: "CONVFMT"}
+	ast.Walk(v, prog)
+	return v.assigned
+}
+
+// assignVisitor records whether any code assigns the given variable.
+type assignVisitor struct {
+	name     string
+	assigned bool
+}
+
+func (v *assignVisitor) Visit(node ast.Node) ast.Visitor {
+	switch n := node.(type) {
+	case *ast.AssignExpr:
+		v.check(n.Left)
+	case *ast.AugAssignExpr:
+		v.check(n.Left)
+	case *ast.IncrExpr:
+		v.check(n.Expr)
+	case *ast.GetlineExpr:
+		v.check(n.Target)
+	case *ast.CallExpr:
+		if (n.Func == lexer.F_SUB || n.Func == lexer.F_GSUB) && len(n.Args) == 3 {
+			v.check(n.Args[2])
+		}
+	case *ast.ForInStmt:
+		if n.Var == v.name {
+			v.assigned = true
+		}
+	}
+	return v
+}
+
+func (v *assignVisitor) check(target ast.Expr) {
+	if varExpr, ok := target.(*ast.VarExpr); ok && varExpr.Name == v.name {
+		v.assigned = true
+	}
+}
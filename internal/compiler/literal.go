@@ -0,0 +1,105 @@
+// Detection of regexes that can be matched without the regexp engine
+
+package compiler
+
+import (
+	"regexp/syntax"
+	"strings"
+	"unicode/utf8"
+)
+
+// LiteralRegex is a regex that can be matched using simple string searches
+// instead of the regexp engine: a literal string like /ERROR/, an anchored
+// literal like /^GET / or /\.txt$/, or an alternation of these like
+// /ERROR|WARN/.
+type LiteralRegex struct {
+	Regex string // source regex (for disassembly)
+	alts  []literalAlt
+}
+
+// One alternative of a LiteralRegex: it matches if s is anywhere in the
+// string, or at its start and/or end if it's anchored.
+type literalAlt struct {
+	s     string
+	start bool // anchored with ^
+	end   bool // anchored with $
+}
+
+// MatchString reports whether the string s contains any match of the regex.
+func (r *LiteralRegex) MatchString(s string) bool {
+	for _, alt := range r.alts {
+		var matched bool
+		switch {
+		case alt.start && alt.end:
+			matched = s == alt.s
+		case alt.start:
+			matched = strings.HasPrefix(s, alt.s)
+		case alt.end:
+			matched = strings.HasSuffix(s, alt.s)
+		default:
+			matched = strings.Contains(s, alt.s)
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse regex as a LiteralRegex, reporting false if it's not that simple
+// (or isn't valid).
+func parseLiteralRegex(regex string) (LiteralRegex, bool) {
+	re, err := syntax.Parse(AddRegexFlags(regex), syntax.Perl)
+	if err != nil {
+		return LiteralRegex{}, false
+	}
+	re = re.Simplify()
+	subs := []*syntax.Regexp{re}
+	if re.Op == syntax.OpAlternate {
+		subs = re.Sub
+	}
+	literal := LiteralRegex{Regex: regex}
+	for _, sub := range subs {
+		alt, ok := parseLiteralAlt(sub)
+		if !ok {
+			return LiteralRegex{}, false
+		}
+		literal.alts = append(literal.alts, alt)
+	}
+	return literal, true
+}
+
+// Parse one alternative of a LiteralRegex: a (possibly anchored) literal.
+func parseLiteralAlt(re *syntax.Regexp) (literalAlt, bool) {
+	for re.Op == syntax.OpCapture {
+		re = re.Sub[0]
+	}
+	parts := []*syntax.Regexp{re}
+	if re.Op == syntax.OpConcat {
+		parts = re.Sub
+	}
+	var alt literalAlt
+	if len(parts) > 0 && parts[0].Op == syntax.OpBeginText {
+		alt.start = true
+		parts = parts[1:]
+	}
+	if len(parts) > 0 && parts[len(parts)-1].Op == syntax.OpEndText {
+		alt.end = true
+		parts = parts[:len(parts)-1]
+	}
+	switch {
+	case len(parts) == 0:
+		// Only anchors, like /^/ or /^$/
+	case len(parts) == 1 && parts[0].Op == syntax.OpEmptyMatch:
+		// Empty regex matches any string
+	case len(parts) == 1 && parts[0].Op == syntax.OpLiteral && parts[0].Flags&syntax.FoldCase == 0:
+		alt.s = string(parts[0].Rune)
+		if strings.ContainsRune(alt.s, utf8.RuneError) {
+			// The regexp engine matches invalid UTF-8 bytes with U+FFFD
+			return literalAlt{}, false
+		}
+	default:
+		return literalAlt{}, false
+	}
+	return alt, true
+}
@@ -0,0 +1,60 @@
+package compiler
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestLiteralRegex(t *testing.T) {
+	tests := []struct {
+		regex   string
+		literal bool
+	}{
+		{``, true},
+		{`ERROR`, true},
+		{`^GET `, true},
+		{`\.txt$`, true},
+		{`^foo$`, true},
+		{`^$`, true},
+		{`a\.b\*c`, true},
+		{`ERROR|WARN`, true},
+		{`^GET|^POST|DELETE$`, true},
+		{`(foo)`, true},
+		{`(foo)|bar`, true},
+		{`é`, true},
+		{`a|b`, false}, // simplified to a character class
+		{`ERR|ERROR`, false},
+		{`f.o`, false},
+		{`fo*`, false},
+		{`[a-z]`, false},
+		{`(?i)foo`, false},
+		{`\bfoo`, false},
+		{`a^b`, false},
+		{`�`, false},
+		{`(`, false},
+	}
+	inputs := []string{
+		"", "foo", "ERROR", "an ERROR here", "WARNING!", "GET /", "POST /x",
+		"x DELETE", "DELETE x", "file.txt", "file.txt.gz", "a.b*c", "a.b.c",
+		"bar", "é", "\xff", "FOO",
+	}
+	for _, test := range tests {
+		t.Run(test.regex, func(t *testing.T) {
+			literal, ok := parseLiteralRegex(test.regex)
+			if ok != test.literal {
+				t.Fatalf("expected literal %v, got %v", test.literal, ok)
+			}
+			if !ok {
+				return
+			}
+			re := regexp.MustCompile(AddRegexFlags(test.regex))
+			for _, input := range inputs {
+				expected := re.MatchString(input)
+				matched := literal.MatchString(input)
+				if matched != expected {
+					t.Errorf("MatchString(%q) = %v, expected %v", input, matched, expected)
+				}
+			}
+		})
+	}
+}
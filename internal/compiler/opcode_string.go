@@ -26,85 +26,96 @@ func _() {
 	_ = x[InGlobal-15]
 	_ = x[InLocal-16]
 	_ = x[AssignField-17]
-	_ = x[AssignGlobal-18]
-	_ = x[AssignLocal-19]
-	_ = x[AssignSpecial-20]
-	_ = x[AssignArrayGlobal-21]
-	_ = x[AssignArrayLocal-22]
-	_ = x[Delete-23]
-	_ = x[DeleteAll-24]
-	_ = x[IncrField-25]
-	_ = x[IncrGlobal-26]
-	_ = x[IncrLocal-27]
-	_ = x[IncrSpecial-28]
-	_ = x[IncrArrayGlobal-29]
-	_ = x[IncrArrayLocal-30]
-	_ = x[AugAssignField-31]
-	_ = x[AugAssignGlobal-32]
-	_ = x[AugAssignLocal-33]
-	_ = x[AugAssignSpecial-34]
-	_ = x[AugAssignArrayGlobal-35]
-	_ = x[AugAssignArrayLocal-36]
-	_ = x[Regex-37]
-	_ = x[IndexMulti-38]
-	_ = x[ConcatMulti-39]
-	_ = x[Add-40]
-	_ = x[Subtract-41]
-	_ = x[Multiply-42]
-	_ = x[Divide-43]
-	_ = x[Power-44]
-	_ = x[Modulo-45]
-	_ = x[Equals-46]
-	_ = x[NotEquals-47]
-	_ = x[Less-48]
-	_ = x[Greater-49]
-	_ = x[LessOrEqual-50]
-	_ = x[GreaterOrEqual-51]
-	_ = x[Concat-52]
-	_ = x[Match-53]
-	_ = x[NotMatch-54]
-	_ = x[Not-55]
-	_ = x[UnaryMinus-56]
-	_ = x[UnaryPlus-57]
-	_ = x[Boolean-58]
-	_ = x[Jump-59]
-	_ = x[JumpFalse-60]
-	_ = x[JumpTrue-61]
-	_ = x[JumpEquals-62]
-	_ = x[JumpNotEquals-63]
-	_ = x[JumpLess-64]
-	_ = x[JumpGreater-65]
-	_ = x[JumpLessOrEqual-66]
-	_ = x[JumpGreaterOrEqual-67]
-	_ = x[Next-68]
-	_ = x[Nextfile-69]
-	_ = x[Exit-70]
-	_ = x[ForIn-71]
-	_ = x[BreakForIn-72]
-	_ = x[CallBuiltin-73]
-	_ = x[CallLengthArray-74]
-	_ = x[CallSplit-75]
-	_ = x[CallSplitSep-76]
-	_ = x[CallSprintf-77]
-	_ = x[CallUser-78]
-	_ = x[CallNative-79]
-	_ = x[Return-80]
-	_ = x[ReturnNull-81]
-	_ = x[Nulls-82]
-	_ = x[Print-83]
-	_ = x[Printf-84]
-	_ = x[Getline-85]
-	_ = x[GetlineField-86]
-	_ = x[GetlineGlobal-87]
-	_ = x[GetlineLocal-88]
-	_ = x[GetlineSpecial-89]
-	_ = x[GetlineArray-90]
-	_ = x[EndOpcode-91]
+	_ = x[AssignFieldByName-18]
+	_ = x[AssignGlobal-19]
+	_ = x[AssignLocal-20]
+	_ = x[AssignSpecial-21]
+	_ = x[AssignArrayGlobal-22]
+	_ = x[AssignArrayLocal-23]
+	_ = x[Delete-24]
+	_ = x[DeleteAll-25]
+	_ = x[IncrField-26]
+	_ = x[IncrFieldByName-27]
+	_ = x[IncrGlobal-28]
+	_ = x[IncrLocal-29]
+	_ = x[IncrSpecial-30]
+	_ = x[IncrArrayGlobal-31]
+	_ = x[IncrArrayLocal-32]
+	_ = x[AugAssignField-33]
+	_ = x[AugAssignFieldByName-34]
+	_ = x[AugAssignGlobal-35]
+	_ = x[AugAssignLocal-36]
+	_ = x[AugAssignSpecial-37]
+	_ = x[AugAssignArrayGlobal-38]
+	_ = x[AugAssignArrayLocal-39]
+	_ = x[Regex-40]
+	_ = x[RegexLiteral-41]
+	_ = x[IndexMulti-42]
+	_ = x[ConcatMulti-43]
+	_ = x[Add-44]
+	_ = x[Subtract-45]
+	_ = x[Multiply-46]
+	_ = x[Divide-47]
+	_ = x[Power-48]
+	_ = x[Modulo-49]
+	_ = x[Equals-50]
+	_ = x[NotEquals-51]
+	_ = x[Less-52]
+	_ = x[Greater-53]
+	_ = x[LessOrEqual-54]
+	_ = x[GreaterOrEqual-55]
+	_ = x[Concat-56]
+	_ = x[Match-57]
+	_ = x[NotMatch-58]
+	_ = x[MatchLiteral-59]
+	_ = x[NotMatchLiteral-60]
+	_ = x[Not-61]
+	_ = x[UnaryMinus-62]
+	_ = x[UnaryPlus-63]
+	_ = x[Boolean-64]
+	_ = x[Jump-65]
+	_ = x[JumpFalse-66]
+	_ = x[JumpTrue-67]
+	_ = x[JumpEquals-68]
+	_ = x[JumpNotEquals-69]
+	_ = x[JumpLess-70]
+	_ = x[JumpGreater-71]
+	_ = x[JumpLessOrEqual-72]
+	_ = x[JumpGreaterOrEqual-73]
+	_ = x[Next-74]
+	_ = x[Nextfile-75]
+	_ = x[Exit-76]
+	_ = x[ForIn-77]
+	_ = x[BreakForIn-78]
+	_ = x[CallBuiltin-79]
+	_ = x[CallLengthArray-80]
+	_ = x[CallSplit-81]
+	_ = x[CallSplitSep-82]
+	_ = x[CallPrintrow-83]
+	_ = x[CallSprintf-84]
+	_ = x[CallUser-85]
+	_ = x[CallNative-86]
+	_ = x[Return-87]
+	_ = x[ReturnNull-88]
+	_ = x[Nulls-89]
+	_ = x[Print-90]
+	_ = x[Printf-91]
+	_ = x[Getline-92]
+	_ = x[GetlineField-93]
+	_ = x[GetlineFieldByName-94]
+	_ = x[GetlineGlobal-95]
+	_ = x[GetlineLocal-96]
+	_ = x[GetlineSpecial-97]
+	_ = x[GetlineArray-98]
+	_ = x[FieldIntEqualsNum-99]
+	_ = x[FieldIntEqualsStr-100]
+	_ = x[PrintField-101]
+	_ = x[EndOpcode-102]
 }
 
-const _Opcode_name = "NopNumStrDupeDropSwapFieldFieldIntFieldByNameFieldByNameStrGlobalLocalSpecialArrayGlobalArrayLocalInGlobalInLocalAssignFieldAssignGlobalAssignLocalAssignSpecialAssignArrayGlobalAssignArrayLocalDeleteDeleteAllIncrFieldIncrGlobalIncrLocalIncrSpecialIncrArrayGlobalIncrArrayLocalAugAssignFieldAugAssignGlobalAugAssignLocalAugAssignSpecialAugAssignArrayGlobalAugAssignArrayLocalRegexIndexMultiConcatMultiAddSubtractMultiplyDividePowerModuloEqualsNotEqualsLessGreaterLessOrEqualGreaterOrEqualConcatMatchNotMatchNotUnaryMinusUnaryPlusBooleanJumpJumpFalseJumpTrueJumpEqualsJumpNotEqualsJumpLessJumpGreaterJumpLessOrEqualJumpGreaterOrEqualNextNextfileExitForInBreakForInCallBuiltinCallLengthArrayCallSplitCallSplitSepCallSprintfCallUserCallNativeReturnReturnNullNullsPrintPrintfGetlineGetlineFieldGetlineGlobalGetlineLocalGetlineSpecialGetlineArrayEndOpcode"
+const _Opcode_name = "NopNumStrDupeDropSwapFieldFieldIntFieldByNameFieldByNameStrGlobalLocalSpecialArrayGlobalArrayLocalInGlobalInLocalAssignFieldAssignFieldByNameAssignGlobalAssignLocalAssignSpecialAssignArrayGlobalAssignArrayLocalDeleteDeleteAllIncrFieldIncrFieldByNameIncrGlobalIncrLocalIncrSpecialIncrArrayGlobalIncrArrayLocalAugAssignFieldAugAssignFieldByNameAugAssignGlobalAugAssignLocalAugAssignSpecialAugAssignArrayGlobalAugAssignArrayLocalRegexRegexLiteralIndexMultiConcatMultiAddSubtractMultiplyDividePowerModuloEqualsNotEqualsLessGreaterLessOrEqualGreaterOrEqualConcatMatchNotMatchMatchLiteralNotMatchLiteralNotUnaryMinusUnaryPlusBooleanJumpJumpFalseJumpTrueJumpEqualsJumpNotEqualsJumpLessJumpGreaterJumpLessOrEqualJumpGreaterOrEqualNextNextfileExitForInBreakForInCallBuiltinCallLengthArrayCallSplitCallSplitSepCallPrintrowCallSprintfCallUserCallNativeReturnReturnNullNullsPrintPrintfGetlineGetlineFieldGetlineFieldByNameGetlineGlobalGetlineLocalGetlineSpecialGetlineArrayFieldIntEqualsNumFieldIntEqualsStrPrintFieldEndOpcode"
 
-var _Opcode_index = [...]uint16{0, 3, 6, 9, 13, 17, 21, 26, 34, 45, 59, 65, 70, 77, 88, 98, 106, 113, 124, 136, 147, 160, 177, 193, 199, 208, 217, 227, 236, 247, 262, 276, 290, 305, 319, 335, 355, 374, 379, 389, 400, 403, 411, 419, 425, 430, 436, 442, 451, 455, 462, 473, 487, 493, 498, 506, 509, 519, 528, 535, 539, 548, 556, 566, 579, 587, 598, 613, 631, 635, 643, 647, 652, 662, 673, 688, 697, 709, 720, 728, 738, 744, 754, 759, 764, 770, 777, 789, 802, 814, 828, 840, 849}
+var _Opcode_index = [...]uint16{0, 3, 6, 9, 13, 17, 21, 26, 34, 45, 59, 65, 70, 77, 88, 98, 106, 113, 124, 141, 153, 164, 177, 194, 210, 216, 225, 234, 249, 259, 268, 279, 294, 308, 322, 342, 357, 371, 387, 407, 426, 431, 443, 453, 464, 467, 475, 483, 489, 494, 500, 506, 515, 519, 526, 537, 551, 557, 562, 570, 582, 597, 600, 610, 619, 626, 630, 639, 647, 657, 670, 678, 689, 704, 722, 726, 734, 738, 743, 753, 764, 779, 788, 800, 812, 823, 831, 841, 847, 857, 862, 867, 873, 880, 892, 910, 923, 935, 949, 961, 978, 995, 1005, 1014}
 
 func (i Opcode) String() string {
 	if i < 0 || i >= Opcode(len(_Opcode_index)-1) {
@@ -140,33 +151,34 @@ func _() {
 	var x [1]struct{}
 	_ = x[BuiltinAtan2-0]
 	_ = x[BuiltinClose-1]
-	_ = x[BuiltinCos-2]
-	_ = x[BuiltinExp-3]
-	_ = x[BuiltinFflush-4]
-	_ = x[BuiltinFflushAll-5]
-	_ = x[BuiltinGsub-6]
-	_ = x[BuiltinIndex-7]
-	_ = x[BuiltinInt-8]
-	_ = x[BuiltinLength-9]
-	_ = x[BuiltinLengthArg-10]
-	_ = x[BuiltinLog-11]
-	_ = x[BuiltinMatch-12]
-	_ = x[BuiltinRand-13]
-	_ = x[BuiltinSin-14]
-	_ = x[BuiltinSqrt-15]
-	_ = x[BuiltinSrand-16]
-	_ = x[BuiltinSrandSeed-17]
-	_ = x[BuiltinSub-18]
-	_ = x[BuiltinSubstr-19]
-	_ = x[BuiltinSubstrLength-20]
-	_ = x[BuiltinSystem-21]
-	_ = x[BuiltinTolower-22]
-	_ = x[BuiltinToupper-23]
+	_ = x[BuiltinCloseHow-2]
+	_ = x[BuiltinCos-3]
+	_ = x[BuiltinExp-4]
+	_ = x[BuiltinFflush-5]
+	_ = x[BuiltinFflushAll-6]
+	_ = x[BuiltinGsub-7]
+	_ = x[BuiltinIndex-8]
+	_ = x[BuiltinInt-9]
+	_ = x[BuiltinLength-10]
+	_ = x[BuiltinLengthArg-11]
+	_ = x[BuiltinLog-12]
+	_ = x[BuiltinMatch-13]
+	_ = x[BuiltinRand-14]
+	_ = x[BuiltinSin-15]
+	_ = x[BuiltinSqrt-16]
+	_ = x[BuiltinSrand-17]
+	_ = x[BuiltinSrandSeed-18]
+	_ = x[BuiltinSub-19]
+	_ = x[BuiltinSubstr-20]
+	_ = x[BuiltinSubstrLength-21]
+	_ = x[BuiltinSystem-22]
+	_ = x[BuiltinTolower-23]
+	_ = x[BuiltinToupper-24]
 }
 
-const _BuiltinOp_name = "BuiltinAtan2BuiltinCloseBuiltinCosBuiltinExpBuiltinFflushBuiltinFflushAllBuiltinGsubBuiltinIndexBuiltinIntBuiltinLengthBuiltinLengthArgBuiltinLogBuiltinMatchBuiltinRandBuiltinSinBuiltinSqrtBuiltinSrandBuiltinSrandSeedBuiltinSubBuiltinSubstrBuiltinSubstrLengthBuiltinSystemBuiltinTolowerBuiltinToupper"
+const _BuiltinOp_name = "BuiltinAtan2BuiltinCloseBuiltinCloseHowBuiltinCosBuiltinExpBuiltinFflushBuiltinFflushAllBuiltinGsubBuiltinIndexBuiltinIntBuiltinLengthBuiltinLengthArgBuiltinLogBuiltinMatchBuiltinRandBuiltinSinBuiltinSqrtBuiltinSrandBuiltinSrandSeedBuiltinSubBuiltinSubstrBuiltinSubstrLengthBuiltinSystemBuiltinTolowerBuiltinToupper"
 
-var _BuiltinOp_index = [...]uint16{0, 12, 24, 34, 44, 57, 73, 84, 96, 106, 119, 135, 145, 157, 168, 178, 189, 201, 217, 227, 240, 259, 272, 286, 300}
+var _BuiltinOp_index = [...]uint16{0, 12, 24, 39, 49, 59, 72, 88, 99, 111, 121, 134, 150, 160, 172, 183, 193, 204, 216, 232, 242, 255, 274, 287, 301, 315}
 
 func (i BuiltinOp) String() string {
 	if i < 0 || i >= BuiltinOp(len(_BuiltinOp_index)-1) {
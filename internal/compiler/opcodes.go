@@ -38,6 +38,7 @@ const (
 
 	// Assign a field, variable, or array item
 	AssignField
+	AssignFieldByName
 	AssignGlobal      // index
 	AssignLocal       // index
 	AssignSpecial     // index
@@ -50,6 +51,7 @@ const (
 
 	// Post-increment and post-decrement
 	IncrField       // amount
+	IncrFieldByName // amount
 	IncrGlobal      // amount index
 	IncrLocal       // amount index
 	IncrSpecial     // amount index
@@ -58,6 +60,7 @@ const (
 
 	// Augmented assignment (also used for pre-increment and pre-decrement)
 	AugAssignField       // augOp
+	AugAssignFieldByName // augOp
 	AugAssignGlobal      // augOp index
 	AugAssignLocal       // augOp index
 	AugAssignSpecial     // augOp index
@@ -65,7 +68,8 @@ const (
 	AugAssignArrayLocal  // augOp arrayIndex
 
 	// Stand-alone regex expression /foo/
-	Regex // regexIndex
+	Regex        // regexIndex
+	RegexLiteral // literalIndex
 
 	// Multi-index concatenation
 	IndexMulti // num
@@ -90,6 +94,10 @@ const (
 	Match
 	NotMatch
 
+	// Match against a regex constant that's a LiteralRegex ($1 ~ /foo/)
+	MatchLiteral    // literalIndex
+	NotMatchLiteral // literalIndex
+
 	// Unary operators
 	Not
 	UnaryMinus
@@ -117,6 +125,7 @@ const (
 	CallLengthArray // arrayScope arrayIndex
 	CallSplit       // arrayScope arrayIndex
 	CallSplitSep    // arrayScope arrayIndex
+	CallPrintrow    // arrayScope arrayIndex fieldsScope fieldsIndex
 	CallSprintf     // numArgs
 
 	// User and native functions
@@ -127,14 +136,20 @@ const (
 	Nulls // numNulls
 
 	// Print, printf, and getline
-	Print          // numArgs redirect
-	Printf         // numArgs redirect
-	Getline        // redirect
-	GetlineField   // redirect
-	GetlineGlobal  // redirect index
-	GetlineLocal   // redirect index
-	GetlineSpecial // redirect index
-	GetlineArray   // redirect arrayScope arrayIndex
+	Print              // numArgs redirect
+	Printf             // numArgs redirect
+	Getline            // redirect
+	GetlineField       // redirect
+	GetlineFieldByName // redirect
+	GetlineGlobal      // redirect index
+	GetlineLocal       // redirect index
+	GetlineSpecial     // redirect index
+	GetlineArray       // redirect arrayScope arrayIndex
+
+	// Superinstructions generated by the optimizer (see optimize.go)
+	FieldIntEqualsNum // index numIndex
+	FieldIntEqualsStr // index strIndex
+	PrintField        // index redirect
 
 	EndOpcode
 )
@@ -157,6 +172,7 @@ type BuiltinOp Opcode
 const (
 	BuiltinAtan2 BuiltinOp = iota
 	BuiltinClose
+	BuiltinCloseHow
 	BuiltinCos
 	BuiltinExp
 	BuiltinFflush
@@ -0,0 +1,434 @@
+// Peephole optimizer for compiled code
+
+package compiler
+
+import (
+	"math"
+	"sort"
+)
+
+// An instruction decoded for the optimizer.
+type instr struct {
+	op     Opcode
+	args   []Opcode // arguments, not including a jump offset
+	target int      // for jumps, index of the target instruction; for ForIn, index of the end of the loop body
+	addr   int      // address in the unoptimized code (for positions)
+	label  bool     // true if a jump or the end of a for-in loop body targets this instruction
+}
+
+// Optimize the code compiled for this block with a few simple peephole
+// optimizations: folding of numeric constants and constant conditions,
+// fusing common sequences into superinstructions, jump threading, and
+// removal of dead code. Positions are updated to match.
+//
+// Jump offsets are relative, and the interpreter executes the body of a
+// for-in loop as a separate slice of code, so the optimizer never moves a
+// jump target into or out of a for-in loop body.
+func (c *compiler) optimizeCode() {
+	instrs := decode(c.code)
+	for changed := true; changed; {
+		changed = false
+		var rewritten bool
+		instrs, rewritten = c.peephole(instrs)
+		threaded := threadJumps(instrs)
+		var removed bool
+		instrs, removed = removeDeadCode(instrs)
+		changed = rewritten || threaded || removed
+	}
+	c.code, c.positions = encode(instrs, c.positions)
+}
+
+// Decode code into a list of instructions with jump targets resolved to
+// instruction indexes.
+func decode(code []Opcode) []instr {
+	var instrs []instr
+	indexes := make(map[int]int) // map of address to instruction index
+	var offsets []int            // jump offset (or -1) of each instruction
+	for ip := 0; ip < len(code); {
+		op := code[ip]
+		n := numArgs(code, ip)
+		in := instr{op: op, addr: ip}
+		offset := -1
+		if hasOffset(op) {
+			in.args = code[ip+1 : ip+n]
+			offset = ip + n + 1 + int(code[ip+n])
+		} else {
+			in.args = code[ip+1 : ip+1+n]
+		}
+		indexes[ip] = len(instrs)
+		instrs = append(instrs, in)
+		offsets = append(offsets, offset)
+		ip += 1 + n
+	}
+	indexes[len(code)] = len(instrs)
+	for i, offset := range offsets {
+		if offset >= 0 {
+			instrs[i].target = indexes[offset]
+		}
+	}
+	return instrs
+}
+
+// Encode instructions back into code, and build the new position table
+// from the original one.
+func encode(instrs []instr, positions []position) ([]Opcode, []position) {
+	addrs := make([]int, len(instrs)+1)
+	addr := 0
+	for i, in := range instrs {
+		addrs[i] = addr
+		addr += 1 + len(in.args)
+		if hasOffset(in.op) {
+			addr++
+		}
+	}
+	addrs[len(instrs)] = addr
+
+	code := make([]Opcode, 0, addr)
+	var newPositions []position
+	for i, in := range instrs {
+		pos := lookupPosition(positions, in.addr)
+		if pos != nil {
+			n := len(newPositions)
+			if n == 0 || newPositions[n-1].pos != pos.pos {
+				newPositions = append(newPositions, position{addrs[i], pos.pos})
+			}
+		}
+		code = append(code, in.op)
+		code = append(code, in.args...)
+		if hasOffset(in.op) {
+			code = append(code, opcodeInt(addrs[in.target]-addrs[i+1]))
+		}
+	}
+	return code, newPositions
+}
+
+// Return the position table entry for the instruction at addr, or nil if
+// there isn't one.
+func lookupPosition(positions []position, addr int) *position {
+	j := sort.Search(len(positions), func(j int) bool {
+		return positions[j].addr > addr
+	})
+	if j == 0 {
+		return nil
+	}
+	return &positions[j-1]
+}
+
+// Mark the instructions that are jump targets or the end of a for-in loop
+// body (these must stay at the start of any sequence that's rewritten).
+func markLabels(instrs []instr) {
+	for i := range instrs {
+		instrs[i].label = false
+	}
+	for _, in := range instrs {
+		if hasOffset(in.op) && in.target < len(instrs) {
+			instrs[in.target].label = true
+		}
+	}
+}
+
+// Run the peephole rewrite rules over instrs, returning the rewritten
+// instructions and whether anything changed. Instructions are appended to
+// the output one at a time, and the rules are applied to the end of the
+// output after each one, so a rewrite can enable another (for example,
+// folding nested constant expressions like 2*3+1).
+func (c *compiler) peephole(instrs []instr) ([]instr, bool) {
+	markLabels(instrs)
+	out := make([]instr, 0, len(instrs))
+	indexes := make([]int, len(instrs)+1) // map of old index to new index
+	changed := false
+	for i, in := range instrs {
+		indexes[i] = len(out)
+		out = append(out, in)
+		for {
+			var rewritten bool
+			out, rewritten = c.rewrite(out)
+			if !rewritten {
+				break
+			}
+			changed = true
+		}
+	}
+	indexes[len(instrs)] = len(out)
+	for i := range out {
+		if hasOffset(out[i].op) {
+			out[i].target = indexes[out[i].target]
+		}
+	}
+	return out, changed
+}
+
+// Apply the first rewrite rule that matches the end of out. Only the first
+// instruction of a matched sequence may be a label, as jumps to the
+// others would be invalid after rewriting.
+func (c *compiler) rewrite(out []instr) ([]instr, bool) {
+	n := len(out)
+	if n >= 2 && !out[n-1].label {
+		a, b := out[n-2], out[n-1]
+		switch {
+		case a.op == Num && (b.op == UnaryMinus || b.op == UnaryPlus):
+			// Fold unary minus or plus of a constant
+			x := c.program.Nums[a.args[0]]
+			if b.op == UnaryMinus {
+				x = -x
+			}
+			if x == 0 && math.Signbit(x) {
+				return out, false // -0 can't be stored as a constant (-0 == 0)
+			}
+			out[n-2] = c.numInstr(a, x)
+			return out[:n-1], true
+
+		case a.op == Num && (b.op == JumpTrue || b.op == JumpFalse):
+			// Fold a constant condition, such as in "while (1)", to an
+			// unconditional jump or no jump at all.
+			if (c.program.Nums[a.args[0]] != 0) == (b.op == JumpTrue) {
+				out[n-2] = instr{op: Jump, target: b.target, addr: a.addr, label: a.label}
+				return out[:n-1], true
+			}
+			return out[:n-2], true
+
+		case a.op == FieldInt && b.op == Print && b.args[0] == 1:
+			// Fuse "print $n" into a single instruction
+			out[n-2] = instr{op: PrintField, args: []Opcode{a.args[0], b.args[1]}, addr: a.addr, label: a.label}
+			return out[:n-1], true
+		}
+	}
+
+	if n >= 3 && !out[n-2].label && !out[n-1].label {
+		a, b, op := out[n-3], out[n-2], out[n-1].op
+		switch {
+		case a.op == Num && b.op == Num:
+			// Fold a binary operation on two numeric constants
+			x, ok := foldBinary(op, c.program.Nums[a.args[0]], c.program.Nums[b.args[0]])
+			if ok {
+				out[n-3] = c.numInstr(a, x)
+				return out[:n-2], true
+			}
+
+		case a.op == FieldInt && b.op == Num && op == Equals:
+			// Fuse "$n == number" into a single instruction
+			out[n-3] = instr{op: FieldIntEqualsNum, args: []Opcode{a.args[0], b.args[0]}, addr: a.addr, label: a.label}
+			return out[:n-2], true
+
+		case a.op == FieldInt && b.op == Str && op == Equals:
+			// Fuse "$n == string" into a single instruction
+			out[n-3] = instr{op: FieldIntEqualsStr, args: []Opcode{a.args[0], b.args[0]}, addr: a.addr, label: a.label}
+			return out[:n-2], true
+		}
+	}
+
+	if n >= 4 && !out[n-3].label && !out[n-2].label && !out[n-1].label {
+		// Fuse "x = x op y" (where y is a constant or variable) into
+		// "x op= y", for example "Global x; Num 1; Add; AssignGlobal x"
+		// into "Num 1; AugAssignGlobal add x".
+		a, b, op, assign := out[n-4], out[n-3], out[n-2].op, out[n-1]
+		augOp, isAugOp := augOps[op]
+		isOperand := b.op == Num || b.op == Global || b.op == Local
+		if isAugOp && isOperand {
+			var augAssignOp Opcode
+			switch {
+			case a.op == Global && assign.op == AssignGlobal && a.args[0] == assign.args[0]:
+				augAssignOp = AugAssignGlobal
+			case a.op == Local && assign.op == AssignLocal && a.args[0] == assign.args[0]:
+				augAssignOp = AugAssignLocal
+			}
+			if augAssignOp != Nop {
+				b.addr, b.label = a.addr, a.label
+				out[n-4] = b
+				out[n-3] = instr{op: augAssignOp, args: []Opcode{Opcode(augOp), a.args[0]}, addr: a.addr}
+				return out[:n-2], true
+			}
+		}
+	}
+
+	return out, false
+}
+
+// Binary operators that can be fused with an assignment into augmented
+// assignment. Power isn't included, as only the Power instruction
+// reports lint warnings.
+var augOps = map[Opcode]AugOp{
+	Add:      AugOpAdd,
+	Subtract: AugOpSub,
+	Multiply: AugOpMul,
+	Divide:   AugOpDiv,
+	Modulo:   AugOpMod,
+}
+
+// Return a Num instruction for the constant x that replaces the
+// instruction in (which starts the sequence being rewritten).
+func (c *compiler) numInstr(in instr, x float64) instr {
+	return instr{op: Num, args: []Opcode{opcodeInt(c.numIndex(x))}, addr: in.addr, label: in.label}
+}
+
+// Evaluate the binary operator op on two constants, reporting false if it
+// can't be folded (division by zero is left as a runtime error).
+func foldBinary(op Opcode, l, r float64) (float64, bool) {
+	var x float64
+	switch op {
+	case Add:
+		x = l + r
+	case Subtract:
+		x = l - r
+	case Multiply:
+		x = l * r
+	case Divide:
+		if r == 0 {
+			return 0, false
+		}
+		x = l / r
+	case Modulo:
+		if r == 0 {
+			return 0, false
+		}
+		x = math.Mod(l, r)
+	case Power:
+		if l == 0 && r < 0 {
+			return 0, false // leave it to the interpreter's lint warning
+		}
+		x = math.Pow(l, r)
+	default:
+		return 0, false
+	}
+	if x == 0 && math.Signbit(x) {
+		return 0, false // -0 can't be stored as a constant (-0 == 0)
+	}
+	return x, true
+}
+
+// Change jumps whose target is an unconditional jump to go straight to
+// that jump's target, invert conditional jumps over an unconditional jump,
+// and remove jumps to the next instruction. Reports whether anything
+// changed.
+func threadJumps(instrs []instr) bool {
+	markLabels(instrs)
+
+	// Find the innermost for-in loop body that each instruction is in.
+	regions := make([]int, len(instrs))
+	var loops []int
+	for i, in := range instrs {
+		for len(loops) > 0 && instrs[loops[len(loops)-1]].target <= i {
+			loops = loops[:len(loops)-1]
+		}
+		regions[i] = -1
+		if len(loops) > 0 {
+			regions[i] = loops[len(loops)-1]
+		}
+		if in.op == ForIn {
+			loops = append(loops, i)
+		}
+	}
+
+	changed := false
+	for i := range instrs {
+		if !isJump(instrs[i].op) {
+			continue
+		}
+		// Limit the number of hops in case of a loop like "Jump 0000".
+		for hops := 0; hops < len(instrs); hops++ {
+			t := instrs[i].target
+			if t >= len(instrs) || instrs[t].op != Jump || regions[t] != regions[i] || instrs[t].target == t {
+				break
+			}
+			instrs[i].target = instrs[t].target
+			changed = true
+		}
+		inverse, ok := inverseJumps[instrs[i].op]
+		if ok && instrs[i].target == i+2 && instrs[i+1].op == Jump && !instrs[i+1].label {
+			// "JumpFalse L; Jump M; L:" is the same as "JumpTrue M; L:"
+			instrs[i].op = inverse
+			instrs[i].target = instrs[i+1].target
+			instrs[i+1].op = Nop
+			changed = true
+		}
+		if instrs[i].op == Jump && instrs[i].target == i+1 {
+			instrs[i].op = Nop
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Conditional jumps and their inverses. Jumps like JumpLess aren't
+// included, as "not less than" isn't the same as "greater or equal" for NaN.
+var inverseJumps = map[Opcode]Opcode{
+	JumpFalse:     JumpTrue,
+	JumpTrue:      JumpFalse,
+	JumpEquals:    JumpNotEquals,
+	JumpNotEquals: JumpEquals,
+}
+
+// Remove instructions that can't be reached because they follow an
+// unconditional jump, exit, next, or return and aren't jump targets. Nops
+// left by threadJumps are removed too.
+func removeDeadCode(instrs []instr) ([]instr, bool) {
+	markLabels(instrs)
+	out := make([]instr, 0, len(instrs))
+	indexes := make([]int, len(instrs)+1)
+	dead := false
+	for i, in := range instrs {
+		indexes[i] = len(out)
+		if in.label || in.op == ForIn {
+			// Stop at a for-in loop even if it's unreachable, to avoid
+			// leaving the rest of its body outside the loop.
+			dead = false
+		}
+		if dead || in.op == Nop {
+			continue
+		}
+		out = append(out, in)
+		switch in.op {
+		case Jump, Exit, Next, Nextfile, Return, ReturnNull, BreakForIn:
+			dead = true
+		}
+	}
+	indexes[len(instrs)] = len(out)
+	for i := range out {
+		if hasOffset(out[i].op) {
+			out[i].target = indexes[out[i].target]
+		}
+	}
+	return out, len(out) < len(instrs)
+}
+
+// Report whether op is a jump instruction.
+func isJump(op Opcode) bool {
+	return op >= Jump && op <= JumpGreaterOrEqual
+}
+
+// Report whether op's last argument is a jump offset (jumps and ForIn).
+func hasOffset(op Opcode) bool {
+	return isJump(op) || op == ForIn
+}
+
+// Return the number of arguments of the instruction at code[ip].
+func numArgs(code []Opcode, ip int) int {
+	switch code[ip] {
+	case Num, Str, FieldInt, FieldByNameStr, Global, Local, Special,
+		ArrayGlobal, ArrayLocal, InGlobal, InLocal,
+		AssignGlobal, AssignLocal, AssignSpecial, AssignArrayGlobal, AssignArrayLocal,
+		IncrField, IncrFieldByName, AugAssignField, AugAssignFieldByName,
+		Regex, RegexLiteral, IndexMulti, ConcatMulti, MatchLiteral, NotMatchLiteral,
+		Jump, JumpFalse, JumpTrue, JumpEquals, JumpNotEquals,
+		JumpLess, JumpGreater, JumpLessOrEqual, JumpGreaterOrEqual,
+		CallBuiltin, CallSprintf, Nulls, Getline, GetlineField, GetlineFieldByName:
+		return 1
+	case Delete, DeleteAll,
+		IncrGlobal, IncrLocal, IncrSpecial, IncrArrayGlobal, IncrArrayLocal,
+		AugAssignGlobal, AugAssignLocal, AugAssignSpecial, AugAssignArrayGlobal, AugAssignArrayLocal,
+		FieldIntEqualsNum, FieldIntEqualsStr,
+		CallLengthArray, CallSplit, CallSplitSep, CallNative,
+		Print, Printf, PrintField, GetlineGlobal, GetlineLocal, GetlineSpecial:
+		return 2
+	case GetlineArray:
+		return 3
+	case CallPrintrow:
+		return 4
+	case ForIn:
+		return 5
+	case CallUser:
+		return 2 + 2*int(code[ip+2])
+	default:
+		return 0
+	}
+}
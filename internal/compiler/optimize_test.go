@@ -0,0 +1,53 @@
+package compiler
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestNumArgs(t *testing.T) {
+	// Check numArgs against the disassembler, which fetches each opcode's
+	// arguments itself: an instruction with numArgs zero arguments should
+	// disassemble to exactly one line.
+	for op := Nop; op < EndOpcode; op++ {
+		t.Run(op.String(), func(t *testing.T) {
+			code := []Opcode{op, 0, 0, 0, 0, 0, 0, 0}
+			code = code[:1+numArgs(code, 0)]
+			p := Program{
+				Begin: code,
+				Functions: []Function{
+					{
+						Name:       "f",
+						Params:     []string{"a", "k"},
+						Arrays:     []bool{true, false},
+						NumScalars: 1,
+						NumArrays:  1,
+					},
+				},
+				Nums:            []float64{0},
+				Strs:            []string{""},
+				Regexes:         []*regexp.Regexp{regexp.MustCompile("")},
+				LiteralRegexes:  []LiteralRegex{{Regex: ""}},
+				scalarNames:     []string{"s"},
+				arrayNames:      []string{"a"},
+				nativeFuncNames: []string{"n"},
+			}
+			var buf bytes.Buffer
+			err := p.Disassemble(&buf)
+			if err != nil {
+				t.Fatalf("error disassembling: %v", err)
+			}
+			numInstrs := 0
+			for _, line := range strings.Split(buf.String(), "\n") {
+				if line != "" && !strings.HasPrefix(strings.TrimSpace(line), "//") {
+					numInstrs++
+				}
+			}
+			if numInstrs != 1 {
+				t.Fatalf("expected one instruction, got:\n%s", buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Branch coverage (ModeBranch): counting true and false outcomes of conditions
+
+package cover
+
+import (
+	"github.com/benhoyt/goawk/internal/ast"
+	"github.com/benhoyt/goawk/lexer"
+)
+
+// Kinds of branch, as written to the coverage profile.
+const (
+	branchIf      = "if"
+	branchWhile   = "while"
+	branchFor     = "for"
+	branchDo      = "do"
+	branchPattern = "pattern"
+	branchRange   = "range"
+	branchTernary = "ternary"
+)
+
+type branch struct {
+	start lexer.Position
+	end   lexer.Position
+	path  string
+	kind  string
+}
+
+// annotateBranches wraps each condition in the program (in if, while, for
+// and do-while statements, patterns, and ternary expressions) so that it
+// counts how many times it was true and how many times it was false.
+func (cover *Cover) annotateBranches(prog *ast.Program) {
+	v := &branchVisitor{cover: cover, wrappers: make(map[*ast.CondExpr]bool)}
+	for _, stmts := range prog.Begin {
+		ast.WalkStmtList(v, stmts)
+	}
+	for _, stmts := range prog.BeginFile {
+		ast.WalkStmtList(v, stmts)
+	}
+	for _, action := range prog.Actions {
+		kind := branchPattern
+		if len(action.Pattern) == 2 {
+			kind = branchRange
+		}
+		for i, pattern := range action.Pattern {
+			ast.Walk(v, pattern)
+			action.Pattern[i] = v.track(pattern, kind, action.PatternPos[i], action.PatternEnd[i])
+		}
+		ast.WalkStmtList(v, action.Stmts)
+	}
+	for _, stmts := range prog.EndFile {
+		ast.WalkStmtList(v, stmts)
+	}
+	for _, stmts := range prog.End {
+		ast.WalkStmtList(v, stmts)
+	}
+	for _, function := range prog.Functions {
+		ast.WalkStmtList(v, function.Body)
+	}
+}
+
+type branchVisitor struct {
+	cover    *Cover
+	wrappers map[*ast.CondExpr]bool // conditions added by track
+}
+
+func (v *branchVisitor) Visit(node ast.Node) ast.Visitor {
+	switch n := node.(type) {
+	case *ast.IfStmt:
+		n.Cond = v.track(n.Cond, branchIf, n.Start, n.BodyStart)
+	case *ast.WhileStmt:
+		n.Cond = v.track(n.Cond, branchWhile, n.Start, n.BodyStart)
+	case *ast.ForStmt:
+		if n.Cond != nil {
+			n.Cond = v.track(n.Cond, branchFor, n.Start, n.BodyStart)
+		}
+	case *ast.DoWhileStmt:
+		n.Cond = v.track(n.Cond, branchDo, n.WhilePos, n.End)
+	case *ast.CondExpr:
+		if !v.wrappers[n] {
+			n.Cond = v.track(n.Cond, branchTernary, n.CondPos, n.CondEnd)
+		}
+	}
+	return v
+}
+
+// Record a branch and return the condition wrapped in an expression that
+// counts its outcome, keeping its truth value:
+//
+//	cond ? ++__COVER_BRANCH[2*i-1] : !++__COVER_BRANCH[2*i]
+func (v *branchVisitor) track(cond ast.Expr, kind string, start, end lexer.Position) ast.Expr {
+	cover := v.cover
+	path, startLine := cover.fileReader.FileLine(start.Line)
+	_, endLine := cover.fileReader.FileLine(end.Line)
+	cover.branches = append(cover.branches, branch{
+		start: lexer.Position{Line: startLine, Column: start.Column},
+		end:   lexer.Position{Line: endLine, Column: end.Column},
+		path:  path,
+		kind:  kind,
+	})
+	i := len(cover.branches)
+	counter := func(index int) ast.Expr {
+		return &ast.IncrExpr{
+			Expr: &ast.IndexExpr{
+				Array: BranchArrayName,
+				Index: []ast.Expr{&ast.NumExpr{Value: float64(index)}},
+			},
+			Op:  lexer.INCR,
+			Pre: true,
+		}
+	}
+	wrapper := &ast.CondExpr{
+		Cond:  cond,
+		True:  counter(2*i - 1),
+		False: &ast.UnaryExpr{Op: lexer.NOT, Value: counter(2 * i)},
+	}
+	v.wrappers[wrapper] = true
+	return wrapper
+}
@@ -14,12 +14,18 @@ import (
 
 const ArrayName = "__COVER"
 
+// BranchArrayName is the name of the array that holds branch counters in
+// ModeBranch: the counts for the true and false outcomes of branch i (from
+// 1) are at indexes 2*i-1 and 2*i respectively.
+const BranchArrayName = "__COVER_BRANCH"
+
 type Mode int
 
 const (
 	ModeUnspecified Mode = iota
 	ModeSet
 	ModeCount
+	ModeBranch
 )
 
 func (m Mode) String() string {
@@ -28,6 +34,8 @@ func (m Mode) String() string {
 		return "set"
 	case ModeCount:
 		return "count"
+	case ModeBranch:
+		return "branch"
 	default:
 		return fmt.Sprintf("<unknown mode %d>", m)
 	}
@@ -38,6 +46,7 @@ type Cover struct {
 	append        bool
 	fileReader    *parseutil.FileReader
 	trackedBlocks []trackedBlock
+	branches      []branch
 }
 
 type trackedBlock struct {
@@ -58,22 +67,36 @@ func New(mode Mode, append bool, fileReader *parseutil.FileReader) *Cover {
 // Annotate annotates the program with coverage tracking code.
 func (cover *Cover) Annotate(prog *ast.Program) {
 	prog.Begin = cover.annotateStmtsList(prog.Begin)
+	prog.BeginFile = cover.annotateStmtsList(prog.BeginFile)
 	prog.Actions = cover.annotateActions(prog.Actions)
+	prog.EndFile = cover.annotateStmtsList(prog.EndFile)
 	prog.End = cover.annotateStmtsList(prog.End)
 	prog.Functions = cover.annotateFunctions(prog.Functions)
+	if cover.mode == ModeBranch {
+		cover.annotateBranches(prog)
+	}
 }
 
-// WriteProfile writes coverage data to a file at the given path.
-func (cover *Cover) WriteProfile(path string, data map[string]interface{}) error {
+// WriteProfile writes coverage data to a file at the given path. The array
+// function is called to fetch the contents of the coverage arrays (such as
+// ArrayName) after the program has run.
+func (cover *Cover) WriteProfile(path string, array func(name string) map[string]interface{}) error {
 	// 1a. If file doesn't exist - create and write cover mode line
 	// 1b. If file exists and coverappend=true  - open it for writing in append mode
 	// 1c. If file exists and coverappend=false - truncate it and follow 1a.
 	// 2.  Write all cover data lines
 
-	dataInts, err := dataToInts(data)
+	dataInts, err := dataToInts(array(ArrayName))
 	if err != nil {
 		return err
 	}
+	var branchInts map[int]int
+	if cover.mode == ModeBranch {
+		branchInts, err = dataToInts(array(BranchArrayName))
+		if err != nil {
+			return err
+		}
+	}
 	isNewFile := true
 
 	var f *os.File
@@ -115,7 +138,18 @@ func (cover *Cover) WriteProfile(path string, data map[string]interface{}) error
 			return err
 		}
 	}
-	return nil
+	for i, b := range cover.branches {
+		_, err := fmt.Fprintf(f, "%s:%d.%d,%d.%d %s %d %d\n",
+			toAbsolutePath(b.path),
+			b.start.Line, b.start.Column,
+			b.end.Line, b.end.Column,
+			b.kind, branchInts[2*i+1], branchInts[2*i+2],
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return f.Close()
 }
 
 func dataToInts(data map[string]interface{}) (map[int]int, error) {
@@ -245,7 +279,7 @@ func (cover *Cover) trackStatement(stmts []ast.Stmt) ast.Stmt {
 		Array: ArrayName,
 		Index: []ast.Expr{&ast.NumExpr{Value: float64(len(cover.trackedBlocks))}},
 	}
-	if cover.mode == ModeCount {
+	if cover.mode == ModeCount || cover.mode == ModeBranch {
 		// AST for __COVER[index]++
 		return &ast.ExprStmt{Expr: &ast.IncrExpr{Expr: left, Op: lexer.INCR}}
 	}
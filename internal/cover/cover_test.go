@@ -67,3 +67,144 @@ func TestAnnotatingLogicCorrectness(t *testing.T) {
 func normalizeNewlines(b []byte) []byte {
 	return bytes.Replace(b, []byte("\r\n"), []byte{'\n'}, -1)
 }
+
+func TestReport(t *testing.T) {
+	tests := []struct {
+		name     string
+		profile  string
+		expected string
+	}{
+		{"merged runs", "test_2file2runs_count.cov", `
+../../testdata/cover/a2.awk:	(file)		100.0%
+../../testdata/cover/a1.awk:8:	callF		100.0%
+../../testdata/cover/a1.awk:	(file)		100.0%
+total:				(statements)	100.0%
+`},
+		{"branch", "test_a5_branch.cov", `
+../../testdata/cover/a5.awk:1:	f		100.0%	3/4 branches
+../../testdata/cover/a5.awk:	(file)		90.9%	9/14 branches
+total:				(statements)	90.9%	9/14 branches
+
+../../testdata/cover/a5.awk:4:10: ?: condition never false
+../../testdata/cover/a5.awk:13:1: range pattern never evaluated
+../../testdata/cover/a5.awk:13:12: range pattern never evaluated
+`},
+		{"uncovered function", "", `
+../../testdata/cover/a1.awk:8:	callF		0.0%
+../../testdata/cover/a1.awk:	(file)		85.7%
+total:				(statements)	85.7%
+`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			profile := "mode: set\na1.awk:2.3,6.30 5 1\na1.awk:11.6,11.18 1 1\na1.awk:9.3,9.16 1 0\n"
+			if test.profile != "" {
+				data, err := ioutil.ReadFile("../../testdata/cover/" + test.profile)
+				if err != nil {
+					t.Fatal(err)
+				}
+				profile = string(normalizeNewlines(data))
+			}
+			profile = strings.Replace(profile, "\na", "\n../../testdata/cover/a", -1)
+			profilePath := writeTempProfile(t, profile)
+			defer os.Remove(profilePath)
+
+			var buf bytes.Buffer
+			err := WriteReport(&buf, "text", profilePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != test.expected[1:] {
+				t.Errorf("wrong report, expected:\n%s\nactual:\n%s", test.expected[1:], buf.String())
+			}
+		})
+	}
+}
+
+func TestReportHTML(t *testing.T) {
+	profilePath := writeTempProfile(t, "mode: count\n"+
+		"../../testdata/cover/a1.awk:2.3,6.30 5 1\n"+
+		"../../testdata/cover/a1.awk:11.6,11.18 1 0\n"+
+		"../../testdata/cover/a1.awk:9.3,9.16 1 3\n")
+	defer os.Remove(profilePath)
+
+	var buf bytes.Buffer
+	err := WriteReport(&buf, "html", profilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		`<option value="file0" selected>../../testdata/cover/a1.awk (85.7%)</option>`,
+		`<span class="cov1" title="1">print &#34;hello&#34;`,
+		`<span class="cov10" title="3">print &#34;world&#34;</span>`,
+		`END{ <span class="cov0" title="0">print &#34;END&#34; </span>}`,
+	} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("expected HTML report to contain %q, got:\n%s", s, buf.String())
+		}
+	}
+}
+
+func TestReportHTMLBranches(t *testing.T) {
+	data, err := ioutil.ReadFile("../../testdata/cover/test_a5_branch.cov")
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile := strings.Replace(string(normalizeNewlines(data)), "\na", "\n../../testdata/cover/a", -1)
+	profilePath := writeTempProfile(t, profile)
+	defer os.Remove(profilePath)
+
+	var buf bytes.Buffer
+	err = WriteReport(&buf, "html", profilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		`<span class="cov10" title="2"><span class="branch" title="if condition: true 1, false 1">if (x &gt; 1)`,
+		`return <span class="branch partial" title="?: condition: true 1, false 0">x </span>? &#34;one&#34;`,
+		`<span class="branch partial" title="range pattern: true 0, false 0">$1 == &#34;x&#34;</span>, `,
+		`<span class="partial">partially covered branch</span>`,
+	} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("expected HTML report to contain %q, got:\n%s", s, buf.String())
+		}
+	}
+}
+
+func TestReportErrors(t *testing.T) {
+	tests := []struct {
+		profile string
+		err     string
+	}{
+		{"", `expected "mode: set|count|branch"`},
+		{"foo.awk:1.1,1.5 1 1\n", `line 1: expected "mode: set|count|branch"`},
+		{"mode: bad\n", `line 1: invalid mode "bad"`},
+		{"mode: set\nfoo.awk:1.1 1 1\n", `line 2: invalid block "foo.awk:1.1 1 1"`},
+		{"mode: set\nfoo.awk:1.1,x.5 1 1\n", `line 2: invalid position "x.5"`},
+		{"mode: set\nmode: count\n", `line 2: mode count doesn't match mode set`},
+		{"mode: count\nfoo.awk:1.1,1.5 if 1 0\n", `line 2: branch "foo.awk:1.1,1.5 if 1 0" only allowed in branch mode`},
+	}
+	for _, test := range tests {
+		t.Run(test.err, func(t *testing.T) {
+			profilePath := writeTempProfile(t, test.profile)
+			defer os.Remove(profilePath)
+			err := WriteReport(ioutil.Discard, "text", profilePath)
+			if err == nil || err.Error() != profilePath+": "+test.err {
+				t.Errorf("expected error %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func writeTempProfile(t *testing.T, profile string) string {
+	f, err := ioutil.TempFile("", "goawk_cover_*.cov")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	_, err = f.WriteString(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
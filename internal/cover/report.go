@@ -0,0 +1,671 @@
+// Coverage reports (HTML and per-function text) generated from a profile
+
+package cover
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/benhoyt/goawk/internal/parseutil"
+	"github.com/benhoyt/goawk/lexer"
+	"github.com/benhoyt/goawk/parser"
+)
+
+// Report is a coverage report read from a coverage profile.
+type Report struct {
+	mode  Mode
+	files []*fileReport
+}
+
+type fileReport struct {
+	path      string
+	source    []byte // nil if the source file couldn't be read
+	blocks    []profileBlock
+	branches  []profileBranch
+	functions []functionReport
+}
+
+type profileBlock struct {
+	trackedBlock
+	count int
+}
+
+type profileBranch struct {
+	branch
+	trueCount  int
+	falseCount int
+}
+
+// Return the number of outcomes (true and false) of the branch that were
+// covered. Each branch has two possible outcomes.
+func (b profileBranch) covered() int {
+	n := 0
+	if b.trueCount > 0 {
+		n++
+	}
+	if b.falseCount > 0 {
+		n++
+	}
+	return n
+}
+
+type functionReport struct {
+	name     string
+	line     int
+	start    lexer.Position // start and end of function in its file
+	end      lexer.Position
+	numStmts int
+	covered  int
+	branches int // number of branch outcomes
+	taken    int // number of branch outcomes covered
+}
+
+// ReadReport reads the coverage profile at the given path, along with the
+// AWK source files it refers to, and returns a report. Blocks that appear
+// more than once (from runs with -coverappend) are merged.
+func ReadReport(path string) (*Report, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	report, err := parseProfile(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	report.readSources()
+	return report, nil
+}
+
+func parseProfile(r io.Reader) (*Report, error) {
+	report := &Report{}
+	files := make(map[string]*fileReport)
+	blockIndexes := make(map[trackedBlock]int)
+	branchIndexes := make(map[branch]int)
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		lineNum++
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "mode: ") {
+			mode, err := parseMode(line[len("mode: "):])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNum, err)
+			}
+			if report.mode != ModeUnspecified && mode != report.mode {
+				return nil, fmt.Errorf("line %d: mode %s doesn't match mode %s", lineNum, mode, report.mode)
+			}
+			report.mode = mode
+			continue
+		}
+		if report.mode == ModeUnspecified {
+			return nil, fmt.Errorf("line %d: expected \"mode: set|count|branch\"", lineNum)
+		}
+		block, br, isBranch, err := parseBlock(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+		if isBranch && report.mode != ModeBranch {
+			return nil, fmt.Errorf("line %d: branch %q only allowed in branch mode", lineNum, line)
+		}
+		path := block.path
+		if isBranch {
+			path = br.path
+		}
+		file := files[path]
+		if file == nil {
+			file = &fileReport{path: path}
+			files[path] = file
+			report.files = append(report.files, file)
+		}
+		if isBranch {
+			if i, ok := branchIndexes[br.branch]; ok {
+				file.branches[i].trueCount += br.trueCount
+				file.branches[i].falseCount += br.falseCount
+				continue
+			}
+			branchIndexes[br.branch] = len(file.branches)
+			file.branches = append(file.branches, br)
+			continue
+		}
+		if i, ok := blockIndexes[block.trackedBlock]; ok {
+			existing := &file.blocks[i]
+			if report.mode != ModeSet {
+				existing.count += block.count
+			} else if block.count > existing.count {
+				existing.count = block.count
+			}
+			continue
+		}
+		blockIndexes[block.trackedBlock] = len(file.blocks)
+		file.blocks = append(file.blocks, block)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if report.mode == ModeUnspecified {
+		return nil, fmt.Errorf("expected \"mode: set|count|branch\"")
+	}
+	for _, file := range report.files {
+		sort.Slice(file.blocks, func(i, j int) bool {
+			return positionLess(file.blocks[i].start, file.blocks[j].start)
+		})
+		sort.Slice(file.branches, func(i, j int) bool {
+			return positionLess(file.branches[i].start, file.branches[j].start)
+		})
+	}
+	return report, nil
+}
+
+func parseMode(s string) (Mode, error) {
+	switch s {
+	case "set":
+		return ModeSet, nil
+	case "count":
+		return ModeCount, nil
+	case "branch":
+		return ModeBranch, nil
+	default:
+		return ModeUnspecified, fmt.Errorf("invalid mode %q", s)
+	}
+}
+
+// Parse a block line of the form "path:line.col,line.col numStmts count",
+// or (in branch mode) a branch line of the form "path:line.col,line.col
+// kind trueCount falseCount". The path may itself contain colons (for
+// example, on Windows).
+func parseBlock(line string) (block profileBlock, br profileBranch, isBranch bool, err error) {
+	colon := strings.LastIndexByte(line, ':')
+	if colon < 0 {
+		return block, br, false, fmt.Errorf("invalid block %q", line)
+	}
+	path := line[:colon]
+	fields := strings.Fields(line[colon+1:])
+	if len(fields) != 3 && len(fields) != 4 {
+		return block, br, false, fmt.Errorf("invalid block %q", line)
+	}
+	positions := strings.Split(fields[0], ",")
+	if len(positions) != 2 {
+		return block, br, false, fmt.Errorf("invalid block %q", line)
+	}
+	start, err := parsePosition(positions[0])
+	if err != nil {
+		return block, br, false, err
+	}
+	end, err := parsePosition(positions[1])
+	if err != nil {
+		return block, br, false, err
+	}
+	if len(fields) == 4 {
+		br.branch = branch{start: start, end: end, path: path, kind: fields[1]}
+		if br.trueCount, err = strconv.Atoi(fields[2]); err != nil {
+			return block, br, true, fmt.Errorf("invalid count %q", fields[2])
+		}
+		if br.falseCount, err = strconv.Atoi(fields[3]); err != nil {
+			return block, br, true, fmt.Errorf("invalid count %q", fields[3])
+		}
+		return block, br, true, nil
+	}
+	block.trackedBlock = trackedBlock{start: start, end: end, path: path}
+	if block.numStmts, err = strconv.Atoi(fields[1]); err != nil {
+		return block, br, false, fmt.Errorf("invalid statement count %q", fields[1])
+	}
+	if block.count, err = strconv.Atoi(fields[2]); err != nil {
+		return block, br, false, fmt.Errorf("invalid count %q", fields[2])
+	}
+	return block, br, false, nil
+}
+
+func parsePosition(s string) (lexer.Position, error) {
+	dot := strings.IndexByte(s, '.')
+	if dot < 0 {
+		return lexer.Position{}, fmt.Errorf("invalid position %q", s)
+	}
+	line, err1 := strconv.Atoi(s[:dot])
+	column, err2 := strconv.Atoi(s[dot+1:])
+	if err1 != nil || err2 != nil {
+		return lexer.Position{}, fmt.Errorf("invalid position %q", s)
+	}
+	return lexer.Position{Line: line, Column: column}, nil
+}
+
+// Read the source files the profile refers to and find the functions
+// defined in them. Files that can't be read (for example, "<cmdline>")
+// are reported without source or functions.
+func (report *Report) readSources() {
+	fileReader := &parseutil.FileReader{}
+	allRead := true
+	for _, file := range report.files {
+		source, err := ioutil.ReadFile(file.path)
+		if err != nil {
+			allRead = false
+			continue
+		}
+		file.source = source
+		_ = fileReader.AddFile(file.path, bytes.NewReader(source))
+	}
+	if !allRead {
+		return
+	}
+	// The order of the files may differ from the original program's (the
+	// profile lists blocks in BEGIN, actions, END, functions order), but
+	// that doesn't matter for finding the functions.
+	prog, err := parser.ParseProgram(fileReader.Source(), nil)
+	if err != nil {
+		return // for example, the program calls native Go functions
+	}
+	files := make(map[string]*fileReport)
+	for _, file := range report.files {
+		files[file.path] = file
+	}
+	for _, f := range prog.ResolvedProgram.Functions {
+		path, line := fileReader.FileLine(f.Pos.Line)
+		file := files[path]
+		if file == nil {
+			continue
+		}
+		function := functionReport{
+			name:  f.Name,
+			line:  line,
+			start: lexer.Position{Line: line, Column: f.Pos.Column},
+		}
+		if len(f.Body) > 0 {
+			end := f.Body[len(f.Body)-1].EndPos()
+			_, endLine := fileReader.FileLine(end.Line)
+			function.end = lexer.Position{Line: endLine, Column: end.Column}
+		}
+		for _, block := range file.blocks {
+			if function.contains(block.start) {
+				function.numStmts += block.numStmts
+				if block.count > 0 {
+					function.covered += block.numStmts
+				}
+			}
+		}
+		for _, b := range file.branches {
+			if function.contains(b.start) {
+				function.branches += 2
+				function.taken += b.covered()
+			}
+		}
+		file.functions = append(file.functions, function)
+	}
+}
+
+func (f *functionReport) contains(pos lexer.Position) bool {
+	return !positionLess(pos, f.start) && !positionLess(f.end, pos)
+}
+
+func positionLess(a, b lexer.Position) bool {
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Column < b.Column
+}
+
+func percent(covered, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(covered) / float64(total)
+}
+
+// Return the number of covered statements and total statements in file.
+func (file *fileReport) coverage() (covered, total int) {
+	for _, block := range file.blocks {
+		total += block.numStmts
+		if block.count > 0 {
+			covered += block.numStmts
+		}
+	}
+	return covered, total
+}
+
+// Return the number of branch outcomes covered and the total number of
+// branch outcomes in file.
+func (file *fileReport) branchCoverage() (taken, total int) {
+	for _, b := range file.branches {
+		taken += b.covered()
+		total += 2
+	}
+	return taken, total
+}
+
+// Description of each kind of branch, for reports.
+var branchDescriptions = map[string]string{
+	branchIf:      "if condition",
+	branchWhile:   "while condition",
+	branchFor:     "for condition",
+	branchDo:      "do-while condition",
+	branchPattern: "pattern",
+	branchRange:   "range pattern",
+	branchTernary: "?: condition",
+}
+
+func (b profileBranch) description() string {
+	description := branchDescriptions[b.kind]
+	if description == "" {
+		description = b.kind
+	}
+	return description
+}
+
+// WriteText writes a per-function and per-file summary of statement
+// coverage, similar to the output of "go tool cover -func". In branch mode,
+// it also shows the number of branch outcomes (true or false) covered, and
+// lists the conditions with outcomes that never happened.
+func (report *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 1, 8, 1, '\t', 0)
+	branches := func(taken, total int) string {
+		if report.mode != ModeBranch {
+			return ""
+		}
+		return fmt.Sprintf("\t%d/%d branches", taken, total)
+	}
+	var covered, total, taken, totalBranches int
+	for _, file := range report.files {
+		for _, f := range file.functions {
+			fmt.Fprintf(tw, "%s:%d:\t%s\t%.1f%%%s\n",
+				file.path, f.line, f.name, percent(f.covered, f.numStmts),
+				branches(f.taken, f.branches))
+		}
+		fileCovered, fileTotal := file.coverage()
+		fileTaken, fileBranches := file.branchCoverage()
+		fmt.Fprintf(tw, "%s:\t(file)\t%.1f%%%s\n",
+			file.path, percent(fileCovered, fileTotal), branches(fileTaken, fileBranches))
+		covered += fileCovered
+		total += fileTotal
+		taken += fileTaken
+		totalBranches += fileBranches
+	}
+	fmt.Fprintf(tw, "total:\t(statements)\t%.1f%%%s\n",
+		percent(covered, total), branches(taken, totalBranches))
+	err := tw.Flush()
+	if err != nil {
+		return err
+	}
+
+	first := true
+	for _, file := range report.files {
+		for _, b := range file.branches {
+			var never string
+			switch {
+			case b.trueCount == 0 && b.falseCount == 0:
+				never = "never evaluated"
+			case b.trueCount == 0:
+				never = "never true"
+			case b.falseCount == 0:
+				never = "never false"
+			default:
+				continue
+			}
+			if first {
+				fmt.Fprintln(w)
+				first = false
+			}
+			_, err := fmt.Fprintf(w, "%s:%d:%d: %s %s\n",
+				file.path, b.start.Line, b.start.Column, b.description(), never)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteHTML writes an HTML page showing the source of each file, with
+// covered statements in green and uncovered ones in red. In count mode,
+// the shade of green indicates how many times a statement ran.
+func (report *Report) WriteHTML(w io.Writer) error {
+	maxCount := 0
+	for _, file := range report.files {
+		for _, block := range file.blocks {
+			if block.count > maxCount {
+				maxCount = block.count
+			}
+		}
+	}
+	data := htmlData{
+		Count:  report.mode != ModeSet,
+		Branch: report.mode == ModeBranch,
+	}
+	for i, file := range report.files {
+		covered, total := file.coverage()
+		var body bytes.Buffer
+		if file.source == nil {
+			body.WriteString("(source not available)")
+		} else {
+			file.writeHTMLSource(&body, report.mode, maxCount)
+		}
+		data.Files = append(data.Files, htmlFile{
+			Name:     file.path,
+			Coverage: percent(covered, total),
+			Body:     template.HTML(body.String()),
+			Selected: i == 0,
+		})
+	}
+	return htmlTemplate.Execute(w, data)
+}
+
+// Write the file's source as HTML, wrapping each block in a span whose
+// class indicates its coverage. Branches are wrapped in nested spans that
+// show how many times they were true and false.
+func (file *fileReport) writeHTMLSource(w *bytes.Buffer, mode Mode, maxCount int) {
+	src := file.source
+	var spans []htmlSpan
+	for _, block := range file.blocks {
+		spans = append(spans, htmlSpan{
+			start: byteOffset(src, block.start),
+			end:   byteOffset(src, block.end),
+			open: fmt.Sprintf(`<span class="cov%d" title="%d">`,
+				coverClass(mode, block.count, maxCount), block.count),
+		})
+	}
+	for _, b := range file.branches {
+		class := "branch"
+		if b.covered() < 2 {
+			class = "branch partial"
+		}
+		spans = append(spans, htmlSpan{
+			start: byteOffset(src, b.start),
+			end:   byteOffset(src, b.end),
+			open: fmt.Sprintf(`<span class="%s" title="%s: true %d, false %d">`,
+				class, b.description(), b.trueCount, b.falseCount),
+		})
+	}
+
+	// Spans are nested (for example, a branch in a statement block), so
+	// write opening and closing tags in order of their offsets, closing
+	// inner spans before outer ones.
+	type tag struct {
+		offset int
+		open   bool
+		span   int
+	}
+	tags := make([]tag, 0, 2*len(spans))
+	for i, span := range spans {
+		if span.end < span.start {
+			spans[i].end = span.start
+		}
+		tags = append(tags, tag{span.start, true, i}, tag{spans[i].end, false, i})
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		a, b := tags[i], tags[j]
+		if a.offset != b.offset {
+			return a.offset < b.offset
+		}
+		if a.open != b.open {
+			return !a.open // close before opening the next span
+		}
+		sa, sb := spans[a.span], spans[b.span]
+		if a.open {
+			if sa.end != sb.end {
+				return sa.end > sb.end // outer span first
+			}
+			return a.span < b.span
+		}
+		if sa.start != sb.start {
+			return sa.start > sb.start // inner span first
+		}
+		return a.span > b.span
+	})
+	offset := 0
+	for _, t := range tags {
+		template.HTMLEscape(w, src[offset:t.offset])
+		offset = t.offset
+		if t.open {
+			w.WriteString(spans[t.span].open)
+		} else {
+			w.WriteString("</span>")
+		}
+	}
+	template.HTMLEscape(w, src[offset:])
+}
+
+type htmlSpan struct {
+	start int
+	end   int
+	open  string // opening tag
+}
+
+// Return the byte offset in src of the given (1-based) line and column.
+func byteOffset(src []byte, pos lexer.Position) int {
+	offset := 0
+	for line := 1; line < pos.Line; line++ {
+		i := bytes.IndexByte(src[offset:], '\n')
+		if i < 0 {
+			return len(src)
+		}
+		offset += i + 1
+	}
+	offset += pos.Column - 1
+	if offset > len(src) {
+		return len(src)
+	}
+	return offset
+}
+
+// Return the CSS class number for a block that ran count times: 0 means
+// not covered, and 1 to 10 are increasingly "hot" (logarithmic scale).
+func coverClass(mode Mode, count, maxCount int) int {
+	switch {
+	case count == 0:
+		return 0
+	case mode == ModeSet || maxCount <= 1:
+		return 8
+	default:
+		return 1 + int(9*math.Log(float64(count))/math.Log(float64(maxCount)))
+	}
+}
+
+type htmlData struct {
+	Count  bool
+	Branch bool
+	Files  []htmlFile
+}
+
+type htmlFile struct {
+	Name     string
+	Coverage float64
+	Body     template.HTML
+	Selected bool
+}
+
+var htmlTemplate = template.Must(template.New("html").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta http-equiv="Content-Type" content="text/html; charset=utf-8">
+<title>GoAWK coverage report</title>
+<style>
+body { background: black; color: rgb(80, 80, 80); font-family: Menlo, monospace; }
+#topbar { background: black; position: fixed; top: 0; left: 0; right: 0; height: 42px; border-bottom: 1px solid rgb(80, 80, 80); }
+#nav, #legend { float: left; margin: 10px; }
+#legend span { margin: 0 5px; }
+#content { margin-top: 50px; }
+pre { font-size: 14px; }
+.cov0 { color: rgb(192, 0, 0) }
+.cov1 { color: rgb(128, 128, 128) }
+.cov2 { color: rgb(116, 140, 131) }
+.cov3 { color: rgb(104, 152, 134) }
+.cov4 { color: rgb(92, 164, 137) }
+.cov5 { color: rgb(80, 176, 140) }
+.cov6 { color: rgb(68, 188, 143) }
+.cov7 { color: rgb(56, 200, 146) }
+.cov8 { color: rgb(44, 212, 149) }
+.cov9 { color: rgb(32, 224, 152) }
+.cov10 { color: rgb(20, 236, 155) }
+.partial { background: rgb(96, 72, 0) }
+</style>
+</head>
+<body>
+<div id="topbar">
+<div id="nav">
+<select id="files">
+{{range $i, $f := .Files}}<option value="file{{$i}}"{{if $f.Selected}} selected{{end}}>{{$f.Name}} ({{printf "%.1f" $f.Coverage}}%)</option>
+{{end}}</select>
+</div>
+<div id="legend">
+<span>not tracked</span>
+{{if .Count}}<span class="cov0">no coverage</span>
+<span class="cov1">low coverage</span>
+<span class="cov2">*</span>
+<span class="cov3">*</span>
+<span class="cov4">*</span>
+<span class="cov5">*</span>
+<span class="cov6">*</span>
+<span class="cov7">*</span>
+<span class="cov8">*</span>
+<span class="cov9">*</span>
+<span class="cov10">high coverage</span>
+{{else}}<span class="cov0">not covered</span>
+<span class="cov8">covered</span>
+{{end}}{{if .Branch}}<span class="partial">partially covered branch</span>
+{{end}}</div>
+</div>
+<div id="content">
+{{range $i, $f := .Files}}<pre class="file" id="file{{$i}}"{{if not $f.Selected}} style="display: none"{{end}}>{{$f.Body}}</pre>
+{{end}}</div>
+<script>
+(function() {
+	var files = document.getElementById('files');
+	var visible = document.getElementById(files.value);
+	files.addEventListener('change', function() {
+		visible.style.display = 'none';
+		visible = document.getElementById(files.value);
+		visible.style.display = 'block';
+		window.scrollTo(0, 0);
+	}, false);
+})();
+</script>
+</body>
+</html>
+`))
+
+// WriteReport reads the coverage profile at profilePath and writes a report
+// in the given format ("html" or "text") to w.
+func WriteReport(w io.Writer, format, profilePath string) error {
+	if format != "html" && format != "text" {
+		return fmt.Errorf("report format must be html or text, not %q", format)
+	}
+	report, err := ReadReport(profilePath)
+	if err != nil {
+		return err
+	}
+	if format == "html" {
+		return report.WriteHTML(w)
+	}
+	return report.WriteText(w)
+}
@@ -0,0 +1,78 @@
+// Package profile writes an AWK program's execution profile (collected
+// using interp.Config.Profiling) as an annotated source listing.
+package profile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/benhoyt/goawk/internal/parseutil"
+	"github.com/benhoyt/goawk/interp"
+)
+
+// WriteListing writes the program's source code (from fileReader) with each
+// line annotated with the number of times it was executed, the number of
+// VM instructions executed for it, and the estimated time spent executing
+// it. This is followed by a summary of calls to user-defined functions and
+// of regex and format cache use (if any).
+func WriteListing(w io.Writer, profile *interp.Profile, fileReader *parseutil.FileReader) error {
+	bw := bufio.NewWriter(w)
+	lines := make(map[int]interp.LineProfile, len(profile.Lines))
+	for _, line := range profile.Lines {
+		lines[line.Line] = line
+	}
+
+	fmt.Fprintln(bw, "# GoAWK profile: execution count, VM instructions, and estimated time per line")
+	fmt.Fprintf(bw, "#%9s %12s %10s\n", "count", "instructions", "time(ms)")
+	source := strings.TrimSuffix(string(fileReader.Source()), "\n")
+	for i, text := range strings.Split(source, "\n") {
+		path, fileLine := fileReader.FileLine(i + 1)
+		if fileLine == 1 {
+			fmt.Fprintf(bw, "\n# %s\n", path)
+		}
+		if line, ok := lines[i+1]; ok {
+			fmt.Fprintf(bw, "%10d %12d %10s  %s\n", line.Count, line.Instructions, formatTime(line.Time), text)
+		} else {
+			fmt.Fprintf(bw, "%10s %12s %10s  %s\n", "", "", "", text)
+		}
+	}
+
+	if len(profile.Functions) > 0 {
+		fmt.Fprintln(bw, "\n# Functions")
+		fmt.Fprintf(bw, "#%9s %12s %10s  %s\n", "calls", "instructions", "time(ms)", "function")
+		for _, f := range profile.Functions {
+			path, line := fileReader.FileLine(f.Position.Line)
+			fmt.Fprintf(bw, "%10d %12d %10s  %s (%s:%d)\n",
+				f.Calls, f.Instructions, formatTime(f.Time), f.Name, path, line)
+		}
+	}
+
+	caches := []struct {
+		name  string
+		stats interp.CacheStats
+	}{
+		{"regex", profile.RegexCache},
+		{"format", profile.FormatCache},
+	}
+	wroteHeader := false
+	for _, c := range caches {
+		if c.stats.Hits == 0 && c.stats.Misses == 0 {
+			continue
+		}
+		if !wroteHeader {
+			fmt.Fprintln(bw, "\n# Caches")
+			fmt.Fprintf(bw, "#%9s %12s  %s\n", "hits", "misses", "cache")
+			wroteHeader = true
+		}
+		fmt.Fprintf(bw, "%10d %12d  %s\n", c.stats.Hits, c.stats.Misses, c.name)
+	}
+
+	return bw.Flush()
+}
+
+func formatTime(d time.Duration) string {
+	return fmt.Sprintf("%.1f", float64(d)/float64(time.Millisecond))
+}
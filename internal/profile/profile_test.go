@@ -0,0 +1,66 @@
+package profile_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benhoyt/goawk/internal/parseutil"
+	"github.com/benhoyt/goawk/internal/profile"
+	"github.com/benhoyt/goawk/interp"
+	"github.com/benhoyt/goawk/lexer"
+)
+
+func TestWriteListing(t *testing.T) {
+	fileReader := &parseutil.FileReader{}
+	err := fileReader.AddFile("lib.awk", strings.NewReader("function inc(x) {\n\treturn x + 1\n}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fileReader.AddFile("main.awk", strings.NewReader("{ n = inc(n) }\nEND { print n }\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prof := &interp.Profile{
+		Lines: []interp.LineProfile{
+			{Line: 2, Count: 1000, Instructions: 4000, Time: 2500 * time.Microsecond},
+			{Line: 4, Count: 1000, Instructions: 3000, Time: time.Millisecond},
+			{Line: 5, Count: 1, Instructions: 2},
+		},
+		Functions: []interp.FunctionProfile{
+			{Name: "inc", Position: lexer.Position{Line: 1, Column: 1}, Calls: 1000, Instructions: 4000, Time: 2500 * time.Microsecond},
+		},
+		FormatCache: interp.CacheStats{Hits: 999, Misses: 1},
+	}
+
+	var buf bytes.Buffer
+	err = profile.WriteListing(&buf, prof, fileReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+# GoAWK profile: execution count, VM instructions, and estimated time per line
+#    count instructions   time(ms)
+
+# lib.awk
+                                    function inc(x) {
+      1000         4000        2.5  	return x + 1
+                                    }
+
+# main.awk
+      1000         3000        1.0  { n = inc(n) }
+         1            2        0.0  END { print n }
+
+# Functions
+#    calls instructions   time(ms)  function
+      1000         4000        2.5  inc (lib.awk:1)
+
+# Caches
+#     hits       misses  cache
+       999            1  format
+`[1:]
+	if buf.String() != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
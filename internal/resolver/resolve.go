@@ -176,6 +176,16 @@ func Resolve(prog *ast.Program, config *Config) *ResolvedProgram {
 	main := mainVisitor{r: &r, nativeFuncs: config.Funcs, funcIndexes: callGraph.funcIndexes}
 	main.walkOrdered(prog, orderedFuncs)
 
+	// OFIELDS (used by printrow) and PROCINFO are arrays unless the
+	// program uses them as scalars, as older programs may. A program that
+	// does that and also calls printrow without a fields argument fails in
+	// recordVar; the interpreter doesn't set PROCINFO if it's a scalar.
+	for _, name := range []string{"OFIELDS", "PROCINFO"} {
+		if info, exists := r.varInfo[""][name]; !exists || info.Type == unknown {
+			r.varInfo[""][name] = VarInfo{Type: Array}
+		}
+	}
+
 	// Do another pass to set parameter types in functions which don't use
 	// their parameters, such as f1's A parameter in this example:
 	//  function f1(A) {}  function f2(x, A) { x[0]; f1(a); f2(a) }
@@ -382,9 +392,15 @@ func (v *mainVisitor) walkOrdered(prog *ast.Program, orderedFuncs []string) {
 	for _, stmts := range prog.Begin {
 		ast.WalkStmtList(v, stmts)
 	}
+	for _, stmts := range prog.BeginFile {
+		ast.WalkStmtList(v, stmts)
+	}
 	for _, action := range prog.Actions {
 		ast.Walk(v, action)
 	}
+	for _, stmts := range prog.EndFile {
+		ast.WalkStmtList(v, stmts)
+	}
 	for _, stmts := range prog.End {
 		ast.WalkStmtList(v, stmts)
 	}
@@ -420,6 +436,16 @@ func (v *mainVisitor) Visit(node ast.Node) ast.Visitor {
 			v.r.recordVar(v.curFunc, varExpr.Name, Array, varExpr.Pos)
 			ast.WalkExprList(v, n.Args[2:])
 
+		case lexer.F_PRINTROW:
+			for _, arg := range n.Args { // printrow()'s args are always arrays
+				varExpr := arg.(*ast.VarExpr)
+				v.r.recordVar(v.curFunc, varExpr.Name, Array, varExpr.Pos)
+			}
+			if len(n.Args) == 1 {
+				// Field order comes from the global OFIELDS array
+				v.r.recordVar("", "OFIELDS", Array, n.Args[0].(*ast.VarExpr).Pos)
+			}
+
 		case lexer.F_LENGTH:
 			if len(n.Args) > 0 {
 				if varExpr, ok := n.Args[0].(*ast.VarExpr); ok {
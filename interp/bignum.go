@@ -0,0 +1,508 @@
+// Arbitrary-precision arithmetic for bignum mode (Config.Bignum)
+
+package interp
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/benhoyt/goawk/internal/compiler"
+)
+
+const (
+	defaultPrec   = 53      // same precision as float64
+	maxExactPower = 1 << 20 // larger integer powers are rounded to PREC bits
+)
+
+// Named precisions accepted by PREC (these are the same as gawk's).
+var precNames = map[string]uint{
+	"half":   11,
+	"single": 24,
+	"double": 53,
+	"quad":   113,
+	"oct":    237,
+}
+
+// Rounding modes accepted by ROUNDMODE.
+var roundModes = map[string]big.RoundingMode{
+	"N": big.ToNearestEven,
+	"Z": big.ToZero,
+	"U": big.ToPositiveInf,
+	"D": big.ToNegativeInf,
+	"A": big.AwayFromZero,
+}
+
+func roundModeString(mode big.RoundingMode) string {
+	for s, m := range roundModes {
+		if m == mode {
+			return s
+		}
+	}
+	return "N"
+}
+
+// Set the precision (in bits) used for non-integer results from the PREC
+// special variable's value.
+func (p *interp) setPrec(v value) error {
+	s := strings.TrimSpace(p.toString(v))
+	if prec, ok := precNames[strings.ToLower(s)]; ok {
+		p.prec = prec
+		return nil
+	}
+	n := v.num()
+	if n < 1 || n > big.MaxPrec {
+		return newError("invalid PREC %q: must be between 1 and %d, or a name like \"quad\"", s, uint(big.MaxPrec))
+	}
+	p.prec = uint(n)
+	return nil
+}
+
+// Set the rounding mode used for non-integer results from the ROUNDMODE
+// special variable's value.
+func (p *interp) setRoundMode(v value) error {
+	s := p.toString(v)
+	mode, ok := roundModes[strings.ToUpper(s)]
+	if !ok {
+		return newError("invalid ROUNDMODE %q: must be N, Z, U, D, or A", s)
+	}
+	p.roundMode = mode
+	return nil
+}
+
+// Create a new number value from a big.Float. The value's n is the nearest
+// float64, for code that doesn't need the full precision, and s is the exact
+// value in hexadecimal (see decodeBig). Small integers, which are the most
+// common, are stored as normal numbers. A bignum could be a separate field
+// in value, but that would make values bigger and slow down normal mode.
+func bigNum(f *big.Float) value {
+	n, _ := f.Float64()
+	if f.IsInf() || f.IsInt() && isSmallInt(n) {
+		return num(n)
+	}
+	return value{typ: typeNum, s: f.Text('p', 0), n: n}
+}
+
+// Report whether n is an integer small enough that float64 addition,
+// subtraction, and multiplication of such integers is exact (if the result
+// is also small).
+func isSmallInt(n float64) bool {
+	return n == math.Trunc(n) && n > -1<<53 && n < 1<<53
+}
+
+// Return v's number value as a float64 if it's a number that isn't a bignum
+// or a string that's a short decimal integer (like most input fields). These
+// compare the same way as the big.Floats toBig would return, and integers
+// are exact, so callers can avoid the conversion.
+func fastNum(v value) (float64, bool) {
+	switch v.typ {
+	case typeNum:
+		return v.n, v.s == ""
+	case typeStr, typeNumStr:
+		if !isShortIntStr(v.s) {
+			return 0, false
+		}
+		return parseFloatPrefix(v.s), true
+	default: // typeNull
+		return 0, true
+	}
+}
+
+// Report whether s (as parsed by parseFloatPrefix) is a decimal integer
+// with at most 15 digits.
+func isShortIntStr(s string) bool {
+	i := 0
+	for i < len(s) && asciiSpace[s[i]] != 0 {
+		i++
+	}
+	if i < len(s) && (s[i] == '+' || s[i] == '-') {
+		i++
+	}
+	start := i
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	if i == start || i-start > 15 {
+		return false
+	}
+	if i < len(s) {
+		switch s[i] {
+		case '.', 'e', 'E', 'x', 'X':
+			return false
+		}
+	}
+	return true
+}
+
+// Decode the exact value of a number created by bigNum.
+func decodeBig(s string) *big.Float {
+	// Each hex digit of the mantissa is 4 bits, so this is plenty.
+	f, _, err := new(big.Float).SetPrec(uint(4*len(s))).Parse(s, 0)
+	if err != nil {
+		panic(fmt.Sprintf("invalid bignum %q: %v", s, err))
+	}
+	return f
+}
+
+// Return a new big.Float with the current precision and rounding mode.
+func (p *interp) newFloat() *big.Float {
+	return new(big.Float).SetPrec(p.prec).SetMode(p.roundMode)
+}
+
+// Return v's number value as a big.Float, converting from string if
+// necessary, or nil if it's NaN. Decimal strings are parsed exactly if
+// they're integers, otherwise rounded to PREC bits. Numbers that aren't
+// bignums are converted from their float64 value: integers exactly, and
+// other numbers using the shortest decimal representation, so that the
+// constant 0.1 is 0.1 and not 0.1000000000000000055511151231257827.
+func (p *interp) toBig(v value) *big.Float {
+	switch v.typ {
+	case typeStr, typeNumStr:
+		return p.parseBigPrefix(v.s)
+	case typeNum:
+		if v.s != "" {
+			return decodeBig(v.s)
+		}
+		return p.floatToBig(v.n)
+	default: // typeNull
+		return new(big.Float)
+	}
+}
+
+// Convert a float64 to a big.Float as described in toBig.
+func (p *interp) floatToBig(n float64) *big.Float {
+	switch {
+	case math.IsNaN(n):
+		return nil
+	case math.IsInf(n, 0) || n == math.Trunc(n):
+		return new(big.Float).SetFloat64(n)
+	default:
+		f, _ := p.newFloat().SetString(strconv.FormatFloat(n, 'g', -1, 64))
+		return f
+	}
+}
+
+// Like parseFloatPrefix, but parse a decimal number exactly. Hexadecimal
+// numbers, NaN, and infinity are parsed by parseFloatPrefix.
+func (p *interp) parseBigPrefix(s string) *big.Float {
+	i := 0
+	for i < len(s) && asciiSpace[s[i]] != 0 {
+		i++
+	}
+	start := i
+	if i < len(s) && (s[i] == '+' || s[i] == '-') {
+		i++
+	}
+	if i+3 <= len(s) && (hasNaNPrefix(s[i:]) || hasInfPrefix(s[i:])) ||
+		i+2 < len(s) && hasHexPrefix(s[i:]) {
+		return p.floatToBig(parseFloatPrefix(s))
+	}
+	end := decimalPrefixEnd(s, i)
+	if end < 0 {
+		return new(big.Float)
+	}
+	text := s[start:end]
+	if strings.IndexAny(text, ".eE") < 0 {
+		// Integers are parsed exactly, whatever the precision.
+		if n, ok := new(big.Int).SetString(text, 10); ok {
+			return new(big.Float).SetInt(n)
+		}
+	}
+	f, ok := p.newFloat().SetString(text)
+	if !ok {
+		return p.floatToBig(parseFloatPrefix(s))
+	}
+	return f
+}
+
+// Return the values of the program's number constants for bignum mode.
+// Literals whose float64 value isn't converted to the number written in the
+// source (see toBig) are converted from their source text instead.
+func (p *interp) bigConstants() []value {
+	literals := p.program.Compiled.NumLiterals
+	nums := make([]value, len(p.nums))
+	for i, n := range p.nums {
+		nums[i] = num(n)
+		if i < len(literals) && literals[i] != "" {
+			if f := literalToBig(literals[i], n); f != nil {
+				nums[i] = bigNum(f)
+			}
+		}
+	}
+	return nums
+}
+
+// Return the value of the number literal text, or nil if toBig would
+// convert its float64 value n to the same number. Integer literals are
+// parsed exactly, and others with enough precision to keep all their
+// digits.
+func literalToBig(text string, n float64) *big.Float {
+	var f *big.Float
+	if strings.IndexAny(text, ".eE") < 0 {
+		i, ok := new(big.Int).SetString(text, 10)
+		if !ok {
+			return nil
+		}
+		f = new(big.Float).SetInt(i)
+	} else {
+		var err error
+		f, _, err = new(big.Float).SetPrec(uint(4*len(text)+64)).Parse(text, 10)
+		if err != nil {
+			return nil
+		}
+	}
+	var converted *big.Float
+	if n == math.Trunc(n) {
+		converted = new(big.Float).SetFloat64(n)
+	} else {
+		// Like floatToBig, but at f's precision so only the digits count
+		converted, _, _ = new(big.Float).SetPrec(f.Prec()).Parse(strconv.FormatFloat(n, 'g', -1, 64), 10)
+	}
+	if converted != nil && converted.Cmp(f) == 0 {
+		return nil
+	}
+	return f
+}
+
+// Return v as a big.Int if it's an integer that big.Int can represent
+// exactly, otherwise nil.
+func bigInt(f *big.Float) *big.Int {
+	if f == nil || !f.IsInt() {
+		return nil
+	}
+	n, _ := f.Int(nil)
+	return n
+}
+
+// Perform an arithmetic operation in bignum mode. Operations on integers
+// give exact integer results (except division that doesn't come out even,
+// and negative powers); other results are rounded to PREC bits using
+// ROUNDMODE. NaN and infinity are handled using float64 arithmetic.
+func (p *interp) bigArith(op compiler.AugOp, l, r value) (value, error) {
+	ln, lok := fastNum(l)
+	rn, rok := fastNum(r)
+	if lok && rok && isSmallInt(ln) && isSmallInt(rn) {
+		// Fast path for integers that float64 handles exactly
+		var n float64
+		switch op {
+		case compiler.AugOpAdd:
+			n = ln + rn
+		case compiler.AugOpSub:
+			n = ln - rn
+		case compiler.AugOpMul:
+			n = ln * rn
+		default:
+			n = math.NaN()
+		}
+		if isSmallInt(n) {
+			return num(n), nil
+		}
+	}
+
+	lf, rf := p.toBig(l), p.toBig(r)
+	if lf == nil || rf == nil || lf.IsInf() || rf.IsInf() {
+		return floatArith(op, bigToFloat(lf), bigToFloat(rf))
+	}
+	if rf.Sign() == 0 {
+		switch op {
+		case compiler.AugOpDiv:
+			return null(), newError("division by zero")
+		case compiler.AugOpMod:
+			return null(), newError("division by zero in mod")
+		}
+	}
+
+	li, ri := bigInt(lf), bigInt(rf)
+	if li != nil && ri != nil {
+		switch op {
+		case compiler.AugOpAdd:
+			return bigNum(new(big.Float).SetInt(li.Add(li, ri))), nil
+		case compiler.AugOpSub:
+			return bigNum(new(big.Float).SetInt(li.Sub(li, ri))), nil
+		case compiler.AugOpMul:
+			return bigNum(new(big.Float).SetInt(li.Mul(li, ri))), nil
+		case compiler.AugOpDiv:
+			q, m := new(big.Int).QuoRem(li, ri, new(big.Int))
+			if m.Sign() == 0 {
+				return bigNum(new(big.Float).SetInt(q)), nil
+			}
+		case compiler.AugOpMod:
+			return bigNum(new(big.Float).SetInt(li.Rem(li, ri))), nil
+		case compiler.AugOpPow:
+			if ri.Sign() >= 0 && ri.IsInt64() && ri.Int64() <= maxExactPower {
+				return bigNum(new(big.Float).SetInt(li.Exp(li, ri, nil))), nil
+			}
+		}
+	}
+
+	z := p.newFloat()
+	switch op {
+	case compiler.AugOpAdd:
+		z.Add(lf, rf)
+	case compiler.AugOpSub:
+		z.Sub(lf, rf)
+	case compiler.AugOpMul:
+		z.Mul(lf, rf)
+	case compiler.AugOpDiv:
+		z.Quo(lf, rf)
+	case compiler.AugOpMod:
+		// Like math.Mod: l - trunc(l/r)*r, computing the quotient with
+		// enough precision to get its integer part exactly.
+		lExp, rExp := lf.MantExp(nil), rf.MantExp(nil)
+		prec := p.prec
+		if lExp > rExp {
+			prec += uint(lExp - rExp)
+		}
+		q := new(big.Float).SetPrec(prec).Quo(lf, rf)
+		qi, _ := q.Int(nil)
+		q.SetInt(qi).Mul(q, rf)
+		z.Sub(lf, q)
+	default: // AugOpPow
+		ri := bigInt(rf)
+		if ri == nil || !ri.IsInt64() {
+			// Non-integer powers (and huge ones) use float64.
+			return num(math.Pow(bigToFloat(lf), bigToFloat(rf))), nil
+		}
+		p.bigPow(z, lf, ri.Int64())
+	}
+	return bigNum(z), nil
+}
+
+// Set z to x**n using binary exponentiation.
+func (p *interp) bigPow(z, x *big.Float, n int64) {
+	neg := n < 0
+	if neg {
+		n = -n
+	}
+	base := p.newFloat().Set(x)
+	z.SetInt64(1)
+	for n > 0 {
+		if n&1 != 0 {
+			z.Mul(z, base)
+		}
+		base.Mul(base, base)
+		n >>= 1
+	}
+	if neg {
+		z.Quo(p.newFloat().SetInt64(1), z)
+	}
+}
+
+// Return the float64 nearest to f, or NaN if f is nil.
+func bigToFloat(f *big.Float) float64 {
+	if f == nil {
+		return math.NaN()
+	}
+	n, _ := f.Float64()
+	return n
+}
+
+// Add the constant amount to v (for increment and decrement).
+func (p *interp) bigAdd(v value, amount float64) value {
+	result, _ := p.bigArith(compiler.AugOpAdd, v, num(amount))
+	return result
+}
+
+// Return -v in bignum mode.
+func (p *interp) bigNeg(v value) value {
+	f := p.toBig(v)
+	if f == nil {
+		return num(math.NaN())
+	}
+	return bigNum(new(big.Float).Neg(f))
+}
+
+// Return v converted to a number in bignum mode (unary plus).
+func (p *interp) bigPlus(v value) value {
+	f := p.toBig(v)
+	if f == nil {
+		return num(math.NaN())
+	}
+	return bigNum(f)
+}
+
+// Truncate v towards zero in bignum mode (the int builtin).
+func (p *interp) bigTrunc(v value) value {
+	f := p.toBig(v)
+	if f == nil || f.IsInf() {
+		return num(float64(int(v.num())))
+	}
+	n, _ := f.Int(nil)
+	return bigNum(new(big.Float).SetInt(n))
+}
+
+// Return the square root of v in bignum mode.
+func (p *interp) bigSqrt(v value) value {
+	f := p.toBig(v)
+	if f == nil || f.IsInf() || f.Sign() < 0 {
+		return num(math.Sqrt(v.num()))
+	}
+	return bigNum(p.newFloat().Sqrt(f))
+}
+
+// Compare l and r numerically in bignum mode, returning values that compare
+// the same way as l and r (using the usual float64 comparison operators).
+// This lets the comparison instructions use their normal code.
+func (p *interp) bigCompare(l, r value) (float64, float64) {
+	ln, lok := fastNum(l)
+	rn, rok := fastNum(r)
+	if lok && rok {
+		// These compare the same way as their big.Floats (see floatToBig).
+		return ln, rn
+	}
+	lf, rf := p.toBig(l), p.toBig(r)
+	if lf == nil || rf == nil {
+		return math.NaN(), 0
+	}
+	return float64(lf.Cmp(rf)), 0
+}
+
+// Convert a number created by bigNum to a string for output or string
+// conversion (see value.str). Like float64 numbers, integers are a special
+// case and don't use floatFormat.
+func bigStr(s string, floatFormat string) string {
+	f := decodeBig(s)
+	if f.IsInt() {
+		return f.Text('f', 0)
+	}
+	return fmt.Sprintf(floatFormat, f)
+}
+
+// Convert a printf argument to a big.Int (for %d and similar) or big.Float
+// (for %f and similar) in bignum mode. NaN and infinity use the normal
+// float64 conversions.
+func (p *interp) bigFormatArg(v value, t byte) interface{} {
+	f := p.toBig(v)
+	if f == nil || f.IsInf() {
+		if t == 'f' {
+			return v.num()
+		}
+		return int(v.num())
+	}
+	if t == 'f' {
+		return f
+	}
+	n, _ := f.Int(nil)
+	return n
+}
+
+// Compile the program again without optimizations: constant folding uses
+// float64 arithmetic, and lint warnings are reported for the instructions
+// as written (superinstructions skip some of the checks).
+func (p *interp) compileUnoptimized() error {
+	program := *p.program
+	compiled, err := compiler.Compile(&program.ResolvedProgram, false)
+	if err != nil {
+		return err
+	}
+	program.Compiled = compiled
+	p.program = &program
+	p.functions = compiled.Functions
+	p.nums = compiled.Nums
+	p.strs = compiled.Strs
+	p.regexes = compiled.Regexes
+	p.literals = compiled.LiteralRegexes
+	return nil
+}
@@ -0,0 +1,84 @@
+// LRU cache for compiled regexes and parsed printf formats
+
+package interp
+
+import (
+	"container/list"
+)
+
+// lruCache is a cache of values keyed by string that evicts the least
+// recently used entry when it's full. It also counts hits and misses for
+// the execution profile.
+type lruCache struct {
+	maxSize int // zero or negative disables the cache
+	items   map[string]*list.Element
+	order   *list.List // of *lruEntry, most recently used at the front
+	hits    int64
+	misses  int64
+}
+
+type lruEntry struct {
+	key   string
+	value interface{}
+}
+
+func newLRUCache(maxSize int) *lruCache {
+	return &lruCache{
+		maxSize: maxSize,
+		items:   make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Return the cached value for key (marking it as recently used), and
+// report whether it was found.
+func (c *lruCache) get(key string) (interface{}, bool) {
+	elem, ok := c.items[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.order.MoveToFront(elem)
+	return elem.Value.(*lruEntry).value, true
+}
+
+// Add value to the cache under key, evicting the least recently used entry
+// if the cache is full.
+func (c *lruCache) add(key string, value interface{}) {
+	if c.maxSize <= 0 {
+		return
+	}
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*lruEntry).value = value
+		c.order.MoveToFront(elem)
+		return
+	}
+	if c.order.Len() >= c.maxSize {
+		// Reuse the oldest entry rather than allocating a new one
+		elem := c.order.Back()
+		entry := elem.Value.(*lruEntry)
+		delete(c.items, entry.key)
+		entry.key, entry.value = key, value
+		c.items[key] = elem
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.order.PushFront(&lruEntry{key, value})
+}
+
+// Change the maximum size of the cache, evicting the least recently used
+// entries if it's now too big.
+func (c *lruCache) setMaxSize(maxSize int) {
+	c.maxSize = maxSize
+	for c.order.Len() > 0 && c.order.Len() > maxSize {
+		elem := c.order.Back()
+		delete(c.items, elem.Value.(*lruEntry).key)
+		c.order.Remove(elem)
+	}
+}
+
+// Return the cache's hit and miss counts.
+func (c *lruCache) stats() CacheStats {
+	return CacheStats{Hits: c.hits, Misses: c.misses}
+}
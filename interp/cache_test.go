@@ -0,0 +1,43 @@
+// Tests for the LRU cache.
+
+package interp
+
+import (
+	"testing"
+)
+
+func TestLRUCache(t *testing.T) {
+	c := newLRUCache(2)
+	c.add("a", 1)
+	c.add("b", 2)
+	if v, ok := c.get("a"); !ok || v != 1 {
+		t.Fatalf("expected a=1, got %v %v", v, ok)
+	}
+	c.add("c", 3) // evicts b, the least recently used
+	if _, ok := c.get("b"); ok {
+		t.Fatalf("expected b to be evicted")
+	}
+	if v, ok := c.get("c"); !ok || v != 3 {
+		t.Fatalf("expected c=3, got %v %v", v, ok)
+	}
+	c.add("a", 4) // update existing entry
+	if v, ok := c.get("a"); !ok || v != 4 {
+		t.Fatalf("expected a=4, got %v %v", v, ok)
+	}
+	if stats := c.stats(); stats != (CacheStats{Hits: 3, Misses: 1}) {
+		t.Fatalf("expected 3 hits and 1 miss, got %+v", stats)
+	}
+
+	c.setMaxSize(1) // evicts c
+	if _, ok := c.get("c"); ok {
+		t.Fatalf("expected c to be evicted")
+	}
+	c.setMaxSize(0) // disables cache
+	c.add("d", 5)
+	if _, ok := c.get("d"); ok {
+		t.Fatalf("expected d not to be cached")
+	}
+	if len(c.items) != 0 || c.order.Len() != 0 {
+		t.Fatalf("expected empty cache, got %d items", len(c.items))
+	}
+}
@@ -0,0 +1,196 @@
+// Running shell commands for system(), pipes, and coprocesses
+
+package interp
+
+import (
+	"context"
+	"io"
+	"os/exec"
+	"sort"
+
+	"github.com/benhoyt/goawk/internal/resolver"
+)
+
+// CommandRunner starts the commands run by an AWK program: system(cmd),
+// output pipes (print | cmd), input pipes (cmd | getline), and coprocesses
+// (print |& cmd and cmd |& getline). Set Config.CommandRunner to control
+// how (or whether) commands are run, for example to check commands against
+// an allowlist, or to use an in-process fake in tests.
+type CommandRunner interface {
+	// Start starts running cmd and returns the running process. If Start
+	// returns an error, the error message is written to Config.Error and
+	// the AWK program continues as if the command had failed (for
+	// example, system returns -1).
+	//
+	// The context is the one passed to ExecuteContext (or
+	// context.Background if none was passed).
+	Start(ctx context.Context, cmd *Command) (Process, error)
+}
+
+// Command is a command to be started by a CommandRunner.
+type Command struct {
+	// Line is the command line, for example "sort -n" in print | "sort -n".
+	Line string
+
+	// Stdin is the command's standard input. If nil, the process must
+	// provide a pipe for writing to the command's input (Process.Stdin).
+	Stdin io.Reader
+
+	// Stdout is the command's standard output. If nil, the process must
+	// provide a pipe for reading the command's output (Process.Stdout).
+	Stdout io.Writer
+
+	// Stderr is the command's standard error (always set).
+	Stderr io.Writer
+
+	// Env is the command's environment as "key=value" strings, taken from
+	// the AWK program's ENVIRON array (so that assignments to ENVIRON are
+	// passed on to commands). It's nil if the program hasn't changed
+	// ENVIRON, meaning the command inherits the current process's
+	// environment.
+	Env []string
+}
+
+// Process is a command started by a CommandRunner.
+type Process interface {
+	// Stdin returns the pipe connected to the command's standard input.
+	// It's only called if Command.Stdin was nil.
+	Stdin() io.WriteCloser
+
+	// Stdout returns the pipe connected to the command's standard output.
+	// It's only called if Command.Stdout was nil.
+	Stdout() io.ReadCloser
+
+	// Wait waits for the command to exit and returns its exit status.
+	// Wait is only called after the Stdin pipe (if any) has been closed.
+	// An error means the command's exit status couldn't be determined.
+	Wait() (int, error)
+}
+
+// ShellRunner is the default CommandRunner. It runs each command line
+// using the system shell.
+type ShellRunner struct {
+	// Exec args used to run the system shell, with the command line
+	// appended. If nil, {"/bin/sh", "-c"} is used ("sh" on Windows).
+	Shell []string
+}
+
+// Start implements CommandRunner.Start.
+func (r *ShellRunner) Start(ctx context.Context, cmd *Command) (Process, error) {
+	shell := r.Shell
+	if len(shell) == 0 {
+		shell = defaultShellCommand
+	}
+	args := append(shell[1:len(shell):len(shell)], cmd.Line)
+	c := exec.CommandContext(ctx, shell[0], args...)
+	c.Stdin = cmd.Stdin
+	c.Stdout = cmd.Stdout
+	c.Stderr = cmd.Stderr
+	c.Env = cmd.Env
+	process := &shellProcess{cmd: c}
+	var err error
+	if cmd.Stdin == nil {
+		process.stdin, err = c.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cmd.Stdout == nil {
+		process.stdout, err = c.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = c.Start()
+	if err != nil {
+		return nil, err
+	}
+	return process, nil
+}
+
+type shellProcess struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+}
+
+func (p *shellProcess) Stdin() io.WriteCloser { return p.stdin }
+func (p *shellProcess) Stdout() io.ReadCloser { return p.stdout }
+
+func (p *shellProcess) Wait() (int, error) {
+	err := p.cmd.Wait()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return exitErr.ProcessState.ExitCode(), nil
+		}
+		return -1, err
+	}
+	return 0, nil
+}
+
+// If name is a command started by an input or output pipe, wait for it to
+// exit, and record and return its exit status.
+func (p *interp) waitCommand(name string) int {
+	process, ok := p.commands[name]
+	if !ok {
+		return 0
+	}
+	delete(p.commands, name)
+	return p.setCommandStatus(process.Wait())
+}
+
+// Set PROCINFO["status"] to the exit status of the most recently finished
+// command (or -1 and ERRNO if it couldn't be determined), and return it.
+func (p *interp) setCommandStatus(status int, err error) int {
+	if err != nil {
+		p.errno = err.Error()
+		status = -1
+	}
+	p.setProcinfo("status", num(float64(status)))
+	return status
+}
+
+// Start a command using the configured CommandRunner.
+func (p *interp) startCommand(cmd *Command) (Process, error) {
+	ctx := context.Background()
+	if p.checkCtx {
+		ctx = p.ctx
+	}
+	cmd.Env = p.commandEnviron()
+	return p.commandRunner.Start(ctx, cmd)
+}
+
+// Return the environment for commands from the ENVIRON array, sorted by
+// key, or nil if the program hasn't changed ENVIRON (so that commands
+// inherit the process environment, as they did before ENVIRON was passed
+// on).
+func (p *interp) commandEnviron() []string {
+	environ := p.array(resolver.Global, p.arrayIndexes["ENVIRON"])
+	if p.environUnchanged(environ) {
+		return nil
+	}
+	keys := make([]string, 0, len(environ))
+	for k := range environ {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	env := make([]string, len(keys))
+	for i, k := range keys {
+		env[i] = k + "=" + p.toString(environ[k])
+	}
+	return env
+}
+
+// Report whether the ENVIRON array still has exactly its initial contents.
+func (p *interp) environUnchanged(environ map[string]value) bool {
+	if len(environ) != len(p.startEnviron) {
+		return false
+	}
+	for k, v := range environ {
+		start, ok := p.startEnviron[k]
+		if !ok || p.toString(v) != start {
+			return false
+		}
+	}
+	return true
+}
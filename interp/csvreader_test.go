@@ -4,7 +4,7 @@
 // However, the §, ¶ and ∑ special characters (for error positions) have been
 // removed, and some tests have been removed or tweaked slightly because we
 // don't support all the encoding/csv features (FieldsPerRecord is not
-// supported, LazyQuotes is always on, and TrimLeadingSpace is always off).
+// supported, and LazyQuotes is always on).
 
 package interp
 
@@ -24,8 +24,9 @@ type readTest struct {
 	Error  string
 
 	// These fields are copied into the CSVInputConfig
-	Comma   rune
-	Comment rune
+	Comma            rune
+	Comment          rune
+	TrimLeadingSpace bool
 }
 
 var readTests = []readTest{{
@@ -110,9 +111,15 @@ field"`,
 	Input:  `a""b,c`,
 	Output: [][]string{{`a""b`, `c`}},
 }, {
-	Name:   "TrimQuote",
-	Input:  `"a"," b",c`,
-	Output: [][]string{{"a", " b", "c"}},
+	Name:             "TrimSpace",
+	Input:            " a,  b,   c\n",
+	Output:           [][]string{{"a", "b", "c"}},
+	TrimLeadingSpace: true,
+}, {
+	Name:             "TrimQuote",
+	Input:            ` "a"," b",c`,
+	Output:           [][]string{{"a", " b", "c"}},
+	TrimLeadingSpace: true,
 }, {
 	Name:   "FieldCount",
 	Input:  "a,b,c\nd,e",
@@ -133,6 +140,16 @@ field"`,
 	Name:   "TrailingCommaSpaceEOL",
 	Input:  "a,b,c, \n",
 	Output: [][]string{{"a", "b", "c", " "}},
+}, {
+	Name:             "TrailingCommaSpaceEOFTrim",
+	Input:            "a,b,c, ",
+	Output:           [][]string{{"a", "b", "c", ""}},
+	TrimLeadingSpace: true,
+}, {
+	Name:             "TrailingCommaSpaceEOLTrim",
+	Input:            "a,b,c, \n",
+	Output:           [][]string{{"a", "b", "c", ""}},
+	TrimLeadingSpace: true,
 }, {
 	Name:   "TrailingCommaLine3",
 	Input:  "a,b,c\nd,e,f\ng,hi,",
@@ -320,8 +337,9 @@ func TestCSVReader(t *testing.T) {
 	for _, tt := range readTests {
 		t.Run(tt.Name, func(t *testing.T) {
 			inputConfig := CSVInputConfig{
-				Separator: tt.Comma,
-				Comment:   tt.Comment,
+				Separator:        tt.Comma,
+				Comment:          tt.Comment,
+				TrimLeadingSpace: tt.TrimLeadingSpace,
 			}
 			if inputConfig.Separator == 0 {
 				inputConfig.Separator = ','
@@ -330,20 +348,21 @@ func TestCSVReader(t *testing.T) {
 			var out [][]string
 			err := validateCSVInputConfig(CSVMode, inputConfig)
 			if err == nil {
-				var fields []string
+				var record csvRecord
 				splitter := csvSplitter{
 					separator: inputConfig.Separator,
 					sepLen:    utf8.RuneLen(inputConfig.Separator),
 					comment:   inputConfig.Comment,
-					fields:    &fields,
+					trimSpace: inputConfig.TrimLeadingSpace,
+					maxField:  -1,
+					record:    &record,
 				}
 				scanner := bufio.NewScanner(strings.NewReader(tt.Input))
 				scanner.Split(splitter.scan)
 				scanner.Buffer(make([]byte, inputBufSize), maxRecordLength)
 
 				for scanner.Scan() {
-					row := make([]string, len(fields))
-					copy(row, fields)
+					row := record.appendFields([]string{}, scanner.Text())
 					out = append(out, row)
 
 					// We don't explicitly check the returned token, but at
@@ -356,6 +375,7 @@ func TestCSVReader(t *testing.T) {
 					reader := csv.NewReader(strings.NewReader(token))
 					reader.Comma = inputConfig.Separator
 					reader.Comment = inputConfig.Comment
+					reader.TrimLeadingSpace = inputConfig.TrimLeadingSpace
 					reader.FieldsPerRecord = -1
 					reader.LazyQuotes = true
 					tokenRow, err := reader.Read()
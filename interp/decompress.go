@@ -0,0 +1,110 @@
+// Transparent decompression of gzip, bzip2, and zlib input files
+
+package interp
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"os"
+)
+
+// Open an input file for reading. If Config.Decompress is set and the file
+// is compressed (detected by its magic number, not its name), the returned
+// reader decompresses it.
+func (p *interp) openInputFile(name string) (io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if !p.decompress {
+		return f, nil
+	}
+	r, err := newDecompressReader(f)
+	if err != nil {
+		_ = f.Close()
+		// Treat a bad header like an open error, so that getline returns
+		// -1 and sets ERRNO.
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	return r, nil
+}
+
+// Wrap file in a decompressing reader if it starts with a gzip, bzip2, or
+// zlib header, otherwise return it as is (but buffered).
+func newDecompressReader(file io.ReadCloser) (io.ReadCloser, error) {
+	br := bufio.NewReader(file)
+	magic, _ := br.Peek(4) // short files can't be compressed, ignore error
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return &decompressReader{Reader: zr, decompressor: zr, file: file}, nil
+	case isBzip2Header(magic):
+		return &decompressReader{Reader: bzip2.NewReader(br), file: file}, nil
+	case isZlibHeader(magic) && isZlibData(br):
+		zr, err := zlib.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return &decompressReader{Reader: zr, decompressor: zr, file: file}, nil
+	default:
+		return &decompressReader{Reader: br, file: file}, nil
+	}
+}
+
+// Report whether b starts with a bzip2 header: "BZh" followed by the
+// block size, '1' to '9'.
+func isBzip2Header(b []byte) bool {
+	return len(b) >= 4 && bytes.HasPrefix(b, []byte("BZh")) && b[3] >= '1' && b[3] <= '9'
+}
+
+// Report whether b starts with a zlib header (RFC 1950): deflate
+// compression with a window of at most 32KB, no preset dictionary, and a
+// valid header checksum.
+func isZlibHeader(b []byte) bool {
+	if len(b) < 2 {
+		return false
+	}
+	cmf, flg := b[0], b[1]
+	return cmf&0x0f == 8 && cmf>>4 <= 7 && flg&0x20 == 0 &&
+		(uint(cmf)<<8|uint(flg))%31 == 0
+}
+
+// Report whether the start of br's data decompresses as zlib. The header
+// check is only 2 bytes, and plain text such as "x^" passes it, so try
+// reading the first byte of (buffered) data before treating it as zlib.
+func isZlibData(br *bufio.Reader) bool {
+	data, _ := br.Peek(br.Size()) // may be less at EOF, ignore error
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return false
+	}
+	_, err = zr.Read(make([]byte, 1))
+	return err == nil || err == io.EOF
+}
+
+// decompressReader reads (possibly decompressed) data from a file, and
+// closes both the decompressor and the file when it's closed.
+type decompressReader struct {
+	io.Reader
+	decompressor io.Closer // nil if there's nothing to close
+	file         io.Closer
+}
+
+func (r *decompressReader) Close() error {
+	var err error
+	if r.decompressor != nil {
+		err = r.decompressor.Close()
+	}
+	fileErr := r.file.Close()
+	if err == nil {
+		err = fileErr
+	}
+	return err
+}
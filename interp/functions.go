@@ -316,8 +316,9 @@ type cachedFormat struct {
 // type conversion specifiers. Output is memoized in a simple cache
 // for performance.
 func (p *interp) parseFmtTypes(s string) (format string, types []byte, err error) {
-	if item, ok := p.formatCache[s]; ok {
-		return item.format, item.types, nil
+	if item, ok := p.formatCache.get(s); ok {
+		cached := item.(cachedFormat)
+		return cached.format, cached.types, nil
 	}
 
 	out := []byte(s)
@@ -343,8 +344,11 @@ func (p *interp) parseFmtTypes(s string) (format string, types []byte, err error
 			switch s[i] {
 			case 's':
 				t = 's'
-			case 'd', 'i', 'o', 'x', 'X':
+			case 'd', 'o', 'x', 'X':
 				t = 'd'
+			case 'i':
+				t = 'd'
+				out[i] = 'd' // Go's fmt doesn't support %i
 			case 'f', 'e', 'E', 'g', 'G':
 				t = 'f'
 			case 'u':
@@ -360,11 +364,8 @@ func (p *interp) parseFmtTypes(s string) (format string, types []byte, err error
 		}
 	}
 
-	// Dumb, non-LRU cache: just cache the first N formats
 	format = string(out)
-	if len(p.formatCache) < maxCachedFormats {
-		p.formatCache[s] = cachedFormat{format, types}
-	}
+	p.formatCache.add(s, cachedFormat{format, types})
 	return format, types, nil
 }
 
@@ -380,6 +381,10 @@ func (p *interp) sprintf(format string, args []value) (string, error) {
 	converted := make([]interface{}, 0, 7) // up to 7 args won't require heap allocation
 	for i, t := range types {
 		a := args[i]
+		if p.bignum && (t == 'd' || t == 'u' || t == 'f') {
+			converted = append(converted, p.bigFormatArg(a, t))
+			continue
+		}
 		var v interface{}
 		switch t {
 		case 's':
@@ -73,3 +73,26 @@ func parseFloatHelper(s string) (float64, error) {
 	}
 	return strconv.ParseFloat(s, 64)
 }
+
+func FuzzAppendFieldsN(f *testing.F) {
+	f.Add("", 1)
+	f.Add("a b c", 2)
+	f.Add("  a\tb  c  ", 3)
+	f.Add("é a\u00a0b\u2003c", 3)
+	f.Add("a\xffb c", 1)
+	f.Add("a b c", 0)
+
+	f.Fuzz(func(t *testing.T, in string, n int) {
+		if n < 0 {
+			return
+		}
+		expected := strings.Fields(in)
+		if len(expected) > n {
+			expected = expected[:n]
+		}
+		fields := appendFieldsN(nil, in, n)
+		if strings.Join(fields, "|") != strings.Join(expected, "|") || len(fields) != len(expected) {
+			t.Fatalf("appendFieldsN(%q, %d) = %q, expected %q", in, n, fields, expected)
+		}
+	})
+}
@@ -0,0 +1,96 @@
+// In-place editing of input files (Config.InPlace)
+
+package interp
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// An input file being edited in place: output is written to a temporary
+// file in the same directory, which replaces the original file when it's
+// finished.
+type inPlaceFile struct {
+	name   string
+	temp   *os.File
+	writer *bufio.Writer
+	output io.Writer // output to restore when finished
+}
+
+// Start editing the named input file in place, redirecting output to a
+// temporary file. Files that aren't regular files are left alone.
+func (p *interp) startInPlace(name string) error {
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		p.printErrorf("can't edit %q in place: not a regular file\n", name)
+		return nil
+	}
+	temp, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".goawk")
+	if err != nil {
+		return err
+	}
+	err = temp.Chmod(info.Mode().Perm())
+	if err != nil {
+		_ = temp.Close()
+		_ = os.Remove(temp.Name())
+		return err
+	}
+	p.flushOutputAndError() // so earlier output isn't written to the file
+	p.inPlace = &inPlaceFile{
+		name:   name,
+		temp:   temp,
+		writer: bufio.NewWriterSize(temp, outputBufSize),
+		output: p.output,
+	}
+	p.output = p.inPlace.writer
+	return nil
+}
+
+// Finish editing the current in-place file (if any): restore the original
+// output and atomically replace the file with the new contents, first
+// linking the original to name+suffix if a backup suffix is set.
+func (p *interp) finishInPlace() error {
+	f := p.inPlace
+	if f == nil {
+		return nil
+	}
+	p.inPlace = nil
+	p.output = f.output
+	err := f.writer.Flush()
+	closeErr := f.temp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil && p.inPlaceSuffix != "" {
+		backup := f.name + p.inPlaceSuffix
+		_ = os.Remove(backup)
+		err = os.Link(f.name, backup)
+	}
+	if err == nil {
+		err = os.Rename(f.temp.Name(), f.name)
+	}
+	if err != nil {
+		_ = os.Remove(f.temp.Name())
+		return err
+	}
+	return nil
+}
+
+// Stop editing the current in-place file (if any) without changing it,
+// for example if the program exits with an error.
+func (p *interp) abortInPlace() {
+	f := p.inPlace
+	if f == nil {
+		return
+	}
+	p.inPlace = nil
+	p.output = f.output
+	_ = f.temp.Close()
+	_ = os.Remove(f.temp.Name())
+}
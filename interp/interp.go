@@ -19,9 +19,9 @@ import (
 	"io"
 	"io/ioutil"
 	"math"
+	"math/big"
 	"math/rand"
 	"os"
-	"os/exec"
 	"regexp"
 	"runtime"
 	"strconv"
@@ -31,6 +31,7 @@ import (
 	"github.com/benhoyt/goawk/internal/ast"
 	"github.com/benhoyt/goawk/internal/compiler"
 	"github.com/benhoyt/goawk/internal/resolver"
+	"github.com/benhoyt/goawk/lexer"
 	"github.com/benhoyt/goawk/parser"
 )
 
@@ -50,16 +51,44 @@ var (
 
 // Error (actually *Error) is returned by Exec and Eval functions on
 // interpreter error, for example FS being set to an invalid regex.
+//
+// The Error method returns just the error message. Runtime errors that
+// occur while executing the program also include the source position of
+// the failing instruction and the stack of function calls active at the
+// time (the goawk command reports these with the source line).
 type Error struct {
 	message string
+	err     error // underlying error, if any (see Unwrap)
+
+	// Source position of the instruction that caused the error, or the
+	// zero value if not known (for example, for errors that occur while
+	// processing the Config). This is the position in the program source
+	// passed to the parser.
+	Position lexer.Position
+
+	// User-defined function calls that were active when the error occurred,
+	// innermost call first.
+	Stack []Frame
+}
+
+// Frame is a function call in the call stack of an Error.
+type Frame struct {
+	Function string         // name of the function that was called
+	Position lexer.Position // source position of the call
 }
 
 func (e *Error) Error() string {
 	return e.message
 }
 
+// Unwrap returns the underlying error, for example the error returned by a
+// native Go function (see Config.Funcs), or nil if there isn't one.
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
 func newError(format string, args ...interface{}) error {
-	return &Error{fmt.Sprintf(format, args...)}
+	return &Error{message: fmt.Sprintf(format, args...)}
 }
 
 type returnValue struct {
@@ -79,16 +108,26 @@ type interp struct {
 	stdin         io.Reader
 	filenameIndex int
 	hadFiles      bool
+	inFile        bool // true between BEGINFILE and ENDFILE of an input file
 	input         io.Reader
 	inputBuffer   []byte
 	inputStreams  map[string]io.ReadCloser
 	outputStreams map[string]io.WriteCloser
-	commands      map[string]*exec.Cmd
+	commands      map[string]Process
+	coprocesses   map[string]*coprocess
 	noExec        bool
 	noFileWrites  bool
 	noFileReads   bool
-	shellCommand  []string
+	noNetwork     bool
+	decompress    bool
+	inPlaceEdit   bool
+	inPlaceSuffix string
+	inPlace       *inPlaceFile // input file currently being edited in place
+	commandRunner CommandRunner
+	startEnviron  map[string]string // initial ENVIRON, to detect changes
 	csvOutput     *bufio.Writer
+	rowHeaderDone bool // true after printrow has printed its header row
+	outHeaderDone bool // true after the "header" output option has printed it
 	noArgVars     bool
 
 	// Scalars, arrays, and function state
@@ -116,6 +155,12 @@ type interp struct {
 	fieldNames      []string
 	fieldIndexes    map[string]int
 	reparseCSV      bool
+	lineRecord      csvRecord   // CSV or TSV fields of the current line
+	scanRecord      csvRecord   // fields of the record last read from main input
+	maxField        int         // highest field the program uses (see compiler.Program.MaxField)
+	lineStream      *streamMode // stream line was read from, if it has its own mode
+	getlineStream   *streamMode // set by getline to the stream it read from
+	streamModes     map[string]*streamMode
 
 	// Built-in variables
 	argc             int
@@ -126,6 +171,7 @@ type interp struct {
 	recordSep        string
 	recordSepRegex   *regexp.Regexp
 	recordTerminator string
+	errno            string
 	outputFieldSep   string
 	outputRecordSep  string
 	subscriptSep     string
@@ -135,13 +181,22 @@ type interp struct {
 	csvInputConfig   CSVInputConfig
 	outputMode       IOMode
 	csvOutputConfig  CSVOutputConfig
+	prec             uint
+	roundMode        big.RoundingMode
+	precVar          value // PREC and ROUNDMODE are ordinary variables
+	roundModeVar     value // when not in bignum mode
 
 	// Parsed program, compiled functions and constants
 	program   *parser.Program
 	functions []compiler.Function
 	nums      []float64
+	bigNums   []value // nums with exact literal values, in bignum mode
 	strs      []string
 	regexes   []*regexp.Regexp
+	literals  []compiler.LiteralRegex
+
+	// CONVFMT used to build the compiler's folded ConvertedStrs in strs
+	convertedFormat string
 
 	// Context support (for Interpreter.ExecuteContext)
 	checkCtx bool
@@ -153,22 +208,37 @@ type interp struct {
 	random           *rand.Rand
 	randSeed         float64
 	exitStatus       int
-	regexCache       map[string]*regexp.Regexp
-	formatCache      map[string]cachedFormat
+	regexCache       *lruCache // of *regexp.Regexp
+	formatCache      *lruCache // of cachedFormat
 	csvJoinFieldsBuf bytes.Buffer
+	bignum           bool // arbitrary-precision arithmetic (see bignum.go)
+
+	// Lint warnings and source positions
+	lint         bool
+	lintMaxFiles int
+	lintWarned   map[lintKey]bool
+	sourceLine   func(line int) (string, int)
+
+	// Execution profiling (Config.Profiling)
+	profiling     bool
+	profileBlocks [][]profileCounter
+	profileCode   map[*compiler.Opcode][]profileCounter // cache for profileCounters
+	profileCalls  []int64
+	profileTick   int32 // set to 1 by sampler goroutine (accessed atomically)
 }
 
 // Various const configuration. Could make these part of Config if
 // we wanted to, but no need for now.
 const (
-	maxCachedRegexes = 100
-	maxCachedFormats = 100
-	maxRecordLength  = 10 * 1024 * 1024 // 10MB seems like plenty
-	maxFieldIndex    = 1000000
-	maxCallDepth     = 1000
-	initialStackSize = 100
-	outputBufSize    = 64 * 1024
-	inputBufSize     = 64 * 1024
+	defaultRegexCacheSize  = 100
+	defaultFormatCacheSize = 100
+	maxRecordLength        = 10 * 1024 * 1024 // 10MB seems like plenty
+	maxFieldIndex          = 1000000
+	maxCallDepth           = 1000
+	defaultLintFiles       = 100
+	initialStackSize       = 100
+	outputBufSize          = 64 * 1024
+	inputBufSize           = 64 * 1024
 )
 
 // Config defines the interpreter configuration for ExecProgram.
@@ -188,8 +258,8 @@ type Config struct {
 	Argv0 string
 
 	// Input arguments (usually filenames): empty slice means read
-	// only from Stdin, and a filename of "-" means read from Stdin
-	// instead of a real file.
+	// only from Stdin, and a filename of "-" (or "/dev/stdin") means
+	// read from Stdin instead of a real file.
 	//
 	// Arguments of the form "var=value" are treated as variable
 	// assignments.
@@ -230,32 +300,68 @@ type Config struct {
 	// Set one or more of these to true to prevent unsafe behaviours,
 	// useful when executing untrusted scripts:
 	//
-	// * NoExec prevents system calls via system() or pipe operator
+	// * NoExec prevents system calls via system() or pipe operators ('|' and '|&')
 	// * NoFileWrites prevents writing to files via '>' or '>>'
 	// * NoFileReads prevents reading from files via getline or the
 	//   filenames in Args
+	//
+	// The special files "/dev/stdout", "/dev/stderr", and "/dev/stdin" (and
+	// "-") always refer to Output, Error, and Stdin, so they're allowed even
+	// with NoFileWrites and NoFileReads set.
 	NoExec       bool
 	NoFileWrites bool
 	NoFileReads  bool
 
+	// Set to true to prevent network I/O via the "/inet/tcp/..." and
+	// "/inet/udp/..." special files. This is implied by NoExec,
+	// NoFileWrites, and NoFileReads, so that scripts sandboxed with those
+	// can't use the network either.
+	NoNetwork bool
+
+	// Set to true to transparently decompress input files (the filenames
+	// in Args and files read with getline) that are compressed with gzip,
+	// bzip2, or zlib. Compression is detected using the file's magic
+	// number, not its name; other files are read as is.
+	Decompress bool
+
+	// Set InPlace to true to edit the input files in Args in place: output
+	// written while reading each file (including by BEGINFILE) goes to a
+	// temporary file that replaces the original when the file is finished.
+	// If InPlaceSuffix is set, the original is kept as a backup with that
+	// suffix added to its name, for example ".bak". Output in BEGIN, END,
+	// and ENDFILE goes to Output as usual.
+	InPlace       bool
+	InPlaceSuffix string
+
 	// Exec args used to run system shell. Typically, this will
 	// be {"/bin/sh", "-c"}
 	ShellCommand []string
 
+	// Runs the commands for system(), pipes, and coprocesses. If nil,
+	// commands are run using the system shell (see ShellRunner and
+	// ShellCommand). NoExec takes precedence over this.
+	CommandRunner CommandRunner
+
 	// List of name-value pairs to be assigned to the ENVIRON special
 	// array, for example []string{"USER", "bob", "HOME", "/home/bob"}.
 	// If nil (the default), values from os.Environ() are used.
 	//
 	// If the script doesn't need environment variables, set Environ to a
 	// non-nil empty slice, []string{}.
+	//
+	// Commands run by system(), pipes, and coprocesses inherit the
+	// process's environment (os.Environ()) unless the script changes
+	// ENVIRON, in which case they get exactly the contents of ENVIRON.
+	// So with a non-nil Environ, a script that assigns to ENVIRON should
+	// also set any variables its commands need, such as PATH.
 	Environ []string
 
 	// Mode for parsing input fields and record: default is to use normal FS
 	// and RS behaviour. If set to CSVMode or TSVMode, FS and RS are ignored,
 	// and input records are parsed as comma-separated values or tab-separated
 	// values, respectively. Parsing is done as per RFC 4180 and the
-	// "encoding/csv" package, but FieldsPerRecord is not supported,
-	// LazyQuotes is always on, and TrimLeadingSpace is always off.
+	// "encoding/csv" package, but FieldsPerRecord is not supported, and
+	// LazyQuotes is always on.
 	//
 	// You can also enable CSV or TSV input mode by setting INPUTMODE to "csv"
 	// or "tsv" in Vars or in the BEGIN block (those override this setting).
@@ -293,6 +399,63 @@ type Config struct {
 	//
 	//     BEGIN { OUTPUTMODE="csv separator=|" }
 	CSVOutput CSVOutputConfig
+
+	// Set to true to enable runtime "lint" checks, which write a warning
+	// (prefixed with its source position) to Error when the program:
+	//
+	// * reads a variable that has never been assigned
+	// * accesses a field past NF, for example $5 when NF is 3
+	// * compares a string to a number, which is done as a string comparison
+	// * divides by zero in a non-fatal context, such as 0 ^ -1
+	// * has more than LintMaxFiles files and pipes open at once
+	//
+	// Each warning is only reported once per source position.
+	Lint bool
+
+	// Number of open files and pipes above which Lint reports a warning. If
+	// zero, the default is 100.
+	LintMaxFiles int
+
+	// Optional function to map a line number in the program source to a
+	// filename and the line number within that file, used when reporting
+	// source positions. This is useful when the program source is the
+	// concatenation of several files, for example multiple -f arguments.
+	SourceLine func(line int) (path string, fileLine int)
+
+	// Set to true to collect an execution profile of the AWK program: how
+	// many times each source line and function was executed, and roughly
+	// how long was spent in each. Use New and Interpreter.Execute to run the
+	// program, and then Interpreter.Profile to fetch the results. Profiling
+	// slows down execution significantly.
+	Profiling bool
+
+	// Maximum number of dynamic regexes (like re in $0 ~ re) and printf
+	// format strings to cache after compiling or parsing them. When a cache
+	// is full, the least recently used entry is evicted. Zero means the
+	// default size (100), and a negative size disables the cache. Cache hits
+	// and misses are included in the execution profile (see Profiling).
+	RegexCacheSize  int
+	FormatCacheSize int
+
+	// Set to true to use arbitrary-precision arithmetic (using math/big)
+	// instead of float64. Arithmetic on integers is exact, and other
+	// results are rounded to PREC bits (default 53, or a name like "quad")
+	// using ROUNDMODE ("N" for round to nearest even, the default, or "Z",
+	// "U", "D", or "A" to round towards zero, positive infinity, negative
+	// infinity, or away from zero). PREC and ROUNDMODE can be set in Vars
+	// or by the program; when Bignum isn't set, they're ordinary variables
+	// like in other AWKs. Numbers in input and strings are converted
+	// exactly, and printf's integer and floating point formats use the
+	// full precision.
+	//
+	// Number literals in the program source are converted from their
+	// source text, so integer literals like 12345678901234567890 are exact.
+	// Functions other than int and sqrt use float64.
+	//
+	// Constant folding uses float64 arithmetic, so if the program was
+	// parsed with optimizations enabled, it's compiled again without them
+	// (set parser.ParserConfig.NoOptimize to avoid this).
+	Bignum bool
 }
 
 // IOMode specifies the input parsing or print output mode.
@@ -325,6 +488,16 @@ type CSVInputConfig struct {
 	// is, a list of field names), and enable the @"field" syntax to get a
 	// field by name as well as the FIELDS special array.
 	Header bool
+
+	// If set, use these field names for the @"field" syntax and the FIELDS
+	// array, for input files that don't have a header row. If Header is
+	// also true, the header row in each file is skipped, and its fields are
+	// renamed to these names.
+	HeaderNames []string
+
+	// If true, leading whitespace in a field is ignored (other than the
+	// separator character, so this can be used with TSV input).
+	TrimLeadingSpace bool
 }
 
 // CSVOutputConfig holds additional configuration for when OutputMode is
@@ -333,6 +506,11 @@ type CSVOutputConfig struct {
 	// Output field separator character. If this is zero, it defaults to ','
 	// when OutputMode is CSVMode and '\t' when OutputMode is TSVMode.
 	Separator rune
+
+	// If true, print the input's header row (the field names parsed when
+	// CSVInputConfig.Header is set) before the first record that's printed
+	// to Output.
+	Header bool
 }
 
 // ExecProgram executes the parsed program using the given interpreter
@@ -359,6 +537,11 @@ func newInterp(program *parser.Program) *interp {
 		nums:      program.Compiled.Nums,
 		strs:      program.Compiled.Strs,
 		regexes:   program.Compiled.Regexes,
+		literals:  program.Compiled.LiteralRegexes,
+	}
+	if len(program.Compiled.ConvertedStrs) > 0 {
+		// Copy the string constants, as updateConvertedStrs changes them.
+		p.strs = append([]string(nil), p.strs...)
 	}
 
 	// Allocate memory for variables and virtual machine stack
@@ -379,13 +562,16 @@ func newInterp(program *parser.Program) *interp {
 	}
 
 	// Initialize defaults
-	p.regexCache = make(map[string]*regexp.Regexp, 10)
-	p.formatCache = make(map[string]cachedFormat, 10)
+	p.regexCache = newLRUCache(defaultRegexCacheSize)
+	p.formatCache = newLRUCache(defaultFormatCacheSize)
 	p.randSeed = 1.0
 	seed := math.Float64bits(p.randSeed)
 	p.random = rand.New(rand.NewSource(int64(seed)))
 	p.convertFormat = "%.6g"
+	p.convertedFormat = "%.6g"
 	p.outputFormat = "%.6g"
+	p.prec = defaultPrec
+	p.roundMode = big.ToNearestEven
 	p.fieldSep = " "
 	p.recordSep = "\n"
 	p.outputFieldSep = " "
@@ -394,7 +580,9 @@ func newInterp(program *parser.Program) *interp {
 
 	p.inputStreams = make(map[string]io.ReadCloser)
 	p.outputStreams = make(map[string]io.WriteCloser)
-	p.commands = make(map[string]*exec.Cmd)
+	p.commands = make(map[string]Process)
+	p.coprocesses = make(map[string]*coprocess)
+	p.streamModes = make(map[string]*streamMode)
 	p.scanners = make(map[string]*bufio.Scanner)
 
 	return p
@@ -424,7 +612,8 @@ func (p *interp) setExecuteConfig(config *Config) error {
 			p.csvInputConfig.Separator = '\t'
 		}
 	case DefaultMode:
-		if p.csvInputConfig != (CSVInputConfig{}) {
+		c := p.csvInputConfig
+		if c.Separator != 0 || c.Comment != 0 || c.Header || c.HeaderNames != nil || c.TrimLeadingSpace {
 			return newError("input mode configuration not valid in default input mode")
 		}
 	}
@@ -445,6 +634,20 @@ func (p *interp) setExecuteConfig(config *Config) error {
 		}
 	}
 
+	// Set up arbitrary-precision arithmetic (before Vars, which may set
+	// PREC and ROUNDMODE). Bignum and lint both need the program compiled
+	// without optimizations.
+	p.bignum = config.Bignum
+	if (p.bignum || config.Lint) && p.program.Compiled.Optimized {
+		err := p.compileUnoptimized()
+		if err != nil {
+			return err
+		}
+	}
+	if p.bignum {
+		p.bigNums = p.bigConstants()
+	}
+
 	// Set up ARGV and other variables from config
 	argvIndex := p.arrayIndexes["ARGV"]
 	p.setArrayValue(resolver.Global, argvIndex, "0", str(config.Argv0))
@@ -455,6 +658,7 @@ func (p *interp) setExecuteConfig(config *Config) error {
 	p.noArgVars = config.NoArgVars
 	p.filenameIndex = 1
 	p.hadFiles = false
+	p.inFile = false
 	for i := 0; i < len(config.Vars); i += 2 {
 		err := p.setVarByName(config.Vars[i], config.Vars[i+1])
 		if err != nil {
@@ -467,6 +671,7 @@ func (p *interp) setExecuteConfig(config *Config) error {
 	if err != nil {
 		return err
 	}
+	p.setHeaderNames()
 	err = validateCSVOutputConfig(p.outputMode, p.csvOutputConfig)
 	if err != nil {
 		return err
@@ -474,30 +679,43 @@ func (p *interp) setExecuteConfig(config *Config) error {
 
 	// Set up ENVIRON from config or environment variables
 	environIndex := p.arrayIndexes["ENVIRON"]
+	p.startEnviron = make(map[string]string)
 	if config.Environ != nil {
 		for i := 0; i < len(config.Environ); i += 2 {
-			p.setArrayValue(resolver.Global, environIndex, config.Environ[i], numStr(config.Environ[i+1]))
+			p.startEnviron[config.Environ[i]] = config.Environ[i+1]
 		}
 	} else {
 		for _, kv := range os.Environ() {
 			eq := strings.IndexByte(kv, '=')
 			if eq >= 0 {
-				p.setArrayValue(resolver.Global, environIndex, kv[:eq], numStr(kv[eq+1:]))
+				p.startEnviron[kv[:eq]] = kv[eq+1:]
 			}
 		}
 	}
+	for k, v := range p.startEnviron {
+		p.setArrayValue(resolver.Global, environIndex, k, numStr(v))
+	}
+
+	p.initProcinfo()
 
-	// Set up system shell command
-	if len(config.ShellCommand) != 0 {
-		p.shellCommand = config.ShellCommand
+	// Set up command runner (defaults to system shell command)
+	if config.CommandRunner != nil {
+		p.commandRunner = config.CommandRunner
 	} else {
-		p.shellCommand = defaultShellCommand
+		p.commandRunner = &ShellRunner{Shell: config.ShellCommand}
 	}
 
 	// Set up I/O structures
 	p.noExec = config.NoExec
 	p.noFileWrites = config.NoFileWrites
 	p.noFileReads = config.NoFileReads
+	p.noNetwork = config.NoNetwork || config.NoExec || config.NoFileWrites || config.NoFileReads
+	p.decompress = config.Decompress
+	if config.InPlace && config.NoFileWrites {
+		return newError("can't edit files in place due to NoFileWrites")
+	}
+	p.inPlaceEdit = config.InPlace
+	p.inPlaceSuffix = config.InPlaceSuffix
 	p.stdin = config.Stdin
 	if p.stdin == nil {
 		p.stdin = os.Stdin
@@ -511,6 +729,34 @@ func (p *interp) setExecuteConfig(config *Config) error {
 		p.errorOutput = os.Stderr
 	}
 
+	// Set up lint checks and source position mapping
+	p.lint = config.Lint
+	p.lintMaxFiles = config.LintMaxFiles
+	if p.lintMaxFiles == 0 {
+		p.lintMaxFiles = defaultLintFiles
+	}
+	if p.lint {
+		p.lintWarned = make(map[lintKey]bool)
+	}
+
+	// Only split lines into as many fields as the program uses (but lint
+	// checks need NF)
+	p.maxField = p.program.Compiled.MaxField
+	if p.lint {
+		p.maxField = -1
+	}
+	p.sourceLine = config.SourceLine
+
+	// Set up execution profiling
+	p.profiling = config.Profiling
+	if p.profiling {
+		p.resetProfile()
+	}
+
+	// Set up regex and format caches (entries are kept between executions)
+	p.regexCache.setMaxSize(cacheSize(config.RegexCacheSize, defaultRegexCacheSize))
+	p.formatCache.setMaxSize(cacheSize(config.FormatCacheSize, defaultFormatCacheSize))
+
 	// Initialize native Go functions
 	if p.nativeFuncs == nil {
 		err := p.initNativeFuncs(config.Funcs)
@@ -549,6 +795,10 @@ func validCSVSeparator(r rune) bool {
 
 func (p *interp) executeAll() (int, error) {
 	defer p.closeAll()
+	if p.profiling {
+		stopSampler := p.startProfileSampler()
+		defer stopSampler()
+	}
 
 	// Execute the program: BEGIN, then pattern/actions, then END
 	err := p.execute(p.program.Compiled.Begin)
@@ -561,7 +811,9 @@ func (p *interp) executeAll() (int, error) {
 		}
 		return 0, err
 	}
-	if len(p.program.Compiled.Actions) == 0 && len(p.program.Compiled.End) == 0 {
+	compiled := p.program.Compiled
+	if len(compiled.Actions) == 0 && len(compiled.End) == 0 &&
+		len(compiled.BeginFile) == 0 && len(compiled.EndFile) == 0 {
 		return p.exitStatus, nil // only BEGIN specified, don't process input
 	}
 	if err != errExit {
@@ -576,6 +828,12 @@ func (p *interp) executeAll() (int, error) {
 			return 0, err
 		}
 	}
+	// Program may have exited part way through a file being edited in
+	// place, replace it with what's been written so far.
+	err = p.finishInPlace()
+	if err != nil {
+		return 0, err
+	}
 	err = p.execute(p.program.Compiled.End)
 	if err != nil && err != errExit {
 		if p.checkCtx {
@@ -621,8 +879,7 @@ lineLoop:
 		if err != nil {
 			return err
 		}
-		p.setLine(line, false)
-		p.reparseCSV = false
+		p.setLineFromInput(line)
 
 		// Execute all the pattern-action blocks for each line
 		for i, action := range actions {
@@ -723,12 +980,24 @@ func (p *interp) getSpecial(index int) value {
 		return str(p.recordSep)
 	case ast.V_RT:
 		return str(p.recordTerminator)
+	case ast.V_ERRNO:
+		return str(p.errno)
 	case ast.V_SUBSEP:
 		return str(p.subscriptSep)
 	case ast.V_INPUTMODE:
 		return str(inputModeString(p.inputMode, p.csvInputConfig))
 	case ast.V_OUTPUTMODE:
 		return str(outputModeString(p.outputMode, p.csvOutputConfig))
+	case ast.V_PREC:
+		if !p.bignum {
+			return p.precVar
+		}
+		return num(float64(p.prec))
+	case ast.V_ROUNDMODE:
+		if !p.bignum {
+			return p.roundModeVar
+		}
+		return str(roundModeString(p.roundMode))
 	default:
 		panic(fmt.Sprintf("unexpected special variable index: %d", index))
 	}
@@ -788,6 +1057,7 @@ func (p *interp) setSpecial(index int, v value) error {
 		p.argc = argc
 	case ast.V_CONVFMT:
 		p.convertFormat = p.toString(v)
+		p.updateConvertedStrs()
 	case ast.V_FILENAME:
 		p.filename = v
 	case ast.V_FS:
@@ -806,23 +1076,19 @@ func (p *interp) setSpecial(index int, v value) error {
 	case ast.V_ORS:
 		p.outputRecordSep = p.toString(v)
 	case ast.V_RS:
-		p.recordSep = p.toString(v)
-		switch { // compare to interp.newScanner
-		case len(p.recordSep) <= 1:
-			// Simple cases use specialized splitters, not regex
-		case utf8.RuneCountInString(p.recordSep) == 1:
-			// Multi-byte unicode char falls back to regex splitter
-			sep := regexp.QuoteMeta(p.recordSep) // not strictly necessary as no multi-byte chars are regex meta chars
-			p.recordSepRegex = regexp.MustCompile(sep)
-		default:
-			re, err := regexp.Compile(compiler.AddRegexFlags(p.recordSep))
-			if err != nil {
-				return newError("invalid regex %q: %s", p.recordSep, err)
-			}
+		recordSep := p.toString(v)
+		re, err := compileRecordSep(recordSep)
+		if err != nil {
+			return err
+		}
+		p.recordSep = recordSep
+		if re != nil {
 			p.recordSepRegex = re
 		}
 	case ast.V_RT:
 		p.recordTerminator = p.toString(v)
+	case ast.V_ERRNO:
+		p.errno = p.toString(v)
 	case ast.V_SUBSEP:
 		p.subscriptSep = p.toString(v)
 	case ast.V_INPUTMODE:
@@ -835,6 +1101,8 @@ func (p *interp) setSpecial(index int, v value) error {
 		if err != nil {
 			return err
 		}
+		p.setHeaderNames()
+		p.updateProcinfoModes()
 	case ast.V_OUTPUTMODE:
 		var err error
 		p.outputMode, p.csvOutputConfig, err = parseOutputMode(p.toString(v))
@@ -845,12 +1113,45 @@ func (p *interp) setSpecial(index int, v value) error {
 		if err != nil {
 			return err
 		}
+		p.updateProcinfoModes()
+	case ast.V_PREC:
+		if !p.bignum {
+			p.precVar = v
+			return nil
+		}
+		return p.setPrec(v)
+	case ast.V_ROUNDMODE:
+		if !p.bignum {
+			p.roundModeVar = v
+			return nil
+		}
+		return p.setRoundMode(v)
 	default:
 		panic(fmt.Sprintf("unexpected special variable index: %d", index))
 	}
 	return nil
 }
 
+// Compile the regex used to split records for the given RS, or return nil
+// if RS is simple enough to use a specialized splitter.
+func compileRecordSep(recordSep string) (*regexp.Regexp, error) {
+	switch { // compare to interp.newScannerConfig
+	case len(recordSep) <= 1:
+		// Simple cases use specialized splitters, not regex
+		return nil, nil
+	case utf8.RuneCountInString(recordSep) == 1:
+		// Multi-byte unicode char falls back to regex splitter
+		sep := regexp.QuoteMeta(recordSep) // not strictly necessary as no multi-byte chars are regex meta chars
+		return regexp.MustCompile(sep), nil
+	default:
+		re, err := regexp.Compile(compiler.AddRegexFlags(recordSep))
+		if err != nil {
+			return nil, newError("invalid regex %q: %s", recordSep, err)
+		}
+		return re, nil
+	}
+}
+
 // Determine the index of given array into the p.arrays slice. Global
 // arrays are just at p.arrays[index], local arrays have to be looked
 // up indirectly.
@@ -906,21 +1207,43 @@ func (p *interp) getField(index int) value {
 
 // Get the value of a field by name (for CSV/TSV mode), as in @"name".
 func (p *interp) getFieldByName(name string) (value, error) {
+	index, err := p.fieldIndexByName(name)
+	if err != nil {
+		return null(), err
+	}
+	if index == 0 {
+		return str(""), nil
+	}
+	return p.getField(index), nil
+}
+
+// Return the index of the named field, or 0 if there's no such field in
+// the header row.
+func (p *interp) fieldIndexByName(name string) (int, error) {
 	if p.fieldIndexes == nil {
 		// Lazily create map of field names to indexes.
 		if p.fieldNames == nil {
-			return null(), newError(`@ only supported if header parsing enabled; use -H or add "header" to INPUTMODE`)
+			return 0, newError(`@ only supported if header parsing enabled; use -H or add "header" to INPUTMODE`)
 		}
 		p.fieldIndexes = make(map[string]int, len(p.fieldNames))
 		for i, n := range p.fieldNames {
 			p.fieldIndexes[n] = i + 1
 		}
 	}
-	index := p.fieldIndexes[name]
+	return p.fieldIndexes[name], nil
+}
+
+// Return the index of the named field being assigned to, as in
+// @"name" = value. Unlike reading, it's an error if there's no such field.
+func (p *interp) assignFieldIndex(name string) (int, error) {
+	index, err := p.fieldIndexByName(name)
+	if err != nil {
+		return 0, err
+	}
 	if index == 0 {
-		return str(""), nil
+		return 0, newError("can't assign to field %q: not in header", name)
 	}
-	return p.getField(index), nil
+	return index, nil
 }
 
 // Sets a single field, equivalent to "$index = value"
@@ -970,22 +1293,49 @@ func (p *interp) toString(v value) string {
 	return v.str(p.convertFormat)
 }
 
+// Rebuild the string constants the compiler folded from conversions of
+// non-integer numbers (see compiler.ConvertedStr) if CONVFMT has changed.
+// The program itself never assigns CONVFMT in that case, but it can be set
+// with -v, Config.Vars, or a var=value argument.
+func (p *interp) updateConvertedStrs() {
+	if p.convertFormat == p.convertedFormat {
+		return
+	}
+	for _, converted := range p.program.Compiled.ConvertedStrs {
+		var sb strings.Builder
+		for _, part := range converted.Parts {
+			if part.IsNum {
+				sb.WriteString(num(part.Num).str(p.convertFormat))
+			} else {
+				sb.WriteString(part.Str)
+			}
+		}
+		p.strs[converted.Index] = sb.String()
+	}
+	p.convertedFormat = p.convertFormat
+}
+
 // Compile regex string (or fetch from regex cache)
 func (p *interp) compileRegex(regex string) (*regexp.Regexp, error) {
-	if re, ok := p.regexCache[regex]; ok {
-		return re, nil
+	if re, ok := p.regexCache.get(regex); ok {
+		return re.(*regexp.Regexp), nil
 	}
 	re, err := regexp.Compile(compiler.AddRegexFlags(regex))
 	if err != nil {
 		return nil, newError("invalid regex %q: %s", regex, err)
 	}
-	// Dumb, non-LRU cache: just cache the first N regexes
-	if len(p.regexCache) < maxCachedRegexes {
-		p.regexCache[regex] = re
-	}
+	p.regexCache.add(regex, re)
 	return re, nil
 }
 
+// Return the configured size of a cache: zero means use the default.
+func cacheSize(size, defaultSize int) int {
+	if size == 0 {
+		return defaultSize
+	}
+	return size
+}
+
 func getDefaultShellCommand() []string {
 	executable := "/bin/sh"
 	if runtime.GOOS == "windows" {
@@ -1013,7 +1363,16 @@ func inputModeString(mode IOMode, csvConfig CSVInputConfig) string {
 	if csvConfig.Comment != 0 {
 		s += " comment=" + string([]rune{csvConfig.Comment})
 	}
-	if csvConfig.Header {
+	if csvConfig.TrimLeadingSpace {
+		s += " trimspace"
+	}
+	switch {
+	case csvConfig.HeaderNames != nil:
+		s += " header=" + strings.Join(csvConfig.HeaderNames, ",")
+		if csvConfig.Header {
+			s += " skipheader"
+		}
+	case csvConfig.Header:
 		s += " header"
 	}
 	return s
@@ -1056,10 +1415,25 @@ func parseInputMode(s string) (mode IOMode, csvConfig CSVInputConfig, err error)
 			}
 			csvConfig.Comment = r
 		case "header":
-			if val != "" && val != "true" && val != "false" {
-				return DefaultMode, CSVInputConfig{}, newError("invalid header value %q", val)
+			switch val {
+			case "", "true":
+				csvConfig.Header = true
+			case "false":
+				csvConfig.Header = false
+			default:
+				// List of field names, for example header=id,name,age
+				names := strings.Split(val, ",")
+				for _, name := range names {
+					if name == "" {
+						return DefaultMode, CSVInputConfig{}, newError("invalid header value %q", val)
+					}
+				}
+				csvConfig.HeaderNames = names
 			}
-			csvConfig.Header = val == "" || val == "true"
+		case "skipheader":
+			csvConfig.Header = true
+		case "trimspace":
+			csvConfig.TrimLeadingSpace = true
 		default:
 			return DefaultMode, CSVInputConfig{}, newError("invalid input mode key %q", key)
 		}
@@ -1083,6 +1457,9 @@ func outputModeString(mode IOMode, csvConfig CSVOutputConfig) string {
 	if csvConfig.Separator != defaultSep {
 		s += " separator=" + string([]rune{csvConfig.Separator})
 	}
+	if csvConfig.Header {
+		s += " header"
+	}
 	return s
 }
 
@@ -1116,6 +1493,11 @@ func parseOutputMode(s string) (mode IOMode, csvConfig CSVOutputConfig, err erro
 				return DefaultMode, CSVOutputConfig{}, newError("invalid CSV/TSV separator %q", val)
 			}
 			csvConfig.Separator = r
+		case "header":
+			if val != "" && val != "true" && val != "false" {
+				return DefaultMode, CSVOutputConfig{}, newError("invalid header value %q", val)
+			}
+			csvConfig.Header = val == "" || val == "true"
 		default:
 			return DefaultMode, CSVOutputConfig{}, newError("invalid output mode key %q", key)
 		}
@@ -2,23 +2,31 @@
 package interp_test
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
 	"encoding/csv"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"reflect"
 	"runtime"
 	"strconv"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/benhoyt/goawk/interp"
+	"github.com/benhoyt/goawk/lexer"
 	"github.com/benhoyt/goawk/parser"
 )
 
@@ -75,6 +83,7 @@ NR==3, NR==5 { print NR }
 	{`BEGIN { print; print }`, "", "\n\n", "", ""},
 	{`BEGIN { printf "%% %d %x %c %f %s", 42, 42, 42, 42, 42 }`, "", "% 42 2a * 42.000000 42", "", ""},
 	{`BEGIN { printf "%3d", 42 }`, "", " 42", "", ""},
+	{`BEGIN { printf "%i|%3i|%-3i|", 42, 7, -5 }`, "", "42|  7|-5 |", "", ""},
 	{`BEGIN { printf "%3s", "x" }`, "", "  x", "", ""},
 	{`BEGIN { printf "%.1g", 42 }  # !windows-gawk`, "", "4e+01", "", ""}, // for some reason gawk gives "4e+001" on Windows
 	{`BEGIN { printf "%d", 12, 34 }`, "", "12", "", ""},
@@ -182,6 +191,20 @@ BEGIN {
 	{`BEGIN { nextfile }`, "", "", "parse error at 1:9: nextfile can't be inside BEGIN or END", "BEGIN"},
 	{`END { nextfile }`, "", "", "parse error at 1:7: nextfile can't be inside BEGIN or END", "END"},
 
+	// BEGINFILE and ENDFILE (more tests with files in goawk_test.go)
+	{`BEGINFILE { print "begin", FNR, ERRNO == "" } { print } ENDFILE { print "end", FNR }  # !awk`, "a\nb", "begin 0 1\na\nb\nend 2\n", "", ""},
+	{`BEGINFILE { print "begin" }  # !awk`, "a\nb", "begin\n", "", ""},
+	{`ENDFILE { print "end", NR }  # !awk`, "a\nb", "end 2\n", "", ""},
+	{`BEGINFILE { nextfile } { print } ENDFILE { print "end" }  # !awk`, "a\nb", "", "", ""},
+	{`BEGINFILE { ERRNO = "x"; print ERRNO }  # !awk`, "", "x\n", "", ""},
+	{`BEGINFILE { exit 0 } { print } END { print "end" }  # !awk`, "a", "end\n", "", ""},
+	{`BEGINFILE { next }  # !awk`, "", "", "parse error at 1:13: next can't be inside BEGINFILE", ""},
+	{`ENDFILE { next }  # !awk`, "", "", "parse error at 1:11: next can't be inside ENDFILE", ""},
+	{`ENDFILE { nextfile }  # !awk`, "", "", "parse error at 1:11: nextfile can't be inside ENDFILE", ""},
+	{`BEGINFILE { getline }  # !awk`, "", "", "parse error at 1:13: getline without redirection can't be inside BEGINFILE", ""},
+	{`ENDFILE { getline x }  # !awk`, "", "", "parse error at 1:11: getline without redirection can't be inside ENDFILE", ""},
+	{`BEGINFILE { f() }  function f() { next }  # !awk`, "a", "", "next can't be used in BEGINFILE or ENDFILE", ""},
+
 	// Arrays, "in", and delete
 	{`BEGIN { a["x"] = 3; print "x" in a, "y" in a }`, "", "1 0\n", "", ""},
 	{`BEGIN { a["x"] = 3; a["y"] = 4; delete a["x"]; for (k in a) print k, a[k] }`, "", "y 4\n", "", ""},
@@ -260,9 +283,22 @@ BEGIN {
 	{`BEGIN { print 1 2, "x" "yz", 1+2 3+4 }`, "", "12 xyz 37\n", "", ""},
 	{`BEGIN { print "food"~/oo/, "food"~/[oO]+d/, "food"~"f", "food"~"F", "food"~0 }`, "", "1 1 1 0 0\n", "", ""},
 	{`BEGIN { print "food"!~/oo/, "food"!~/[oO]+d/, "food"!~"f", "food"!~"F", "food"!~0 }`, "", "0 0 0 1 1\n", "", ""},
+	{`BEGIN { print "food"~/^fo/, "food"~/od$/, "food"~/^food$/, "food"~/^oo/, "food"~/bar|oo/, "food"~"" }`, "", "1 1 1 0 1 1\n", "", ""},
+	{`BEGIN { print "a.b"~/a\.b/, "axb"~/a\.b/, "axb"!~/a\.b/, "x"!~/^$/, ""!~/^$/ }`, "", "1 0 1 1 0\n", "", ""},
+	{`/ERROR|WARN/ { print NR } !/^#/ && /x$/ { print $0 }`, "ERROR\nok x\n# x\nWARNING", "1\nok x\n4\n", "", ""},
 	{`BEGIN { print 1+2*3/4^5%6 7, (1+2)*3/4^5%6 "7" }`, "", "1.005867 0.008789067\n", "", ""},
 	{`BEGIN { print 1/0 }`, "", "", "division by zero", "division by zero"},
 	{`BEGIN { print 1%0 }`, "", "", "division by zero in mod", "division by zero"},
+	{`BEGIN { x = 2*3+1; y = -(4); print x, y, 2^10, 7%3, -"3x" }`, "", "7 -4 1024 1 -3\n", "", ""},
+	{`BEGIN { x = 5; x = x - 2; x = x * x; print x; if (x) exit; print "not reached" }`, "", "9\n", "", ""},
+	{`$1 == 1 { print "one" } $2 == "b" { print $2 } { n = n + $1; print n }`, "1 b\n1.0 c\nx", "one\nb\n1\none\n2\n2\n", "", ""},
+	{`BEGIN { while (1) { if (++i > 3) break; if (i == 2) continue; print i } do { j++ } while (0); print i, j }`, "", "1\n3\n4 1\n", "", ""},
+	{`BEGIN { a[1]; for (k in a) { while (1) { if (k) break }; continue; print "no" } print "ok" }`, "", "ok\n", "", ""},
+	{`function f(x) { if (x) return "y"; else return "n"; print "no" } BEGIN { print f(0), f(1) }`, "", "n y\n", "", ""},
+	{`BEGIN { print "prefix" "-" "x", 2^10, length("abc"), 1 "" 2.5, substr("hello", 2, 3), -(1+2)*3 % 5 }`, "", "prefix-x 1024 3 12.5 ell -4\n", "", ""},
+	{`BEGIN { print ("10" < 9), ("a" < "b"), (2 < 10), !"", !"0", 0 && x++, 1 || x++, x }`, "", "1 1 1 1 0 0 1 \n", "", ""},
+	{`BEGIN { x = 0.1 + 0.2 ""; CONVFMT = "%.2g"; print x, 0.123456 "", 1/3 "", 5 "" }`, "", "0.3 0.12 0.33 5\n", "", ""},
+	{`{ print $1 0.5, "a" 0.25 "b" $(1+1), a[1+1] "" }`, "x y", "x0.5 a0.25by \n", "", ""},
 	{`BEGIN { x /= 0 }`, "", "", "division by zero", "division by zero"},
 	{`BEGIN { x %= 0 }`, "", "", "division by zero in mod", "division by zero"},
 
@@ -333,6 +369,13 @@ BEGIN {
 	{`BEGIN { RS="x"; FS=",.*," } { for (i=1; i<=NF; i++) print $i }`, "one,\n,two", "one\ntwo\n", "", ""},
 	{`BEGIN { FS="x"; RS=",.*," } { print }  # !posix`, "one,\n,two", "one\ntwo\n", "", ""},
 	{`{ print NF }`, "\na\nc d\ne f g", "0\n1\n2\n3\n", "", ""},
+	// Fields are only split up to the highest one used ($1 and $3 here)
+	{`{ print $1, $3 }`, "a b c d e\n  f\tg  \n\n", "a c\nf \n \n", "", ""},
+	{`{ print $1, $3 } END { print NF }`, "a b c d e", "a c\n5\n", "", ""},
+	{`BEGIN { FS="," } { print $2 "|" $1 }`, "a,b,c\nd\n,", "b|a\n|d\n|\n", "", ""},
+	{`BEGIN { FS="[,;]" } { print $2 "|" $1 }`, "a;b,c\nd", "b|a\n|d\n", "", ""},
+	{`BEGIN { RS=""; FS="," } { print $2 "|" $3 }`, "a\nb,c\nd\n\ne,f", "b|c\nf|\n", "", ""},
+	{`{ print $0; print $1 }`, "a b c", "a b c\na\n", "", ""},
 	{`BEGIN { NR = 123; print NR }`, "", "123\n", "", ""},
 	{`{ print NR, $0 }`, "a\nb\nc", "1 a\n2 b\n3 c\n", "", ""},
 	{`
@@ -588,6 +631,11 @@ BEGIN {
 		"", "error\n0\n", "", ""},
 	{`BEGIN { print system("exit 42") }  # !fuzz !posix`, "", "42\n", "", ""},
 	{`BEGIN { system("cat") }`, "foo\nbar", "foo\nbar", "", ""},
+	{`BEGIN { system("exit 3"); print PROCINFO["status"] }  # !awk !gawk !fuzz`, "", "3\n", "", ""},
+	{`BEGIN { print "x" | "cat; exit 5"; close("cat; exit 5"); print PROCINFO["status"] }  # !awk !gawk !fuzz`, "", "x\n5\n", "", ""},
+	{`BEGIN { cmd = "cat >/dev/null; exit 3"; print "x" | cmd; print close(cmd); print "y" | "cat >/dev/null"; print close("cat >/dev/null") }  # !awk !fuzz`, "", "3\n0\n", "", ""},
+	{`BEGIN { "echo x; exit 7" | getline; print close("echo x; exit 7"), PROCINFO["status"] }  # !awk !gawk !fuzz`, "", "7 7\n", "", ""},
+	{`BEGIN { cmd = "cat; exit 2"; print "x" |& cmd; close(cmd, "to"); cmd |& getline y; print y, close(cmd), PROCINFO["status"] }  # !awk !gawk !fuzz`, "", "x 2 2\n", "", ""},
 
 	// Test bytes/unicode handling (GoAWK currently has char==byte, unlike Gawk).
 	{`BEGIN { print match("food", "foo"), RSTART, RLENGTH }  !gawk`, "", "1 1 3\n", "", ""},
@@ -824,6 +872,25 @@ BEGIN { foo(5); bar(10) }
 	{`BEGIN { print fflush("x") }  # !gawk`, "", "error flushing \"x\": not an output file or pipe\n-1\n", "", ""},
 	{`BEGIN { "cat" | getline; print fflush("cat") }  # !gawk !fuzz`, "", "error flushing \"cat\": not an output file or pipe\n-1\n", "", ""},
 
+	// Two-way pipes to coprocesses (|&)
+	{`BEGIN { cmd = "sort"; print "c" |& cmd; print "a" |& cmd; print "b" |& cmd; print close(cmd, "to")
+	         while ((cmd |& getline line) > 0) print line; print close(cmd) }  # !awk !fuzz`, "", "0\na\nb\nc\n0\n", "", ""},
+	{`BEGIN { cmd = "cat"; for (i = 1; i <= 3; i++) { print "k" i |& cmd; cmd |& getline; print $0 "=" i } }  # !awk !fuzz`,
+		"", "k1=1\nk2=2\nk3=3\n", "", ""},
+	{`BEGIN { cmd = "cat >/dev/null"; print "x" |& cmd; close(cmd, "from"); print "y" |& cmd; print close(cmd) }  # !awk !fuzz`, "", "0\n", "", ""},
+	{`BEGIN { cmd = "cat >/dev/null"; print "x" |& cmd; print fflush(cmd); print close(cmd); print close(cmd) }  # !awk !fuzz`, "", "0\n0\n-1\n", "", ""},
+	{`BEGIN { print "x" |& "cat"; close("cat", "to"); print "y" |& "cat" }  # !awk !gawk !fuzz`, "", "", "can't write to coprocess after closing it for writing", ""},
+	{`BEGIN { print "x" |& "cat"; close("cat", "from"); "cat" |& getline }  # !awk !gawk !fuzz`, "", "", "can't read from coprocess after closing it for reading", ""},
+	{`BEGIN { print "x" |& "cat"; close("cat", "both") }  # !awk !gawk !fuzz`, "", "", `close: second argument must be "to" or "from", not "both"`, ""},
+	{`BEGIN { print "x" |& "cat"; print "y" | "cat" }  # !awk !gawk !fuzz`, "", "", "can't write to coprocess stream", ""},
+	{`BEGIN { print "x" |& "cat"; "cat" | getline }  # !awk !gawk !fuzz`, "", "", "can't read from coprocess stream", ""},
+	{`BEGIN { print "x" > "out"; print "y" |& "out" }  # !awk !gawk !fuzz`, "", "", "can't use writer stream as coprocess", ""},
+	{`BEGIN { print close("x", "to") }`, "", "-1\n", "", ""},
+
+	// ERRNO is set on I/O errors
+	{`BEGIN { print ERRNO == ""; print (getline x <"nonexistent"), ERRNO }  # !awk !gawk`, "", "1\n-1 no such file or directory\n", "", ""},
+	{`BEGIN { print close("nothing"), ERRNO }  # !awk !gawk`, "", "-1 close of redirection that was never opened\n", "", ""},
+
 	// Greater than operator requires parentheses in print statement,
 	// otherwise it's a redirection directive
 	{`BEGIN { print "x" > "out" }  # !fuzz`, "", "", "", ""},
@@ -1028,6 +1095,112 @@ func TestInterp(t *testing.T) {
 	_ = os.Remove("out")
 }
 
+func TestFoldedConversions(t *testing.T) {
+	// Conversions like 0.5 "" are folded if the program doesn't assign
+	// CONVFMT, but it can still be changed with Vars or a var=value arg.
+	src := `BEGIN { print "a" 0.123456789 } { print $0, 0.987654321 "" }`
+	configure := func(config *interp.Config) {
+		config.Vars = append(config.Vars, "CONVFMT", "%.2g")
+		config.Args = []string{"CONVFMT=%.3g", "-"}
+	}
+	out := "a0.12\nx 0.988\n"
+	testGoAWK(t, src, "x\n", out, "", nil, configure)
+	testGoAWKParserConfig(t, src, "x\n", out, "", &parser.ParserConfig{NoOptimize: true}, configure)
+}
+
+func TestBignum(t *testing.T) {
+	tests := []struct {
+		src string
+		in  string
+		out string
+		err string
+	}{
+		// Exact integers
+		{`BEGIN { print 2^100, 2^53+1, -2^60 }`, "", "1267650600228229401496703205376 9007199254740993 -1152921504606846976\n", ""},
+		{`{ print $1+1, $1*$2, $2-$1, $1%7, ($1 < $2), ($1 == $2) }`, "12345678901234567890 12345678901234567891\n",
+			"12345678901234567891 152415787532388367514250878776253619990 1 1 1 0\n", ""},
+		{`{ s += $1 } END { print s }`, "99999999999999999999\n1\n", "100000000000000000000\n", ""},
+		{`BEGIN { x = "99999999999999999999"; x++; y = x; y -= 1; print x, y, -x }`, "", "100000000000000000000 99999999999999999999 -100000000000000000000\n", ""},
+		{`BEGIN { a[2^64] = 1; for (k in a) print k }`, "", "18446744073709551616\n", ""},
+		{`BEGIN { x = 2^64; print (x > 18446744073709551615), 12345678901234567890 + 1, -12345678901234567890, 1e23 }`, "",
+			"1 12345678901234567891 -12345678901234567890 100000000000000000000000\n", ""},
+		{`BEGIN { PREC = 200; printf "%.30f %.30f\n", 0.1, 0.123456789012345678901234567890 }`, "",
+			"0.100000000000000000000000000000 0.123456789012345678901234567890\n", ""},
+		{`BEGIN { print 6/3, 7/2, -7%3, 7.5%2, 2^-2, int(-7.9), int("123456789012345678901.5") }`, "", "2 3.5 -1 1.5 0.25 -7 123456789012345683968\n", ""},
+		{`BEGIN { PREC = 100; print int("123456789012345678901.5") }`, "", "123456789012345678901\n", ""},
+
+		// Precision and rounding
+		{`BEGIN { printf "%.20f\n", 1/3 }`, "", "0.33333333333333331483\n", ""},
+		{`BEGIN { PREC = 200; printf "%.40f\n", 1/3 }`, "", "0.3333333333333333333333333333333333333333\n", ""},
+		{`BEGIN { PREC = "quad"; print PREC; printf "%.30f\n", sqrt(2) }`, "", "113\n1.414213562373095048801688724210\n", ""},
+		{`BEGIN { PREC = 10; ROUNDMODE = "Z"; print ROUNDMODE; printf "%.6f %.6f\n", 2/3, -2/3 }`, "", "Z\n0.666016 -0.666016\n", ""},
+		{`BEGIN { PREC = 10; ROUNDMODE = "U"; printf "%.6f %.6f\n", 2/3, -2/3 }`, "", "0.666992 -0.666016\n", ""},
+		{`BEGIN { print PREC, ROUNDMODE }`, "", "53 N\n", ""},
+		{`{ print ($1+$2 == $3), $1+$2 }`, "0.1 0.2 0.3\n", "0 0.3\n", ""},
+		{`BEGIN { PREC = 300 } { print ($1+$2 == $3), ($1+$2)-$3, (0.1+0.2 == 0.3) }`, "0.1 0.2 0.3\n", "1 0 1\n", ""},
+		{`BEGIN { PREC = 100; CONVFMT = "%.25g"; x = 1/3 ""; print x, 1/3 }`, "", "0.3333333333333333333333333 0.333333\n", ""},
+
+		// printf
+		{`BEGIN { printf "%d %5.2f %x %e %s|%-4d|%c\n", "123456789012345678901234567890", 2.345, 2^70, 1e100, 1/3, 7, 65 }`, "",
+			"123456789012345678901234567890  2.35 400000000000000000 1.000000e+100 0.333333|7   |A\n", ""},
+
+		// NaN and infinity use float64
+		{`BEGIN { x = -log(0); print x, -x, (x > 2^1000), (log(-1) == log(-1)) }`, "", "inf -inf 1 0\n", ""},
+
+		// Errors
+		{`BEGIN { print 1/0 }`, "", "", "division by zero"},
+		{`BEGIN { x = 2^100; print x % 0 }`, "", "", "division by zero in mod"},
+		{`BEGIN { PREC = 0 }`, "", "", `invalid PREC "0": must be between 1 and 4294967295, or a name like "quad"`},
+		{`BEGIN { ROUNDMODE = "X" }`, "", "", `invalid ROUNDMODE "X": must be N, Z, U, D, or A`},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			testGoAWK(t, test.src, test.in, test.out, test.err, nil, func(config *interp.Config) {
+				config.Bignum = true
+			})
+		})
+	}
+
+	// Without Bignum, PREC and ROUNDMODE are ordinary variables
+	testGoAWK(t, `BEGIN { print PREC "|" ROUNDMODE; PREC = "abc"; ROUNDMODE = "q"; print PREC, ROUNDMODE, 1/3 }`, "",
+		"|\nabc q 0.333333\n", "", nil, nil)
+	testGoAWK(t, `BEGIN { PREC++; print PREC }`, "", "1\n", "", nil, func(config *interp.Config) {
+		config.Vars = []string{"PREC", "0"}
+	})
+}
+
+func TestBignumVars(t *testing.T) {
+	src := `BEGIN { printf "%s %s %.10f\n", PREC, ROUNDMODE, 1/3 }`
+	out := "10 D 0.3330078125\n"
+	configure := func(config *interp.Config) {
+		config.Bignum = true
+		config.Vars = append(config.Vars, "PREC", "10", "ROUNDMODE", "d")
+	}
+	testGoAWK(t, src, "", out, "", nil, configure)
+	testGoAWKParserConfig(t, src, "", out, "", &parser.ParserConfig{NoOptimize: true}, configure)
+
+	// PREC and ROUNDMODE are ordinary variables in normal mode
+	testGoAWK(t, src, "", "10 d 0.3333333333\n", "", nil, func(config *interp.Config) {
+		config.Vars = append(config.Vars, "PREC", "10", "ROUNDMODE", "d")
+	})
+}
+
+func TestInterpNoOptimize(t *testing.T) {
+	// The optimized code is tested by TestInterp; check that the tests
+	// pass without the optimizer too.
+	for _, test := range interpTests {
+		testName := test.src
+		if len(testName) > 70 {
+			testName = testName[:70]
+		}
+		t.Run(testName, func(t *testing.T) {
+			parserConfig := &parser.ParserConfig{NoOptimize: true}
+			testGoAWKParserConfig(t, test.src, test.in, test.out, test.err, parserConfig, nil)
+		})
+	}
+	_ = os.Remove("out")
+}
+
 // Version of bytes.Buffer that's safe for concurrent writes. This
 // makes certain tests that write to Output and Error at once (due
 // to os/exec) work correctly.
@@ -1055,6 +1228,13 @@ func testGoAWK(
 	parserConfig := &parser.ParserConfig{
 		Funcs: funcs,
 	}
+	testGoAWKParserConfig(t, src, in, out, errStr, parserConfig, configure)
+}
+
+func testGoAWKParserConfig(
+	t *testing.T, src, in, out, errStr string,
+	parserConfig *parser.ParserConfig, configure func(config *interp.Config),
+) {
 	prog, err := parser.ParseProgram([]byte(src), parserConfig)
 	if err != nil {
 		if errStr != "" {
@@ -1078,7 +1258,7 @@ func testGoAWK(
 		Output: outBuf,
 		Error:  outBuf,
 		Vars:   []string{"_var", "42"},
-		Funcs:  funcs,
+		Funcs:  parserConfig.Funcs,
 	}
 	if configure != nil {
 		configure(config)
@@ -1369,6 +1549,10 @@ func TestSafeMode(t *testing.T) {
 		{`$0  # files`, "1\n2\n", "1\n2\n", "can't read from file due to NoFileReads", []string{"f1"}},
 		{`BEGIN { "echo foo" |getline }`, "", "", "can't read from pipe due to NoExec", nil},
 		{`BEGIN { system("echo foo") }`, "", "", "can't call system() due to NoExec", nil},
+		{`BEGIN { print "hi" |& "cat" }`, "", "", "can't start coprocess due to NoExec", nil},
+		{`BEGIN { "cat" |& getline }`, "", "", "can't start coprocess due to NoExec", nil},
+		{`BEGIN { print "hi" > "/inet/tcp/0/localhost/80" }`, "", "", "can't open network connection due to NoNetwork", nil},
+		{`BEGIN { getline < "/inet/udp/8125/0/0" }`, "", "", "can't open network connection due to NoNetwork", nil},
 	}
 	for _, test := range tests {
 		testName := test.src
@@ -1386,6 +1570,215 @@ func TestSafeMode(t *testing.T) {
 	}
 }
 
+func TestLint(t *testing.T) {
+	tests := []struct {
+		src string
+		in  string
+		out string
+	}{
+		{`BEGIN { x = y "z"; print x }`, "", "1:9: warning: reference to uninitialized variable y\nz\n"},
+		{`function f(a, b) { return b }  BEGIN { f(1) }`, "", "1:20: warning: reference to uninitialized variable b\n"},
+		{`BEGIN { x = 1; x++; y += 2; print x y }`, "", "22\n"},
+		{`BEGIN { x = x + 1; print x }`, "", "1:9: warning: reference to uninitialized variable x\n1\n"},
+		{`BEGIN { print x, y }`, "", "1:9: warning: reference to uninitialized variable x\n1:9: warning: reference to uninitialized variable y\n \n"},
+		{`{ print $4, $5 }`, "a\nb\n", "1:3: warning: reference to field $4 past NF\n1:3: warning: reference to field $5 past NF\n \n \n"},
+		{`{ if ($1 < 5 || $2 < 5) print "small" }`, "x y\nz w\n",
+			"1:3: warning: comparison of string \"x\" with number 5 is done as a string comparison\n" +
+				"1:3: warning: comparison of string \"y\" with number 5 is done as a string comparison\n"},
+		{`BEGIN { print x == "" }`, "", "1:9: warning: reference to uninitialized variable x\n1\n"},
+		{`{ print $3 }`, "a b c\nd e\nf\n", "c\n1:3: warning: reference to field $3 past NF\n\n\n"},
+		{`{ i = 2; print $i }`, "a\n", "1:10: warning: reference to field $2 past NF\n\n"},
+		{`$1 < 5`, "3\nabc\n10\nxyz\n", "3\n1:1: warning: comparison of string \"abc\" with number 5 is done as a string comparison\n"},
+		{`{ if ($1 == 5) print "five" }`, "5\nx\n", "five\n1:3: warning: comparison of string \"x\" with number 5 is done as a string comparison\n"},
+		{`BEGIN { print "a" < "b", 1 < 2 }`, "", "1 1\n"},
+		{`BEGIN { print 0 ^ -1 }`, "", "1:9: warning: division by zero in exponentiation\ninf\n"},
+		{`BEGIN { for (i = 0; i < 3; i++) print i > ("/dev/null" i) }`, "",
+			"1:33: warning: more than 2 files and pipes open at once (missing close?)\n"},
+		{`BEGIN { for (i = 0; i < 3; i++) { print i > ("/dev/null" i); close("/dev/null" i) } }`, "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			testGoAWK(t, test.src, test.in, test.out, "", nil, func(config *interp.Config) {
+				config.Lint = true
+				config.LintMaxFiles = 2
+			})
+		})
+	}
+}
+
+func TestLintSourceLine(t *testing.T) {
+	src := "BEGIN {\n  print x\n}"
+	testGoAWK(t, src, "", "prog.awk:12:3: warning: reference to uninitialized variable x\n\n", "", nil,
+		func(config *interp.Config) {
+			config.Lint = true
+			config.SourceLine = func(line int) (string, int) {
+				return "prog.awk", line + 10
+			}
+		})
+}
+
+func TestErrorPosition(t *testing.T) {
+	errFail := errors.New("fail")
+	tests := []struct {
+		src      string
+		message  string
+		position lexer.Position
+		stack    []interp.Frame
+	}{
+		{`BEGIN { print 1/0 }`, "division by zero", lexer.Position{1, 9}, nil},
+		{"BEGIN {\n  x = 1\n  y = x % 0 }", "division by zero in mod", lexer.Position{3, 3}, nil},
+		{"$1 == \"x\" { print substr(\"abc\", 1, \"[\" ~ \"[\") }", "invalid regex \"[\": error parsing regexp: missing closing ]: `[)`", lexer.Position{1, 13}, nil},
+		{"function f(x) {\n  return 1/x\n}\nfunction g() { return f(0) }\nBEGIN { g() }",
+			"division by zero", lexer.Position{2, 3},
+			[]interp.Frame{{"f", lexer.Position{4, 16}}, {"g", lexer.Position{5, 9}}}},
+		{"BEGIN {\n  for (k in ENVIRON) { fail() }\n}", "fail", lexer.Position{2, 24}, nil},
+		{"{ fail() }", "fail", lexer.Position{1, 3}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			funcs := map[string]interface{}{
+				"fail": func() (int, error) { return 0, errFail },
+			}
+			prog, err := parser.ParseProgram([]byte(test.src), &parser.ParserConfig{Funcs: funcs})
+			if err != nil {
+				t.Fatalf("error parsing: %v", err)
+			}
+			config := &interp.Config{
+				Stdin:   strings.NewReader("x\n"),
+				Output:  ioutil.Discard,
+				Environ: []string{"A", "1"},
+				Funcs:   funcs,
+			}
+			_, err = interp.ExecProgram(prog, config)
+			var e *interp.Error
+			if !errors.As(err, &e) {
+				t.Fatalf("expected *interp.Error, got %v", err)
+			}
+			if e.Error() != test.message {
+				t.Fatalf("expected message %q, got %q", test.message, e.Error())
+			}
+			if e.Position != test.position {
+				t.Fatalf("expected position %v, got %v", test.position, e.Position)
+			}
+			if !reflect.DeepEqual(e.Stack, test.stack) {
+				t.Fatalf("expected stack %v, got %v", test.stack, e.Stack)
+			}
+			if test.message == "fail" && !errors.Is(err, errFail) {
+				t.Fatalf("expected error to wrap native function's error")
+			}
+		})
+	}
+}
+
+func TestProfile(t *testing.T) {
+	src := `
+function f(n) {
+	return n * 2
+}
+$1 > 1 {
+	total += f($1)
+	for (i = 0; i < 2; i++) count++
+}
+END { print total, count }
+`
+	prog, err := parser.ParseProgram([]byte(src), nil)
+	if err != nil {
+		t.Fatalf("error parsing: %v", err)
+	}
+	interpreter, err := interp.New(prog)
+	if err != nil {
+		t.Fatalf("error creating interpreter: %v", err)
+	}
+	outBuf := &bytes.Buffer{}
+	_, err = interpreter.Execute(&interp.Config{
+		Stdin:     strings.NewReader("1\n2\n3\n"),
+		Output:    outBuf,
+		Profiling: true,
+	})
+	if err != nil {
+		t.Fatalf("error executing: %v", err)
+	}
+	if outBuf.String() != "10 4\n" {
+		t.Fatalf("expected output %q, got %q", "10 4\n", outBuf.String())
+	}
+
+	profile := interpreter.Profile()
+	counts := make(map[int]int64)
+	for _, line := range profile.Lines {
+		counts[line.Line] = line.Count
+		if line.Instructions < line.Count {
+			t.Errorf("line %d: expected instructions >= count, got %d < %d", line.Line, line.Instructions, line.Count)
+		}
+	}
+	expected := map[int]int64{3: 2, 5: 3, 6: 2, 7: 4, 9: 1}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Fatalf("expected line counts %v, got %v", expected, counts)
+	}
+	if len(profile.Functions) != 1 || profile.Functions[0].Name != "f" || profile.Functions[0].Calls != 2 {
+		t.Fatalf("expected 2 calls to f, got %+v", profile.Functions)
+	}
+	if profile.Functions[0].Position != (lexer.Position{Line: 2, Column: 10}) {
+		t.Fatalf("expected f at 2:10, got %v", profile.Functions[0].Position)
+	}
+
+	// Profile is nil if profiling wasn't enabled
+	_, err = interpreter.Execute(&interp.Config{Stdin: strings.NewReader(""), Output: outBuf})
+	if err != nil {
+		t.Fatalf("error executing: %v", err)
+	}
+	if interpreter.Profile() != nil {
+		t.Fatalf("expected nil profile")
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	tests := []struct {
+		regexCacheSize  int
+		formatCacheSize int
+		regexStats      interp.CacheStats
+		formatStats     interp.CacheStats
+	}{
+		{0, 0, interp.CacheStats{Hits: 3, Misses: 3}, interp.CacheStats{Hits: 0, Misses: 1}},
+		{3, 1, interp.CacheStats{Hits: 3, Misses: 3}, interp.CacheStats{Hits: 0, Misses: 1}},
+		{2, 0, interp.CacheStats{Hits: 0, Misses: 6}, interp.CacheStats{Hits: 0, Misses: 1}},
+		{-1, -1, interp.CacheStats{Hits: 0, Misses: 6}, interp.CacheStats{Hits: 0, Misses: 1}},
+	}
+	for _, test := range tests {
+		name := fmt.Sprintf("%d_%d", test.regexCacheSize, test.formatCacheSize)
+		t.Run(name, func(t *testing.T) {
+			prog, err := parser.ParseProgram([]byte(`{ n += $0 ~ $1 } END { printf "%d\n", n }`), nil)
+			if err != nil {
+				t.Fatalf("error parsing: %v", err)
+			}
+			interpreter, err := interp.New(prog)
+			if err != nil {
+				t.Fatalf("error creating interpreter: %v", err)
+			}
+			outBuf := &bytes.Buffer{}
+			_, err = interpreter.Execute(&interp.Config{
+				Stdin:           strings.NewReader("a\nb\nc\na\nb\nc\n"),
+				Output:          outBuf,
+				Profiling:       true,
+				RegexCacheSize:  test.regexCacheSize,
+				FormatCacheSize: test.formatCacheSize,
+			})
+			if err != nil {
+				t.Fatalf("error executing: %v", err)
+			}
+			if outBuf.String() != "6\n" {
+				t.Fatalf("expected output %q, got %q", "6\n", outBuf.String())
+			}
+			profile := interpreter.Profile()
+			if profile.RegexCache != test.regexStats {
+				t.Errorf("expected regex cache stats %+v, got %+v", test.regexStats, profile.RegexCache)
+			}
+			if profile.FormatCache != test.formatStats {
+				t.Errorf("expected format cache stats %+v, got %+v", test.formatStats, profile.FormatCache)
+			}
+		})
+	}
+}
+
 func TestConfigVarsCorrect(t *testing.T) {
 	prog, err := parser.ParseProgram([]byte(`BEGIN { print x }`), nil)
 	if err != nil {
@@ -1452,6 +1845,277 @@ func TestSystemCommandNotFound(t *testing.T) {
 	}
 }
 
+// fakeRunner is a CommandRunner that runs a few commands in-process and
+// rejects all others.
+type fakeRunner struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (r *fakeRunner) Start(ctx context.Context, cmd *interp.Command) (interp.Process, error) {
+	r.mu.Lock()
+	r.lines = append(r.lines, cmd.Line)
+	r.mu.Unlock()
+
+	fields := strings.Fields(cmd.Line)
+	if len(fields) == 0 || (fields[0] != "echo" && fields[0] != "upper" && fields[0] != "exit") {
+		return nil, fmt.Errorf("command not allowed: %q", cmd.Line)
+	}
+	process := &fakeProcess{done: make(chan struct{})}
+	in, out := cmd.Stdin, cmd.Stdout
+	if in == nil {
+		var w *io.PipeWriter
+		in, w = io.Pipe()
+		process.stdin = w
+	}
+	var outPipe *io.PipeWriter
+	if out == nil {
+		process.stdout, outPipe = io.Pipe()
+		out = outPipe
+	}
+	go func() {
+		defer close(process.done)
+		switch fields[0] {
+		case "echo":
+			fmt.Fprintln(out, strings.Join(fields[1:], " "))
+		case "upper":
+			scanner := bufio.NewScanner(in)
+			for scanner.Scan() {
+				fmt.Fprintln(out, strings.ToUpper(scanner.Text()))
+			}
+		case "exit":
+			process.status, _ = strconv.Atoi(fields[1])
+		}
+		if outPipe != nil {
+			outPipe.Close()
+		}
+	}()
+	return process, nil
+}
+
+type fakeProcess struct {
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	done   chan struct{}
+	status int
+}
+
+func (p *fakeProcess) Stdin() io.WriteCloser { return p.stdin }
+func (p *fakeProcess) Stdout() io.ReadCloser { return p.stdout }
+
+func (p *fakeProcess) Wait() (int, error) {
+	<-p.done
+	return p.status, nil
+}
+
+func TestCommandRunner(t *testing.T) {
+	tests := []struct {
+		src   string
+		out   string
+		lines []string
+	}{
+		{`BEGIN { print system("echo hello world") }`, "hello world\n0\n", []string{"echo hello world"}},
+		{`BEGIN { print system("exit 3") }`, "3\n", []string{"exit 3"}},
+		{`BEGIN { print system("rm -rf /") }`, "command not allowed: \"rm -rf /\"\n-1\n", []string{"rm -rf /"}},
+		{`BEGIN { "echo foo" | getline x; print x; print close("echo foo") }`, "foo\n0\n", []string{"echo foo"}},
+		{`BEGIN { print "a" | "upper"; print "b" | "upper" }`, "A\nB\n", []string{"upper"}},
+		{`BEGIN { print "x" |& "upper"; close("upper", "to"); "upper" |& getline y; print y }`, "X\n", []string{"upper"}},
+		{`BEGIN { "cat" | getline x; print "[" x "]" }`, "command not allowed: \"cat\"\n[]\n", []string{"cat"}},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			runner := &fakeRunner{}
+			testGoAWK(t, test.src, "", test.out, "", nil, func(config *interp.Config) {
+				config.CommandRunner = runner
+			})
+			if !reflect.DeepEqual(runner.lines, test.lines) {
+				t.Fatalf("expected commands %q, got %q", test.lines, runner.lines)
+			}
+		})
+	}
+}
+
+func TestSpecialFiles(t *testing.T) {
+	tests := []struct {
+		src    string
+		in     string
+		out    string
+		errOut string
+		args   []string
+	}{
+		{`BEGIN { print "a" > "/dev/stdout"; print "b" > "/dev/stderr"; print "c" >> "-" }`, "", "a\nc\n", "b\n", nil},
+		{`BEGIN { print "a" > "/dev/fd/1"; print "b" > "/dev/fd/2" }`, "", "a\n", "b\n", nil},
+		{`BEGIN { printf "x" > "/dev/stderr"; print fflush("/dev/stderr"), close("/dev/stderr") }`, "", "0 0\n", "x", nil},
+		{`BEGIN { while ((getline line < "/dev/stdin") > 0) print "got " line }`, "1\n2\n", "got 1\ngot 2\n", "", nil},
+		{`BEGIN { getline a < "-"; getline b < "/dev/stdin"; getline c < "/dev/fd/0"; print a, b, c }`, "1\n2\n3\n", "1 2 3\n", "", nil},
+		{`{ print FILENAME ": " $0 }`, "foo\n", "/dev/stdin: foo\n", "", []string{"/dev/stdin"}},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			prog, err := parser.ParseProgram([]byte(test.src), nil)
+			if err != nil {
+				t.Fatalf("error parsing: %v", err)
+			}
+			outBuf := &bytes.Buffer{}
+			errBuf := &bytes.Buffer{}
+			config := &interp.Config{
+				Stdin:        strings.NewReader(test.in),
+				Output:       outBuf,
+				Error:        errBuf,
+				Args:         test.args,
+				NoFileWrites: true,
+				NoFileReads:  true,
+			}
+			_, err = interp.ExecProgram(prog, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if outBuf.String() != test.out {
+				t.Errorf("expected output %q, got %q", test.out, outBuf.String())
+			}
+			if errBuf.String() != test.errOut {
+				t.Errorf("expected error output %q, got %q", test.errOut, errBuf.String())
+			}
+		})
+	}
+}
+
+func TestNetworkTCPClient(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			fmt.Fprintf(conn, "echo: %s\n", scanner.Text())
+		}
+	}()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	src := fmt.Sprintf(`BEGIN {
+	s = "/inet/tcp/0/127.0.0.1/%d"
+	print "hello" > s
+	getline line < s
+	print line
+	print "world" |& s
+	s |& getline line
+	print line
+	print close(s)
+}`, port)
+	testGoAWK(t, src, "", "echo: hello\necho: world\n0\n", "", nil, nil)
+}
+
+func TestNetworkTCPServer(t *testing.T) {
+	// Find a free port for the AWK program to listen on.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	replies := make(chan string, 1)
+	go func() {
+		var conn net.Conn
+		var err error
+		for i := 0; i < 100; i++ {
+			conn, err = net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+			if err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			replies <- err.Error()
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintln(conn, "ping")
+		reply, _ := ioutil.ReadAll(conn)
+		replies <- string(reply)
+	}()
+
+	src := fmt.Sprintf(`BEGIN {
+	s = "/inet/tcp/%d/0/0"
+	s |& getline request
+	print "got " request
+	print "pong" |& s
+	close(s)
+}`, port)
+	testGoAWK(t, src, "", "got ping\n", "", nil, nil)
+	reply := <-replies
+	if reply != "pong\n" {
+		t.Fatalf("expected reply %q, got %q", "pong\n", reply)
+	}
+}
+
+func TestNetworkUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	src := fmt.Sprintf(`BEGIN {
+	s = "/inet/udp/0/127.0.0.1/%d"
+	print "requests 42" > s
+	close(s)
+}`, port)
+	testGoAWK(t, src, "", "", "", nil, nil)
+
+	buf := make([]byte, 100)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "requests 42\n" {
+		t.Fatalf("expected packet %q, got %q", "requests 42\n", buf[:n])
+	}
+}
+
+func TestNetworkErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		{`BEGIN { print "x" > "/inet/foo/0/localhost/80" }`, `invalid network special file "/inet/foo/0/localhost/80"`},
+		{`BEGIN { getline < "/inet/tcp/80" }`, `invalid network special file "/inet/tcp/80"`},
+		{`BEGIN { print "x" |& "/inet/tcp/0/0/0" }`, `network special file "/inet/tcp/0/0/0" needs a local port or a remote host and port`},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			testGoAWK(t, test.src, "", "", test.err, nil, nil)
+		})
+	}
+}
+
+func TestNetworkNotAllowed(t *testing.T) {
+	// Network access is disabled by NoNetwork, or by any of the other
+	// sandboxing options
+	src := `BEGIN { print "x" > "/inet/tcp/0/127.0.0.1/80" }`
+	errStr := "can't open network connection due to NoNetwork"
+	noNetwork := func(config *interp.Config) {
+		config.NoNetwork = true
+	}
+	testGoAWK(t, src, "", "", errStr, nil, noNetwork)
+	testGoAWK(t, src, "", "", errStr, nil, func(config *interp.Config) {
+		config.NoExec = true
+	})
+	testGoAWK(t, src, "", "", errStr, nil, func(config *interp.Config) {
+		config.NoFileReads = true
+	})
+	testGoAWK(t, `BEGIN { "/inet/tcp/0/127.0.0.1/80" |& getline }`, "", "", errStr, nil, noNetwork)
+}
+
 type mockFlusher struct {
 	bytes.Buffer
 	flushes []string
@@ -1562,6 +2226,268 @@ BEGIN {
 	})
 }
 
+func TestEnvironCommands(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses Unix shell syntax")
+	}
+	src := `BEGIN {
+	ENVIRON["BAR"] = "new"
+	delete ENVIRON["FOO"]
+	system("echo \"$FOO:$BAR\"")
+	"echo $BAR" | getline x
+	print x
+}`
+	testGoAWK(t, src, "", ":new\nnew\n", "", nil, func(config *interp.Config) {
+		config.Environ = []string{"FOO", "old", "BAR", "old", "PATH", os.Getenv("PATH")}
+	})
+
+	// If ENVIRON isn't changed, commands inherit the process environment
+	src = `BEGIN { "echo $PATH" | getline x; print x == ENVIRON["PATH"], x != "" }`
+	testGoAWK(t, src, "", "0 1\n", "", nil, func(config *interp.Config) {
+		config.Environ = []string{}
+	})
+}
+
+func TestProcinfo(t *testing.T) {
+	src := `BEGIN {
+	print PROCINFO["pid"], PROCINFO["ppid"], PROCINFO["version"], PROCINFO["platform"]
+	print PROCINFO["FS"], PROCINFO["INPUTMODE"] == "", PROCINFO["OUTPUTMODE"] == ""
+	INPUTMODE = "tsv header"
+	OUTPUTMODE = "csv"
+	print PROCINFO["FS"], PROCINFO["INPUTMODE"], PROCINFO["OUTPUTMODE"]
+	PROCINFO["INPUTMODE"] = "csv"
+	print INPUTMODE
+}`
+	expected := fmt.Sprintf("%d %d %s %s\nFS 1 1\nTSV,tsv header,csv\ntsv header\n",
+		os.Getpid(), os.Getppid(), interp.Version, runtime.GOOS)
+	testGoAWK(t, src, "", expected, "", nil, nil)
+
+	testGoAWK(t, `BEGIN { print PROCINFO["FS"], PROCINFO["INPUTMODE"] }`, "", "CSV csv\n", "", nil,
+		func(config *interp.Config) {
+			config.InputMode = interp.CSVMode
+		})
+
+	// Older programs may use PROCINFO as a scalar
+	testGoAWK(t, `BEGIN { PROCINFO = 3; INPUTMODE = "csv"; print PROCINFO }`, "", "3\n", "", nil, nil)
+}
+
+func TestStreamInputMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goawk")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	lookup := filepath.Join(dir, "lookup.tsv")
+	err = ioutil.WriteFile(lookup, []byte("id\tname\n1\tBob Smith\n2\tJane, Doe\n"), 0644)
+	if err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+	records := filepath.Join(dir, "records.txt")
+	err = ioutil.WriteFile(records, []byte("a;b;c"), 0644)
+	if err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+	paragraphs := filepath.Join(dir, "paragraphs.txt")
+	err = ioutil.WriteFile(paragraphs, []byte("a,b\nc,d\n\ne,f\n"), 0644)
+	if err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+
+	src := `
+BEGIN {
+	PROCINFO[lookup, "INPUTMODE"] = "tsv header"
+	while ((getline < lookup) > 0) {
+		names[$1] = $2
+	}
+	PROCINFO[records, "INPUTMODE"] = ""  # RS is ignored in CSV mode
+	PROCINFO[records, "RS"] = ";"
+	while ((getline r < records) > 0) {
+		rs = rs "[" r "]"
+	}
+	print rs, RS == "\n"
+}
+{ print $1, names[$1], $2 }
+`
+	testGoAWK(t, src, "1,x y\n2,z\n", "[a][b][c] 1\n1 Bob Smith x y\n2 Jane, Doe z\n", "", nil,
+		func(config *interp.Config) {
+			config.InputMode = interp.CSVMode
+			config.Vars = []string{"lookup", lookup, "records", records}
+		})
+
+	// Reading into $0 explicitly uses the stream's mode too
+	src = `
+BEGIN {
+	PROCINFO[lookup, "INPUTMODE"] = "tsv header"
+	while ((getline $0 < lookup) > 0) {
+		print NF, $2
+	}
+}`
+	testGoAWK(t, src, "", "2 Bob Smith\n2 Jane, Doe\n", "", nil, func(config *interp.Config) {
+		config.Vars = []string{"lookup", lookup}
+	})
+
+	// With the stream's RS set to "", fields are also split on newlines
+	src = `
+BEGIN {
+	FS = ","
+	PROCINFO[paragraphs, "RS"] = ""
+	while ((getline < paragraphs) > 0) {
+		print NF, $3
+	}
+	close(paragraphs)
+	while ((getline $0 < paragraphs) > 0) {
+		print NF, $2
+	}
+}`
+	testGoAWK(t, src, "", "4 c\n2 \n4 b\n2 f\n", "", nil, func(config *interp.Config) {
+		config.Vars = []string{"paragraphs", paragraphs}
+	})
+
+	testGoAWK(t, `BEGIN { PROCINFO[lookup, "INPUTMODE"] = "foo"; getline < lookup }`, "", "",
+		`invalid input mode "foo"`, nil, func(config *interp.Config) {
+			config.Vars = []string{"lookup", lookup}
+		})
+}
+
+func TestDecompress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goawk")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	writeFile := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		err := ioutil.WriteFile(path, data, 0644)
+		if err != nil {
+			t.Fatalf("error writing file: %v", err)
+		}
+		return path
+	}
+
+	var gzBuf bytes.Buffer
+	gw := gzip.NewWriter(&gzBuf)
+	gw.Write([]byte("gz 1\ngz 2\n"))
+	gw.Close()
+	gzFile := writeFile("a.log.gz", gzBuf.Bytes())
+
+	var zlibBuf bytes.Buffer
+	zw := zlib.NewWriter(&zlibBuf)
+	zw.Write([]byte("zlib 1\n"))
+	zw.Close()
+	zlibFile := writeFile("b.z", zlibBuf.Bytes())
+
+	// Output of Python's bz2.compress(b"bz 1\nbz 2\n")
+	bz2File := writeFile("c.bz2", []byte("\x42\x5a\x68\x39\x31\x41\x59\x26\x53\x59\xe5\xf4\xc0\x83"+
+		"\x00\x00\x03\x59\x80\x00\x10\x40\x00\x30\x00\x10\x00\x00\x10\x20\x00\x30\xc0\x04"+
+		"\xa6\x98\x37\x48\x42\x98\x5d\xc9\x14\xe1\x42\x43\x97\xd3\x02\x0c"))
+	plainFile := writeFile("d.txt", []byte("plain\n"))
+	badFile := writeFile("e.gz", []byte("\x1f\x8bxyz"))
+
+	src := `
+BEGIN { while ((getline line < ARGV[2]) > 0) print "getline:", line }
+{ print FILENAME ~ /gz$/, $0 }
+`
+	config := func(config *interp.Config) {
+		config.Decompress = true
+		config.Args = []string{gzFile, zlibFile, bz2File, plainFile}
+	}
+	testGoAWK(t, src, "", "getline: zlib 1\n1 gz 1\n1 gz 2\n0 zlib 1\n0 bz 1\n0 bz 2\n0 plain\n", "", nil, config)
+
+	// Without Decompress the gzip file is read as is
+	testGoAWK(t, `NR==1 { print /^gz/ }`, "", "0\n", "", nil, func(config *interp.Config) {
+		config.Args = []string{gzFile}
+	})
+	testGoAWK(t, `BEGIN { print (getline line < ARGV[1]) }`, "", "-1\n", "", nil, func(config *interp.Config) {
+		config.Decompress = true
+		config.Args = []string{badFile}
+	})
+
+	// Plain text that starts like a bzip2 or zlib header is read as is
+	bzText := writeFile("f.txt", []byte("BZhello\n"))
+	zlibText := writeFile("g.txt", []byte("x^y\n"))
+	testGoAWK(t, `{ print }`, "", "BZhello\nx^y\n", "", nil, func(config *interp.Config) {
+		config.Decompress = true
+		config.Args = []string{bzText, zlibText}
+	})
+}
+
+func TestInPlace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goawk")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	writeFile := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		err := ioutil.WriteFile(path, []byte(data), 0644)
+		if err != nil {
+			t.Fatalf("error writing file: %v", err)
+		}
+		return path
+	}
+	checkFile := func(path, expected string) {
+		t.Helper()
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("error reading file: %v", err)
+		}
+		if string(data) != expected {
+			t.Fatalf("expected %s to contain %q, got %q", filepath.Base(path), expected, data)
+		}
+	}
+
+	a := writeFile("a.conf", "x=1\ny=2\n")
+	b := writeFile("b.conf", "y=3\n")
+	src := `
+BEGIN { print "begin" }
+BEGINFILE { print "# " FILENAME }
+/^y=/ { $0 = "y=" substr($0, 3)*10 }
+{ print }
+ENDFILE { print "endfile", FNR }
+END { print "end" }
+`
+	testGoAWK(t, src, "", "begin\nendfile 2\nendfile 1\nend\n", "", nil, func(config *interp.Config) {
+		config.Args = []string{a, b}
+		config.InPlace = true
+		config.InPlaceSuffix = ".bak"
+	})
+	checkFile(a, "# "+a+"\nx=1\ny=20\n")
+	checkFile(a+".bak", "x=1\ny=2\n")
+	checkFile(b, "# "+b+"\ny=30\n")
+	checkFile(b+".bak", "y=3\n")
+
+	// Exit part way through a file keeps what's been written so far
+	c := writeFile("c.txt", "1\n2\n3\n")
+	testGoAWK(t, `{ print } NR==2 { exit } END { print "end" }`, "", "end\n", "", nil,
+		func(config *interp.Config) {
+			config.Args = []string{c}
+			config.InPlace = true
+		})
+	checkFile(c, "1\n2\n")
+
+	// A runtime error leaves the file unchanged
+	testGoAWK(t, `{ print; x = 1/0 }`, "", "", "division by zero", nil,
+		func(config *interp.Config) {
+			config.Args = []string{c}
+			config.InPlace = true
+		})
+	checkFile(c, "1\n2\n")
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("error reading dir: %v", err)
+	}
+	if len(files) != 5 {
+		t.Fatalf("expected no temporary files to be left, got %d files", len(files))
+	}
+
+	testGoAWK(t, `{ print }`, "", "", "can't edit files in place due to NoFileWrites", nil,
+		func(config *interp.Config) {
+			config.InPlace = true
+			config.NoFileWrites = true
+		})
+}
+
 func TestExit(t *testing.T) {
 	tests := []struct {
 		src    string
@@ -1701,6 +2627,17 @@ var csvTests = []csvTest{
 	{`BEGIN { INPUTMODE="csv header" } NR==1 { for (i=1; i in FIELDS; i++) print i, FIELDS[i] }`, "name,email,age\na,b,c", "1 name\n2 email\n3 age\n", "", nil},
 	{`BEGIN { INPUTMODE="csv" } NR==1 { for (i=1; i in FIELDS; i++) print FIELDS[i] }`, "name,email,age\na,b,c", "", "", nil},
 
+	// printrow() and OFIELDS
+	{`BEGIN { OUTPUTMODE="csv"; OFIELDS[1]="name"; OFIELDS[2]="age"; a["name"]="Bob"; a["age"]=7; a["x"]=1; printrow(a); a["name"]="J, B"; printrow(a) }`, "", "name,age\nBob,7\n\"J, B\",7\n", "", nil},
+	{`BEGIN { OUTPUTMODE="tsv"; f[1]="b"; f[2]="c"; a["a"]=1; a["b"]=2; printrow(a, f) }`, "", "b\tc\n2\t\n", "", nil},
+	{`BEGIN { OUTPUTMODE="csv"; a["b"]=2; a["a"]=1; printrow(a); a["a"]=3; printrow(a) }`, "", "a,b\n1,2\n3,2\n", "", nil},
+	{`BEGIN { OUTPUTMODE="csv"; n = split("c b a", a); printrow(a) }`, "", "c,b,a\n", "", nil},
+	{`BEGIN { OFS="|"; a["x"]=1; a["y"]=2; printrow(a) }`, "", "x|y\n1|2\n", "", nil},
+	{`BEGIN { INPUTMODE="csv header"; OUTPUTMODE="csv" } { for (i=1; i in FIELDS; i++) a[FIELDS[i]]=$i; a["age"]++; printrow(a, FIELDS) }`, "name,age\nBob,42", "name,age\nBob,43\n", "", nil},
+	{`BEGIN { printrow(1) }`, "", "", "parse error at 1:18: expected name instead of number", nil},
+	{`BEGIN { OFIELDS = 3; print OFIELDS; f[1]="x"; a["x"]=1; printrow(a, f) }`, "", "3\nx\n1\n", "", nil},
+	{`BEGIN { OFIELDS = 3; a[1]=1; printrow(a) }`, "", "", `parse error at 1:39: can't use scalar "OFIELDS" as array`, nil},
+
 	// Parsing and formatting of INPUTMODE and OUTPUTMODE special variables
 	{`BEGIN { INPUTMODE="csv separator=,"; print INPUTMODE }`, "", "csv\n", "", nil},
 	{`BEGIN { INPUTMODE="csv header=true comment=# separator=|"; print INPUTMODE }`, "", "csv separator=| comment=# header\n", "", nil},
@@ -1709,22 +2646,61 @@ var csvTests = []csvTest{
 
 	// Ignores UTF-8 byte order mark (BOM) at start of CSV file
 	{`BEGIN { INPUTMODE="csv" } { print $1=="foo" }`, "\ufefffoo,bar\n\ufefffoo,bar", "1\n0\n", "", nil},
+	{`BEGIN { INPUTMODE="csv" } { print $0 "|" $2 }`, "\ufefffoo,bar\nx,y", "foo,bar|bar\nx,y|y\n", "", nil},
+
+	// Only splits as many fields as needed, but handles quoted fields
+	{`BEGIN { INPUTMODE="csv" } { print $1 }`, "a,b,\"c\nd\",e\nf,g", "a\nf\n", "", nil},
+	{`BEGIN { INPUTMODE="csv" } { print $2 }`, "a,\"b\"\"c\",d\ne,\"f\r\ng\",h", "b\"c\nf\ng\n", "", nil},
+	{`BEGIN { INPUTMODE="csv" } { print $1, $3 }`, "a,\"b\",c\nd", "a c\nd \n", "", nil},
+	{`BEGIN { INPUTMODE="csv" } { print $1 } END { print NF }`, "a,b,c\nd,e", "a\nd\n2\n", "", nil},
+	{`BEGIN { INPUTMODE="csv" } { print $1; $0 = "x,y,z"; print $3 }`, "a,b,c", "a\nz\n", "", nil},
+	{`BEGIN { INPUTMODE="csv" } { getline x; print $1, x }`, "a,b\nc,d", "a c,d\n", "", nil},
+	{`BEGIN { INPUTMODE="csv" } { print $1 "|" $2 "|" $3 }`, "\"a\"b\",c\n", "a\"b|c|\n", "", nil},
 
 	// Error handling when parsing INPUTMODE and OUTPUTMODE
 	{`BEGIN { INPUTMODE="xyz" }`, "", "", `invalid input mode "xyz"`, nil},
 	{`BEGIN { INPUTMODE="csv separator=foo" }`, "", "", `invalid CSV/TSV separator "foo"`, nil},
 	{`BEGIN { INPUTMODE="csv comment=bar" }`, "", "", `invalid CSV/TSV comment character "bar"`, nil},
-	{`BEGIN { INPUTMODE="csv header=x" }`, "", "", `invalid header value "x"`, nil},
+	{`BEGIN { INPUTMODE="csv header=a,,b" }`, "", "", `invalid header value "a,,b"`, nil},
 	{`BEGIN { INPUTMODE="csv foo=bar" }`, "", "", `invalid input mode key "foo"`, nil},
 	{`BEGIN { OUTPUTMODE="xyz" }`, "", "", `invalid output mode "xyz"`, nil},
 	{`BEGIN { OUTPUTMODE="csv separator=foo" }`, "", "", `invalid CSV/TSV separator "foo"`, nil},
 	{`BEGIN { OUTPUTMODE="csv foo=bar" }`, "", "", `invalid output mode key "foo"`, nil},
 
-	// Other errors
-	{`BEGIN { @"x" = "y" }`, "", "", "parse error at 1:14: assigning @ expression not supported", nil},
-	{`BEGIN { x="a"; @x = "y" }`, "", "", "parse error at 1:19: assigning @ expression not supported", nil},
-	{`BEGIN { @"x" += "y" }`, "", "", "parse error at 1:14: assigning @ expression not supported", nil},
-	{`BEGIN { x="a"; @x += "y" }`, "", "", "parse error at 1:19: assigning @ expression not supported", nil},
+	// Named field assignment
+	{`BEGIN { INPUTMODE="csv header"; OUTPUTMODE="csv" } { @"email" = tolower(@"email"); print; print $2 }`, "name,email\nBob,BOB@X.COM", "Bob,bob@x.com\nbob@x.com\n", "", nil},
+	{`BEGIN { INPUTMODE="csv header" } { f="age"; @f++; print; @f += 10; print; print ++@"age", @"age"--, $2 }`, "name,age\nBob,42", "Bob 43\nBob 53\n54 54 53\n", "", nil},
+	{`BEGIN { INPUTMODE="csv header" } { sub(/o/, "0", @"name"); print $1 }`, "name,age\nBob,42", "B0b\n", "", nil},
+	{`BEGIN { INPUTMODE="csv header" } { @"age" = 1; print NF, $0 }`, "name,age\nBob", "2 Bob 1\n", "", nil},
+	{`BEGIN { INPUTMODE="csv header" } { @"x" = "y" }`, "name,age\nBob,42", "", `can't assign to field "x": not in header`, nil},
+	{`BEGIN { @"x" = "y" }`, "", "", `@ only supported if header parsing enabled; use -H or add "header" to INPUTMODE`, nil},
+
+	// Header row in output
+	{`BEGIN { INPUTMODE="csv header"; OUTPUTMODE="csv header" } { @"age"++; print }`, "name,age\nBob,42\nJane,37", "name,age\nBob,43\nJane,38\n", "", nil},
+	{`BEGIN { INPUTMODE="csv header"; OUTPUTMODE="tsv header" } { printf "x\n"; print $1, $2 }`, "name,age\nBob,42", "x\nname\tage\nBob\t42\n", "", nil},
+	{`BEGIN { INPUTMODE="csv header"; OUTPUTMODE="csv header"; OFIELDS[1]="age" } { a["age"]=$2; printrow(a) }`, "name,age\nBob,42", "name,age\n42\n", "", nil},
+	{`BEGIN { OUTPUTMODE="csv header" } { print }`, "a,b", "a,b\n", "", nil},
+	{`BEGIN { OUTPUTMODE="csv separator=| header"; printf "%s", OUTPUTMODE }`, "", "csv separator=| header", "", nil},
+	{`BEGIN { OUTPUTMODE="csv header=x" }`, "", "", `invalid header value "x"`, nil},
+
+	// Explicit header names, skipheader, and trimspace
+	{`BEGIN { INPUTMODE="csv header=id,name" } { print @"name", FIELDS[1] }`, "1,Bob\n2,Jane", "Bob id\nJane id\n", "", nil},
+	{`BEGIN { INPUTMODE="csv header=x" } { print @"x" }`, "a,b\nc,d", "a\nc\n", "", nil},
+	{`BEGIN { INPUTMODE="csv header=a,b skipheader" } { print @"a", @"b" }`, "name,age\nBob,42", "Bob 42\n", "", nil},
+	{`BEGIN { INPUTMODE="csv header=a,b" } { @"b"++; print }`, "Bob,42", "Bob 43\n", "", nil},
+	{`BEGIN { INPUTMODE="csv header=false" } { print NR, $1 }`, "a,b\nc,d", "1 a\n2 c\n", "", nil},
+	{`BEGIN { INPUTMODE="csv trimspace" } { print $2 "|" $3 }`, "a,  b,\t c", "b|c\n", "", nil},
+	{`BEGIN { INPUTMODE="tsv trimspace" } { print NF, $2 "|" $3 }`, "a\t\t  c", "3 |c\n", "", nil},
+	{`BEGIN { INPUTMODE="csv" } { print $2 }`, "a,  b", "  b\n", "", nil},
+	{`BEGIN { INPUTMODE="csv trimspace header=a,b skipheader"; printf "%s", INPUTMODE }`, "", "csv trimspace header=a,b skipheader", "", nil},
+	{`BEGIN { INPUTMODE="csv header=a,b"; printf "%s", INPUTMODE }`, "", "csv header=a,b", "", nil},
+	{`BEGIN { INPUTMODE="csv skipheader"; printf "%s", INPUTMODE }`, "", "csv header", "", nil},
+	{`BEGIN { INPUTMODE="csv" } { $0=""; print NF }`, "a,b,c\n", "0\n", "", nil},
+	{`BEGIN { INPUTMODE="csv comment=#" } { $0="#x,y"; print NF }`, "a,b,c\n", "0\n", "", nil},
+	{`{ print @"name" }`, "1,Bob", "Bob\n", "", func(config *interp.Config) {
+		config.InputMode = interp.CSVMode
+		config.CSVInput = interp.CSVInputConfig{HeaderNames: []string{"id", "name"}}
+	}},
 }
 
 func TestCSV(t *testing.T) {
@@ -2248,6 +3224,24 @@ func BenchmarkGetField(b *testing.B) {
 	benchmarkProgram(b, nil, input, expected, "{ print $1, $3 }")
 }
 
+func BenchmarkGetFieldWide(b *testing.B) {
+	b.StopTimer()
+	var fields []string
+	for i := 1; i <= 200; i++ {
+		fields = append(fields, fmt.Sprintf("field%d", i))
+	}
+	line := strings.Join(fields, " ")
+	inputLines := []string{}
+	expectedLines := []string{}
+	for i := 0; i < b.N; i++ {
+		inputLines = append(inputLines, line)
+		expectedLines = append(expectedLines, "field1 field3")
+	}
+	input := strings.Join(inputLines, "\n")
+	expected := strings.Join(expectedLines, "\n")
+	benchmarkProgram(b, nil, input, expected, "{ print $1, $3 }")
+}
+
 func BenchmarkSetField(b *testing.B) {
 	benchmarkProgram(b, nil, "1 2 3", "one 2 three", `
 {
@@ -2281,6 +3275,22 @@ BEGIN {
 `, b.N)
 }
 
+func BenchmarkRegexMatchLiteral(b *testing.B) {
+	benchmarkProgram(b, nil, "", "1", `
+BEGIN {
+  s = "The quick brown fox jumps over the lazy dog"
+  for (i = 0; i < %d; i++) {
+  	x = s ~ /jumps/
+  	x = s ~ /jumps/
+  	x = s ~ /jumps/
+  	x = s ~ /jumps/
+  	x = s ~ /jumps/
+  }
+  print x
+}
+`, b.N)
+}
+
 func BenchmarkBinaryOperators(b *testing.B) {
 	benchmarkProgram(b, nil, "", "5.0293", `
 BEGIN {
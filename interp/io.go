@@ -10,13 +10,15 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"unicode"
 	"unicode/utf8"
 
+	"github.com/benhoyt/goawk/internal/compiler"
 	"github.com/benhoyt/goawk/internal/resolver"
 	. "github.com/benhoyt/goawk/lexer"
 )
@@ -64,6 +66,78 @@ func (p *interp) printArgs(writer io.Writer, args []value) error {
 	return nil
 }
 
+// Print a row made from the values in array, in the order given by the
+// field names in fields[1] to fields[n]. If fields is empty, use the keys
+// of array, in numeric order if they're all numbers, otherwise sorted as
+// strings. The first call also prints a header row with the field names
+// (unless they're numbers, or the "header" output option is set).
+func (p *interp) printrow(writer io.Writer, array, fields map[string]value) error {
+	var names []string
+	numeric := false
+	if len(fields) > 0 {
+		names = make([]string, len(fields))
+		for i := range names {
+			names[i] = p.toString(fields[strconv.Itoa(i+1)])
+		}
+	} else {
+		names = make([]string, 0, len(array))
+		for k := range array {
+			names = append(names, k)
+		}
+		numeric = true
+		for _, name := range names {
+			if _, err := strconv.Atoi(name); err != nil {
+				numeric = false
+				break
+			}
+		}
+		if numeric {
+			sort.Slice(names, func(i, j int) bool {
+				a, _ := strconv.Atoi(names[i])
+				b, _ := strconv.Atoi(names[j])
+				return a < b
+			})
+		} else {
+			sort.Strings(names)
+		}
+	}
+
+	err := p.printOutputHeader()
+	if err != nil {
+		return err
+	}
+	if !p.rowHeaderDone {
+		p.rowHeaderDone = true
+		if !numeric && !p.csvOutputConfig.Header {
+			header := make([]value, len(names))
+			for i, name := range names {
+				header[i] = str(name)
+			}
+			err := p.printArgs(writer, header)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	row := make([]value, len(names))
+	for i, name := range names {
+		row[i] = array[name] // missing keys are output as empty fields
+	}
+	return p.printArgs(writer, row)
+}
+
+// If the "header" output mode option is set, print the input's header row
+// before the first record printed to standard output.
+func (p *interp) printOutputHeader() error {
+	if !p.csvOutputConfig.Header || p.outHeaderDone || p.fieldNames == nil ||
+		(p.outputMode != CSVMode && p.outputMode != TSVMode) {
+		return nil
+	}
+	p.outHeaderDone = true
+	return p.writeCSV(p.output, p.fieldNames)
+}
+
 func (p *interp) writeCSV(output io.Writer, fields []string) error {
 	// If output is already a *bufio.Writer (the common case), csv.NewWriter
 	// will use it directly. This is not explicitly documented, but
@@ -121,18 +195,26 @@ func (wc *bufferedWriteCloser) Close() error {
 // destination (file or pipe name)
 func (p *interp) getOutputStream(redirect Token, destValue value) (io.Writer, error) {
 	name := p.toString(destValue)
+	if redirect == PIPE_AMP || (redirect != PIPE && isNetworkName(name)) {
+		// Network special files are two-way, like coprocesses
+		return p.getCoprocessWriter(name)
+	}
 	if _, ok := p.inputStreams[name]; ok {
 		return nil, newError("can't write to reader stream")
 	}
+	if _, ok := p.coprocesses[name]; ok {
+		return nil, newError("can't write to coprocess stream")
+	}
 	if w, ok := p.outputStreams[name]; ok {
 		return w, nil
 	}
 
 	switch redirect {
 	case GREATER, APPEND:
-		if name == "-" {
-			// filename of "-" means write to stdout, eg: print "x" >"-"
-			return p.output, nil
+		if w := p.standardOutput(name); w != nil {
+			// "-", "/dev/stdout", and "/dev/stderr" write to the configured
+			// Output and Error writers, eg: print "x" >"/dev/stderr"
+			return w, nil
 		}
 		// Write or append to file
 		if p.noFileWrites {
@@ -147,6 +229,7 @@ func (p *interp) getOutputStream(redirect Token, destValue value) (io.Writer, er
 		}
 		w, err := os.OpenFile(name, flags, 0644)
 		if err != nil {
+			p.errno = errnoString(err)
 			return nil, newError("output redirection error: %s", err)
 		}
 		buffered := newBufferedWriteCloser(w)
@@ -158,21 +241,19 @@ func (p *interp) getOutputStream(redirect Token, destValue value) (io.Writer, er
 		if p.noExec {
 			return nil, newError("can't write to pipe due to NoExec")
 		}
-		cmd := p.execShell(name)
-		w, err := cmd.StdinPipe()
-		if err != nil {
-			return nil, newError("error connecting to stdin pipe: %v", err)
-		}
-		cmd.Stdout = p.output
-		cmd.Stderr = p.errorOutput
 		p.flushOutputAndError() // ensure synchronization
-		err = cmd.Start()
+		process, err := p.startCommand(&Command{
+			Line:   name,
+			Stdout: p.output,
+			Stderr: p.errorOutput,
+		})
 		if err != nil {
 			p.printErrorf("%s\n", err)
+			p.errno = err.Error()
 			return ioutil.Discard, nil
 		}
-		p.commands[name] = cmd
-		buffered := newBufferedWriteCloser(w)
+		p.commands[name] = process
+		buffered := newBufferedWriteCloser(process.Stdin())
 		p.outputStreams[name] = buffered
 		return buffered, nil
 
@@ -182,74 +263,224 @@ func (p *interp) getOutputStream(redirect Token, destValue value) (io.Writer, er
 	}
 }
 
-// Executes code using configured system shell
-func (p *interp) execShell(code string) *exec.Cmd {
-	executable := p.shellCommand[0]
-	args := p.shellCommand[1:]
-	args = append(args, code)
-	if p.checkCtx {
-		return exec.CommandContext(p.ctx, executable, args...)
+// A coprocess is a command started by a two-way pipe: print |& cmd writes
+// to its stdin, and cmd |& getline reads from its stdout. Either end can
+// be closed separately using close(cmd, "to") or close(cmd, "from").
+// Connections to network special files are also handled as coprocesses.
+type coprocess struct {
+	process Process
+	writer  *bufferedWriteCloser // nil after close(cmd, "to")
+	reader  io.ReadCloser        // nil after close(cmd, "from")
+	scanner *bufio.Scanner
+}
+
+// Get the coprocess for the given command, starting it if it's not
+// already running. Returns nil if the command couldn't be started.
+func (p *interp) getCoprocess(name string) (*coprocess, error) {
+	if c, ok := p.coprocesses[name]; ok {
+		return c, nil
+	}
+	if _, ok := p.inputStreams[name]; ok {
+		return nil, newError("can't use reader stream as coprocess")
+	}
+	if _, ok := p.outputStreams[name]; ok {
+		return nil, newError("can't use writer stream as coprocess")
+	}
+	var process Process
+	var err error
+	if isNetworkName(name) {
+		if p.noNetwork {
+			return nil, newError("can't open network connection due to NoNetwork")
+		}
+		p.flushOutputAndError() // ensure synchronization
+		process, err = p.openNetwork(name)
+		if _, ok := err.(*Error); ok {
+			return nil, err
+		}
 	} else {
-		return exec.Command(executable, args...)
+		if p.noExec {
+			return nil, newError("can't start coprocess due to NoExec")
+		}
+		p.flushOutputAndError() // ensure synchronization
+		process, err = p.startCommand(&Command{Line: name, Stderr: p.errorOutput})
+	}
+	if err != nil {
+		p.printErrorf("%s\n", err)
+		p.errno = err.Error()
+		return nil, nil
 	}
+	r := process.Stdout()
+	scanner, err := p.newStreamScanner(name, r)
+	if err != nil {
+		_ = process.Stdin().Close()
+		_ = r.Close()
+		_, _ = process.Wait()
+		return nil, err
+	}
+	c := &coprocess{
+		process: process,
+		writer:  newBufferedWriteCloser(process.Stdin()),
+		reader:  r,
+		scanner: scanner,
+	}
+	p.coprocesses[name] = c
+	return c, nil
+}
+
+// Get the writer for "print |& cmd".
+func (p *interp) getCoprocessWriter(name string) (io.Writer, error) {
+	c, err := p.getCoprocess(name)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return ioutil.Discard, nil
+	}
+	if c.writer == nil {
+		return nil, newError("can't write to coprocess after closing it for writing")
+	}
+	return c.writer, nil
+}
+
+// Get input Scanner to use for "cmd |& getline". Output written to the
+// coprocess is flushed first, so that it can respond to it.
+func (p *interp) getInputScannerCoprocess(name string) (*bufio.Scanner, error) {
+	c, err := p.getCoprocess(name)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return bufio.NewScanner(strings.NewReader("")), nil
+	}
+	if c.scanner == nil {
+		return nil, newError("can't read from coprocess after closing it for reading")
+	}
+	if c.writer != nil {
+		_ = c.writer.Flush()
+	}
+	return c.scanner, nil
+}
+
+// Close one or both ends of a coprocess (how is "to", "from", or "" for
+// both). When both ends are closed, wait for the command to exit and
+// return its exit status.
+func (p *interp) closeCoprocess(name string, c *coprocess, how string) (int, error) {
+	var err error
+	if c.writer != nil && how != "from" {
+		err = c.writer.Close()
+		c.writer = nil
+	}
+	if c.reader != nil && how != "to" {
+		if closeErr := c.reader.Close(); err == nil {
+			err = closeErr
+		}
+		c.reader = nil
+		c.scanner = nil
+		delete(p.streamModes, name)
+	}
+	status := 0
+	if c.writer == nil && c.reader == nil {
+		delete(p.coprocesses, name)
+		status = p.setCommandStatus(c.process.Wait())
+	}
+	return status, err
 }
 
 // Get input Scanner to use for "getline" based on file name
 func (p *interp) getInputScannerFile(name string) (*bufio.Scanner, error) {
+	if isNetworkName(name) {
+		// Network special files are two-way, like coprocesses
+		return p.getInputScannerCoprocess(name)
+	}
 	if _, ok := p.outputStreams[name]; ok {
 		return nil, newError("can't read from writer stream")
 	}
+	if _, ok := p.coprocesses[name]; ok {
+		return nil, newError("can't read from coprocess stream")
+	}
 	if _, ok := p.inputStreams[name]; ok {
 		return p.scanners[name], nil
 	}
-	if name == "-" {
-		// filename of "-" means read from stdin, eg: getline <"-"
+	if isStandardInput(name) {
+		// "-" and "/dev/stdin" read from the configured Stdin, eg: getline <"-"
 		if scanner, ok := p.scanners["-"]; ok {
 			return scanner, nil
 		}
 		scanner := p.newScanner(p.stdin, make([]byte, inputBufSize))
-		p.scanners[name] = scanner
+		p.scanners["-"] = scanner
 		return scanner, nil
 	}
 	if p.noFileReads {
 		return nil, newError("can't read from file due to NoFileReads")
 	}
-	r, err := os.Open(name)
+	r, err := p.openInputFile(name)
 	if err != nil {
+		p.errno = errnoString(err)
 		return nil, err // *os.PathError is handled by caller (getline returns -1)
 	}
-	scanner := p.newScanner(r, make([]byte, inputBufSize))
+	scanner, err := p.newStreamScanner(name, r)
+	if err != nil {
+		_ = r.Close()
+		return nil, err
+	}
 	p.scanners[name] = scanner
 	p.inputStreams[name] = r
 	return scanner, nil
 }
 
+// Return the configured writer for the special output file name ("-" or
+// "/dev/stdout" for Output, "/dev/stderr" for Error), or nil if name isn't
+// one of those. These are handled in-process, so they're portable and work
+// even if NoFileWrites is set.
+func (p *interp) standardOutput(name string) io.Writer {
+	switch name {
+	case "-", "/dev/stdout", "/dev/fd/1":
+		return p.output
+	case "/dev/stderr", "/dev/fd/2":
+		return p.errorOutput
+	default:
+		return nil
+	}
+}
+
+// Report whether name is a special input file name for Stdin.
+func isStandardInput(name string) bool {
+	return name == "-" || name == "/dev/stdin" || name == "/dev/fd/0"
+}
+
 // Get input Scanner to use for "getline" based on pipe name
 func (p *interp) getInputScannerPipe(name string) (*bufio.Scanner, error) {
 	if _, ok := p.outputStreams[name]; ok {
 		return nil, newError("can't read from writer stream")
 	}
+	if _, ok := p.coprocesses[name]; ok {
+		return nil, newError("can't read from coprocess stream")
+	}
 	if _, ok := p.inputStreams[name]; ok {
 		return p.scanners[name], nil
 	}
 	if p.noExec {
 		return nil, newError("can't read from pipe due to NoExec")
 	}
-	cmd := p.execShell(name)
-	cmd.Stdin = p.stdin
-	cmd.Stderr = p.errorOutput
-	r, err := cmd.StdoutPipe()
-	if err != nil {
-		return nil, newError("error connecting to stdout pipe: %v", err)
-	}
 	p.flushOutputAndError() // ensure synchronization
-	err = cmd.Start()
+	process, err := p.startCommand(&Command{
+		Line:   name,
+		Stdin:  p.stdin,
+		Stderr: p.errorOutput,
+	})
 	if err != nil {
 		p.printErrorf("%s\n", err)
+		p.errno = err.Error()
 		return bufio.NewScanner(strings.NewReader("")), nil
 	}
-	scanner := p.newScanner(r, make([]byte, inputBufSize))
-	p.commands[name] = cmd
+	r := process.Stdout()
+	scanner, err := p.newStreamScanner(name, r)
+	if err != nil {
+		_ = r.Close()
+		_, _ = process.Wait()
+		return nil, err
+	}
+	p.commands[name] = process
 	p.inputStreams[name] = r
 	p.scanners[name] = scanner
 	return scanner, nil
@@ -257,36 +488,118 @@ func (p *interp) getInputScannerPipe(name string) (*bufio.Scanner, error) {
 
 // Create a new buffered Scanner for reading input records
 func (p *interp) newScanner(input io.Reader, buffer []byte) *bufio.Scanner {
+	config := scannerConfig{
+		mode:           p.inputMode,
+		csvConfig:      p.csvInputConfig,
+		recordSep:      p.recordSep,
+		recordSepRegex: p.recordSepRegex,
+		record:         &p.scanRecord,
+		setFieldNames:  p.setFieldNames,
+	}
+	return p.newScannerConfig(input, buffer, config)
+}
+
+// How a Scanner splits its input into records (and fields, in CSV and TSV
+// modes).
+type scannerConfig struct {
+	mode           IOMode
+	csvConfig      CSVInputConfig
+	recordSep      string
+	recordSepRegex *regexp.Regexp
+	record         *csvRecord
+	setFieldNames  func(names []string)
+}
+
+func (p *interp) newScannerConfig(input io.Reader, buffer []byte, config scannerConfig) *bufio.Scanner {
 	scanner := bufio.NewScanner(input)
 	switch {
-	case p.inputMode == CSVMode || p.inputMode == TSVMode:
+	case config.mode == CSVMode || config.mode == TSVMode:
 		splitter := csvSplitter{
-			separator:     p.csvInputConfig.Separator,
-			sepLen:        utf8.RuneLen(p.csvInputConfig.Separator),
-			comment:       p.csvInputConfig.Comment,
-			header:        p.csvInputConfig.Header,
-			fields:        &p.fields,
-			setFieldNames: p.setFieldNames,
+			separator:     config.csvConfig.Separator,
+			sepLen:        utf8.RuneLen(config.csvConfig.Separator),
+			comment:       config.csvConfig.Comment,
+			header:        config.csvConfig.Header,
+			headerNames:   config.csvConfig.HeaderNames,
+			trimSpace:     config.csvConfig.TrimLeadingSpace,
+			maxField:      p.maxField,
+			record:        config.record,
+			setFieldNames: config.setFieldNames,
 		}
 		scanner.Split(splitter.scan)
-	case p.recordSep == "\n":
+	case config.recordSep == "\n":
 		// Scanner default is to split on newlines
-	case p.recordSep == "":
+	case config.recordSep == "":
 		// Empty string for RS means split on \n\n (blank lines)
 		splitter := blankLineSplitter{terminator: &p.recordTerminator}
 		scanner.Split(splitter.scan)
-	case len(p.recordSep) == 1:
-		splitter := byteSplitter{sep: p.recordSep[0]}
+	case len(config.recordSep) == 1:
+		splitter := byteSplitter{sep: config.recordSep[0]}
 		scanner.Split(splitter.scan)
-	case utf8.RuneCountInString(p.recordSep) >= 1:
+	case utf8.RuneCountInString(config.recordSep) >= 1:
 		// Multi-byte and single char but multi-byte RS use regex
-		splitter := regexSplitter{re: p.recordSepRegex, terminator: &p.recordTerminator}
+		splitter := regexSplitter{re: config.recordSepRegex, terminator: &p.recordTerminator}
 		scanner.Split(splitter.scan)
 	}
 	scanner.Buffer(buffer, maxRecordLength)
 	return scanner
 }
 
+// Input parsing configuration of a stream read by getline, set using
+// PROCINFO[name, "INPUTMODE"] or PROCINFO[name, "RS"] before the stream is
+// opened, for example to read a TSV lookup file while the main input is
+// CSV.
+type streamMode struct {
+	mode      IOMode
+	csvConfig CSVInputConfig
+	recordSep string    // RS, for splitting fields on newlines if it's ""
+	record    csvRecord // fields of the last record read (CSV and TSV modes)
+}
+
+// Create a Scanner for an input stream read by getline (a file, command,
+// or coprocess), using the stream's own input mode and record separator if
+// they're set in PROCINFO.
+func (p *interp) newStreamScanner(name string, input io.Reader) (*bufio.Scanner, error) {
+	buffer := make([]byte, inputBufSize)
+	procinfo := p.procinfo()
+	modeValue, hasMode := procinfo[name+p.subscriptSep+"INPUTMODE"]
+	rsValue, hasRS := procinfo[name+p.subscriptSep+"RS"]
+	if !hasMode && !hasRS {
+		return p.newScanner(input, buffer), nil
+	}
+
+	stream := &streamMode{mode: p.inputMode, csvConfig: p.csvInputConfig, recordSep: p.recordSep}
+	if hasMode {
+		var err error
+		stream.mode, stream.csvConfig, err = parseInputMode(p.toString(modeValue))
+		if err != nil {
+			return nil, err
+		}
+		err = validateCSVInputConfig(stream.mode, stream.csvConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+	config := scannerConfig{
+		mode:           stream.mode,
+		csvConfig:      stream.csvConfig,
+		recordSep:      p.recordSep,
+		recordSepRegex: p.recordSepRegex,
+		record:         &stream.record,
+		setFieldNames:  func(names []string) {}, // header row is skipped
+	}
+	if hasRS {
+		config.recordSep = p.toString(rsValue)
+		stream.recordSep = config.recordSep
+		var err error
+		config.recordSepRegex, err = compileRecordSep(config.recordSep)
+		if err != nil {
+			return nil, err
+		}
+	}
+	p.streamModes[name] = stream
+	return p.newScannerConfig(input, buffer, config), nil
+}
+
 // setFieldNames is called by csvSplitter.scan on the first row (if the
 // "header" option is specified).
 func (p *interp) setFieldNames(names []string) {
@@ -303,6 +616,14 @@ func (p *interp) setFieldNames(names []string) {
 	}
 }
 
+// If field names are configured for CSV or TSV input, use them for named
+// fields and the FIELDS array (for input without a header row).
+func (p *interp) setHeaderNames() {
+	if (p.inputMode == CSVMode || p.inputMode == TSVMode) && p.csvInputConfig.HeaderNames != nil {
+		p.setFieldNames(p.csvInputConfig.HeaderNames)
+	}
+}
+
 // Copied from bufio/scan.go in the stdlib: I guess it's a bit more
 // efficient than bytes.TrimSuffix(data, []byte("\r"))
 func dropCR(data []byte) []byte {
@@ -423,30 +744,65 @@ func (s regexSplitter) scan(data []byte, atEOF bool) (advance int, token []byte,
 
 // Splitter that splits records in CSV or TSV format.
 type csvSplitter struct {
-	separator rune
-	sepLen    int
-	comment   rune
-	header    bool
+	separator   rune
+	sepLen      int
+	comment     rune
+	header      bool
+	headerNames []string // if set, use these names instead of header row
+	trimSpace   bool
+	maxField    int // only split fields up to this one (all if negative)
 
 	recordBuffer []byte
-	fieldIndexes []int
 	noBOMCheck   bool
 
-	fields        *[]string
+	record        *csvRecord
 	setFieldNames func(names []string)
 	rowNum        int
 }
 
+// Positions of the fields of a CSV or TSV record found by csvSplitter.scan.
+// The field strings aren't created till they're needed (see ensureFields),
+// and most are substrings of the line itself, so they aren't copied.
+type csvRecord struct {
+	// Start and end offset in the line of each field, in pairs. If the
+	// start offset is negative, the field had to be unescaped (because it
+	// contains "" or \r\n), and its value is unescaped[-start-1].
+	offsets   []int
+	unescaped []string
+}
+
+// Append the record's fields to dst, slicing them out of line (the token
+// returned by csvSplitter.scan).
+func (r *csvRecord) appendFields(dst []string, line string) []string {
+	for i := 0; i < len(r.offsets); i += 2 {
+		start, end := r.offsets[i], r.offsets[i+1]
+		if start < 0 {
+			dst = append(dst, r.unescaped[-start-1])
+		} else {
+			dst = append(dst, line[start:end])
+		}
+	}
+	return dst
+}
+
+// Add an unescaped field value to the record.
+func (r *csvRecord) addUnescaped(field []byte) {
+	r.unescaped = append(r.unescaped, string(field))
+	r.offsets = append(r.offsets, -len(r.unescaped), 0)
+}
+
 // The structure of this code is taken from the stdlib encoding/csv Reader
 // code, which is licensed under a compatible BSD-style license.
 //
 // We don't support all encoding/csv features: FieldsPerRecord is not
-// supported, LazyQuotes is always on, and TrimLeadingSpace is always off.
+// supported, and LazyQuotes is always on.
 func (s *csvSplitter) scan(data []byte, atEOF bool) (advance int, token []byte, err error) {
 	// Some CSV files are saved with a UTF-8 BOM at the start; skip it.
+	bomLen := 0
 	if !s.noBOMCheck && len(data) >= 3 && data[0] == 0xEF && data[1] == 0xBB && data[2] == 0xBF {
 		data = data[3:]
-		advance = 3
+		bomLen = 3
+		advance = bomLen
 		s.noBOMCheck = true
 	}
 
@@ -456,6 +812,7 @@ func (s *csvSplitter) scan(data []byte, atEOF bool) (advance int, token []byte,
 		return 0, nil, nil
 	}
 
+	droppedCR := 0
 	readLine := func() []byte {
 		newline := bytes.IndexByte(data, '\n')
 		var line []byte
@@ -476,7 +833,7 @@ func (s *csvSplitter) scan(data []byte, atEOF bool) (advance int, token []byte,
 		// For backwards compatibility, drop trailing \r before EOF.
 		if len(line) > 0 && atEOF && line[len(line)-1] == '\r' {
 			line = line[:len(line)-1]
-			advance++
+			droppedCR = 1
 		}
 
 		return line
@@ -503,35 +860,68 @@ func (s *csvSplitter) scan(data []byte, atEOF bool) (advance int, token []byte,
 		break
 	}
 
-	// Parse each field in the record.
+	// Header row is always split in full.
+	maxField := s.maxField
+	if s.header && s.rowNum == 0 {
+		maxField = -1
+	}
+
+	// Parse each field in the record, recording its offsets relative to
+	// the start of the record (advance-start).
 	const quoteLen = len(`"`)
+	start := advance
 	tokenHasCR := false
-	s.recordBuffer = s.recordBuffer[:0]
-	s.fieldIndexes = s.fieldIndexes[:0]
+	record := s.record
+	record.offsets = record.offsets[:0]
+	record.unescaped = record.unescaped[:0]
 parseField:
 	for {
+		if maxField >= 0 && len(record.offsets)/2 >= maxField && bytes.IndexByte(line, '"') < 0 {
+			// Rest of the fields aren't needed, and there are no quoted
+			// fields (which could span lines), so skip to end of record.
+			advance += len(line)
+			break parseField
+		}
+		if s.trimSpace {
+			// Skip leading whitespace (but not the separator, for TSV)
+			i := bytes.IndexFunc(line, func(r rune) bool {
+				return !unicode.IsSpace(r) || r == s.separator
+			})
+			if i < 0 {
+				i = len(line) - lenNewline(line)
+			}
+			line = line[i:]
+			advance += i
+		}
 		if len(line) == 0 || line[0] != '"' {
-			// Non-quoted string field
+			// Non-quoted string field (never needs unescaping)
+			fieldStart := advance - start
 			i := bytes.IndexRune(line, s.separator)
-			field := line
 			if i >= 0 {
+				record.offsets = append(record.offsets, fieldStart, fieldStart+i)
 				advance += i + s.sepLen
-				field = field[:i]
-			} else {
-				advance += len(field)
-				field = field[:len(field)-lenNewline(field)]
-			}
-			s.recordBuffer = append(s.recordBuffer, field...)
-			s.fieldIndexes = append(s.fieldIndexes, len(s.recordBuffer))
-			if i >= 0 {
 				line = line[i+s.sepLen:]
 				continue parseField
 			}
+			record.offsets = append(record.offsets, fieldStart, fieldStart+len(line)-lenNewline(line))
+			advance += len(line)
 			break parseField
 		} else {
-			// Quoted string field
+			// Quoted string field. If it doesn't contain "" or \r\n, its
+			// value is the text between the quotes (including any bare
+			// quotes), otherwise use the unescaped value from recordBuffer.
 			line = line[quoteLen:]
 			advance += quoteLen
+			fieldStart := advance - start
+			escaped := false
+			s.recordBuffer = s.recordBuffer[:0]
+			endField := func() {
+				if escaped {
+					record.addUnescaped(s.recordBuffer)
+				} else {
+					record.offsets = append(record.offsets, fieldStart, fieldStart+len(s.recordBuffer))
+				}
+			}
 			for {
 				i := bytes.IndexByte(line, '"')
 				if i >= 0 {
@@ -545,15 +935,16 @@ parseField:
 						s.recordBuffer = append(s.recordBuffer, '"')
 						line = line[quoteLen:]
 						advance += quoteLen
+						escaped = true
 					case rn == s.separator:
 						// `",` sequence (end of field).
 						line = line[s.sepLen:]
-						s.fieldIndexes = append(s.fieldIndexes, len(s.recordBuffer))
+						endField()
 						advance += s.sepLen
 						continue parseField
 					case lenNewline(line) == len(line):
 						// `"\n` sequence (end of line).
-						s.fieldIndexes = append(s.fieldIndexes, len(s.recordBuffer))
+						endField()
 						advance += len(line)
 						break parseField
 					default:
@@ -566,6 +957,7 @@ parseField:
 					newlineLen := lenNewline(line)
 					if newlineLen == 2 {
 						tokenHasCR = true
+						escaped = true
 						s.recordBuffer = append(s.recordBuffer, line[:len(line)-2]...)
 						s.recordBuffer = append(s.recordBuffer, '\n')
 					} else {
@@ -577,7 +969,7 @@ parseField:
 					}
 				} else {
 					// Abrupt end of file.
-					s.fieldIndexes = append(s.fieldIndexes, len(s.recordBuffer))
+					endField()
 					advance += len(line)
 					break parseField
 				}
@@ -585,33 +977,35 @@ parseField:
 		}
 	}
 
-	// Create a single string and create slices out of it.
-	// This pins the memory of the fields together, but allocates once.
-	strBuf := string(s.recordBuffer) // Convert to string once to batch allocations
-	fields := make([]string, len(s.fieldIndexes))
-	preIdx := 0
-	for i, idx := range s.fieldIndexes {
-		fields[i] = strBuf[preIdx:idx]
-		preIdx = idx
-	}
-
 	s.noBOMCheck = true
+	token = origData[skip : advance-bomLen]
+	advance += droppedCR
+	if tokenHasCR {
+		// Offsets won't match the token once \r is removed, so unescape
+		// (copy) the remaining fields.
+		for i := 0; i < len(record.offsets); i += 2 {
+			if start := record.offsets[i]; start >= 0 {
+				record.unescaped = append(record.unescaped, string(token[start:record.offsets[i+1]]))
+				record.offsets[i], record.offsets[i+1] = -len(record.unescaped), 0
+			}
+		}
+		token = bytes.ReplaceAll(token, []byte{'\r'}, nil)
+	}
 
 	if s.rowNum == 0 && s.header {
 		// Set header field names and advance, but don't return a line (token).
 		s.rowNum++
-		s.setFieldNames(fields)
+		names := s.headerNames // use explicit names instead of header row
+		if names == nil {
+			names = record.appendFields(nil, string(token))
+		}
+		s.setFieldNames(names)
 		return advance, nil, nil
 	}
 
-	// Normal row, set fields and return a line (token).
+	// Normal row, return a line (token) whose fields are in s.record.
 	s.rowNum++
-	*s.fields = fields
-	token = origData[skip:advance]
 	token = token[:len(token)-lenNewline(token)]
-	if tokenHasCR {
-		token = bytes.ReplaceAll(token, []byte{'\r'}, nil)
-	}
 	return advance, token, nil
 }
 
@@ -646,6 +1040,30 @@ func (p *interp) setLine(line string, isTrueStr bool) {
 	p.lineIsTrueStr = isTrueStr
 	p.haveFields = false
 	p.reparseCSV = true
+	p.lineStream = nil
+}
+
+// Set the current line to a record read from the main input. In CSV and
+// TSV modes, its fields have already been found by the csvSplitter.
+func (p *interp) setLineFromInput(line string) {
+	p.setLine(line, false)
+	p.lineRecord, p.scanRecord = p.scanRecord, p.lineRecord
+	p.reparseCSV = false
+}
+
+// Set the current line to a record read by getline from a stream with its
+// own input mode (if stream is not nil), so that it's split into fields
+// using that mode.
+func (p *interp) setLineFromStream(line string, stream *streamMode) {
+	p.setLine(line, false)
+	if stream != nil {
+		p.lineStream = stream
+		if stream.mode == CSVMode || stream.mode == TSVMode {
+			// Fields have already been found by the stream's csvSplitter
+			p.lineRecord, stream.record = stream.record, p.lineRecord
+			p.reparseCSV = false
+		}
+	}
 }
 
 // Ensure that the current line is parsed into fields, splitting it
@@ -656,41 +1074,56 @@ func (p *interp) ensureFields() {
 	}
 	p.haveFields = true
 
+	mode, csvConfig, recordSep := p.inputMode, p.csvInputConfig, p.recordSep
+	if p.lineStream != nil {
+		// Record was read by getline from a stream with its own mode
+		mode, csvConfig, recordSep = p.lineStream.mode, p.lineStream.csvConfig, p.lineStream.recordSep
+	}
+
 	switch {
-	case p.inputMode == CSVMode || p.inputMode == TSVMode:
+	case mode == CSVMode || mode == TSVMode:
+		line := p.line
 		if p.reparseCSV {
-			scanner := bufio.NewScanner(strings.NewReader(p.line))
-			scanner.Buffer(nil, maxRecordLength)
 			splitter := csvSplitter{
-				separator: p.csvInputConfig.Separator,
-				sepLen:    utf8.RuneLen(p.csvInputConfig.Separator),
-				comment:   p.csvInputConfig.Comment,
-				fields:    &p.fields,
-			}
-			scanner.Split(splitter.scan)
-			if !scanner.Scan() {
-				p.fields = nil
+				separator: csvConfig.Separator,
+				sepLen:    utf8.RuneLen(csvConfig.Separator),
+				comment:   csvConfig.Comment,
+				trimSpace: csvConfig.TrimLeadingSpace,
+				maxField:  p.maxField,
+				record:    &p.lineRecord,
 			}
+			// The splitter doesn't reset the record if the line is empty
+			// or a comment, so reset it here.
+			p.lineRecord.offsets = p.lineRecord.offsets[:0]
+			p.lineRecord.unescaped = p.lineRecord.unescaped[:0]
+			_, token, _ := splitter.scan([]byte(p.line), true)
+			line = string(token)
 		} else {
-			// Normally fields have already been parsed by csvSplitter
+			// Normally fields have already been found by csvSplitter
 		}
+		// Reuse the fields slice; fields are substrings of the line
+		p.fields = p.lineRecord.appendFields(p.fields[:0], line)
 	case p.fieldSep == " ":
 		// FS space (default) means split fields on any whitespace
-		p.fields = strings.Fields(p.line)
+		if p.maxField >= 0 {
+			p.fields = appendFieldsN(p.fields[:0], p.line, p.maxField)
+		} else {
+			p.fields = strings.Fields(p.line)
+		}
 	case p.line == "":
 		p.fields = nil
 	case utf8.RuneCountInString(p.fieldSep) <= 1:
 		// 1-char FS is handled as plain split (not regex)
-		p.fields = strings.Split(p.line, p.fieldSep)
+		p.fields = strings.SplitN(p.line, p.fieldSep, p.splitLimit())
 	default:
 		// Split on FS as a regex
-		p.fields = p.fieldSepRegex.Split(p.line, -1)
+		p.fields = p.fieldSepRegex.Split(p.line, p.splitLimit())
 	}
 
 	// Special case for when RS=="" and FS is single character,
 	// split on newline in addition to FS. See more here:
 	// https://www.gnu.org/software/gawk/manual/html_node/Multiple-Line.html
-	if p.inputMode == DefaultMode && p.recordSep == "" && utf8.RuneCountInString(p.fieldSep) == 1 {
+	if mode == DefaultMode && recordSep == "" && utf8.RuneCountInString(p.fieldSep) == 1 {
 		fields := make([]string, 0, len(p.fields))
 		for _, field := range p.fields {
 			lines := strings.Split(field, "\n")
@@ -702,6 +1135,11 @@ func (p *interp) ensureFields() {
 		p.fields = fields
 	}
 
+	if p.maxField >= 0 && len(p.fields) > p.maxField {
+		// Drop the unsplit rest of the line (program doesn't use it)
+		p.fields = p.fields[:p.maxField]
+	}
+
 	p.fieldsIsTrueStr = p.fieldsIsTrueStr[:0] // avoid allocation most of the time
 	for range p.fields {
 		p.fieldsIsTrueStr = append(p.fieldsIsTrueStr, false)
@@ -709,11 +1147,67 @@ func (p *interp) ensureFields() {
 	p.numFields = len(p.fields)
 }
 
+// Return the maximum number of substrings to split the line into, to
+// only split as many fields as the program uses (the last substring is the
+// unsplit rest of the line), or -1 to split all fields.
+func (p *interp) splitLimit() int {
+	if p.maxField < 0 {
+		return -1
+	}
+	return p.maxField + 1
+}
+
+// Append the first n whitespace-separated fields of s to dst, splitting
+// the same way as strings.Fields (but stopping early).
+func appendFieldsN(dst []string, s string, n int) []string {
+	if n == 0 {
+		return dst
+	}
+	start := -1 // start of current field, or -1 if in whitespace
+	for i := 0; i < len(s); {
+		r, size := rune(s[i]), 1
+		if r >= utf8.RuneSelf {
+			r, size = utf8.DecodeRuneInString(s[i:])
+		}
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				dst = append(dst, s[start:i])
+				start = -1
+				n--
+				if n == 0 {
+					return dst
+				}
+			}
+		} else if start < 0 {
+			start = i
+		}
+		i += size
+	}
+	if start >= 0 {
+		dst = append(dst, s[start:])
+	}
+	return dst
+}
+
 // Fetch next line (record) of input from current input file, opening
 // next input file if done with previous one
 func (p *interp) nextLine() (string, error) {
 	for {
 		if p.scanner == nil {
+			// Done with the current input file: replace it if it's being
+			// edited in place (before ENDFILE, so its output isn't included)
+			err := p.finishInPlace()
+			if err != nil {
+				return "", err
+			}
+			if p.inFile {
+				// Done with the current input file, run ENDFILE actions
+				p.inFile = false
+				_, err := p.executeFileActions(p.program.Compiled.EndFile)
+				if err != nil {
+					return "", err
+				}
+			}
 			if prevInput, ok := p.input.(io.Closer); ok && p.input != p.stdin {
 				// Previous input is file, close it
 				_ = prevInput.Close()
@@ -759,23 +1253,56 @@ func (p *interp) nextLine() (string, error) {
 					// ARGV arg is empty string, skip
 					p.input = nil
 					continue
-				} else if filename == "-" {
-					// ARGV arg is "-" meaning stdin
+				} else if isStandardInput(filename) {
+					// ARGV arg is "-" (or "/dev/stdin") meaning stdin
 					p.input = p.stdin
-					p.setFile("-")
+					p.setFile(filename)
 				} else {
 					// A regular file name, open it
 					if p.noFileReads {
 						return "", newError("can't read from file due to NoFileReads")
 					}
-					input, err := os.Open(filename)
+					input, err := p.openInputFile(filename)
 					if err != nil {
+						if len(p.program.Compiled.BeginFile) == 0 {
+							return "", err
+						}
+						// BEGINFILE can skip the file using nextfile,
+						// otherwise it's still an error
+						p.input = nil
+						p.setFile(filename)
+						p.errno = errnoString(err)
+						skip, actionsErr := p.executeFileActions(p.program.Compiled.BeginFile)
+						if actionsErr != nil {
+							return "", actionsErr
+						}
+						if skip {
+							continue
+						}
 						return "", err
 					}
 					p.input = input
 					p.setFile(filename)
+					if p.inPlaceEdit {
+						err := p.startInPlace(filename)
+						if err != nil {
+							return "", err
+						}
+					}
 				}
 			}
+			p.errno = ""
+			skip, err := p.executeFileActions(p.program.Compiled.BeginFile)
+			if err != nil {
+				return "", err
+			}
+			if skip {
+				// BEGINFILE used nextfile: skip the file (leaving it
+				// unchanged if editing in place), and its ENDFILE
+				p.abortInPlace()
+				continue
+			}
+			p.inFile = true
 			if p.inputBuffer == nil { // reuse buffer from last input file
 				p.inputBuffer = make([]byte, inputBufSize)
 			}
@@ -800,6 +1327,32 @@ func (p *interp) nextLine() (string, error) {
 	return p.scanner.Text(), nil
 }
 
+// Execute BEGINFILE or ENDFILE actions, and report whether they used
+// nextfile to skip the current file.
+func (p *interp) executeFileActions(code []compiler.Opcode) (bool, error) {
+	if len(code) == 0 {
+		return false, nil
+	}
+	err := p.execute(code)
+	switch err {
+	case errNextfile:
+		return true, nil
+	case errNext:
+		return false, newError("next can't be used in BEGINFILE or ENDFILE")
+	}
+	return false, err
+}
+
+// Return the message to set ERRNO to for the given I/O error. For errors
+// that include the filename, only the reason is used, for example "no
+// such file or directory".
+func errnoString(err error) string {
+	if pathErr, ok := err.(*os.PathError); ok {
+		return pathErr.Err.Error()
+	}
+	return err.Error()
+}
+
 // Write output string to given writer, producing correct line endings
 // on Windows (CR LF).
 func writeOutput(w io.Writer, s string) error {
@@ -816,6 +1369,7 @@ func writeOutput(w io.Writer, s string) error {
 
 // Close all streams, commands, and so on (after program execution).
 func (p *interp) closeAll() {
+	p.abortInPlace() // only still editing if there was an error
 	if prevInput, ok := p.input.(io.Closer); ok {
 		_ = prevInput.Close()
 	}
@@ -825,8 +1379,11 @@ func (p *interp) closeAll() {
 	for _, w := range p.outputStreams {
 		_ = w.Close()
 	}
-	for _, cmd := range p.commands {
-		_ = cmd.Wait()
+	for _, process := range p.commands {
+		_, _ = process.Wait()
+	}
+	for name, c := range p.coprocesses {
+		_, _ = p.closeCoprocess(name, c, "")
 	}
 	if f, ok := p.output.(flusher); ok {
 		_ = f.Flush()
@@ -836,6 +1393,41 @@ func (p *interp) closeAll() {
 	}
 }
 
+// Close the named input or output stream or coprocess, and return the
+// result for close(): 0 on success, -1 on error (setting ERRNO) or if
+// there's nothing to close. For a coprocess, how specifies which end to
+// close ("to" or "from"), or both if it's "". Closing a pipe or coprocess
+// waits for the command to exit and returns its exit status.
+func (p *interp) closeStream(name, how string) float64 {
+	var err error
+	status := 0
+	if c, ok := p.coprocesses[name]; ok {
+		status, err = p.closeCoprocess(name, c, how)
+	} else if r, ok := p.inputStreams[name]; ok {
+		delete(p.inputStreams, name)
+		delete(p.streamModes, name)
+		err = r.Close()
+		status = p.waitCommand(name)
+	} else if w, ok := p.outputStreams[name]; ok {
+		delete(p.outputStreams, name)
+		err = w.Close()
+		status = p.waitCommand(name)
+	} else if w := p.standardOutput(name); w != nil {
+		// Output and Error aren't closed, only flushed
+		if flusher, ok := w.(flusher); ok {
+			err = flusher.Flush()
+		}
+	} else {
+		p.errno = "close of redirection that was never opened"
+		return -1
+	}
+	if err != nil {
+		p.errno = err.Error()
+		return -1
+	}
+	return float64(status)
+}
+
 // Flush all output streams as well as standard output. Report whether all
 // streams were flushed successfully (logging error(s) if not).
 func (p *interp) flushAll() bool {
@@ -843,6 +1435,11 @@ func (p *interp) flushAll() bool {
 	for name, writer := range p.outputStreams {
 		allGood = allGood && p.flushWriter(name, writer)
 	}
+	for name, c := range p.coprocesses {
+		if c.writer != nil {
+			allGood = allGood && p.flushWriter(name, c.writer)
+		}
+	}
 	if _, ok := p.output.(flusher); ok {
 		// User-provided output may or may not be flushable
 		allGood = allGood && p.flushWriter("stdout", p.output)
@@ -853,6 +1450,12 @@ func (p *interp) flushAll() bool {
 // Flush a single, named output stream, and report whether it was flushed
 // successfully (logging an error if not).
 func (p *interp) flushStream(name string) bool {
+	if c, ok := p.coprocesses[name]; ok && c.writer != nil {
+		return p.flushWriter(name, c.writer)
+	}
+	if writer := p.standardOutput(name); writer != nil {
+		return p.flushWriter(name, writer)
+	}
 	writer := p.outputStreams[name]
 	if writer == nil {
 		p.printErrorf("error flushing %q: not an output file or pipe\n", name)
@@ -875,6 +1478,7 @@ func (p *interp) flushWriter(name string, writer io.Writer) bool {
 	err := flusher.Flush()
 	if err != nil {
 		p.printErrorf("error flushing %q: %v\n", name, err)
+		p.errno = err.Error()
 		return false
 	}
 	return true
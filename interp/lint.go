@@ -0,0 +1,160 @@
+// Runtime lint checks (Config.Lint) and source positions of runtime errors
+
+package interp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/benhoyt/goawk/internal/compiler"
+	"github.com/benhoyt/goawk/internal/resolver"
+	"github.com/benhoyt/goawk/lexer"
+)
+
+// Return the source position of the instruction at ip in code, formatted as
+// "path:line:column" (or "line:column" if there's no Config.SourceLine).
+func (p *interp) position(code []compiler.Opcode, ip int) string {
+	pos, _ := p.program.Compiled.Position(code, ip)
+	return p.formatPosition(pos)
+}
+
+func (p *interp) formatPosition(pos lexer.Position) string {
+	if pos.Line == 0 {
+		return "<unknown position>"
+	}
+	if p.sourceLine != nil {
+		path, line := p.sourceLine(pos.Line)
+		return fmt.Sprintf("%s:%d:%d", path, line, pos.Column)
+	}
+	return fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+}
+
+// Attach the source position of the instruction at ip in code to a runtime
+// error, unless it already has one (errors from nested function calls and
+// loop bodies are positioned where they occur). Errors that aren't an
+// *Error, such as those returned by native functions, are wrapped in one.
+// Control flow errors (like errNext) and context errors are returned as is.
+func (p *interp) errorAt(err error, code []compiler.Opcode, ip int) error {
+	switch err {
+	case errExit, errBreak, errNext, errNextfile, context.Canceled, context.DeadlineExceeded:
+		return err
+	}
+	if _, ok := err.(returnValue); ok {
+		return err
+	}
+	e, ok := err.(*Error)
+	if !ok {
+		e = &Error{message: err.Error(), err: err}
+	}
+	if e.Position.Line == 0 {
+		e.Position, _ = p.program.Compiled.Position(code, ip)
+	}
+	return e
+}
+
+// Add a call to the named function (at ip in code) to the call stack of an
+// error that occurred while executing it.
+func (p *interp) callError(err error, funcName string, code []compiler.Opcode, ip int) error {
+	if e, ok := err.(*Error); ok {
+		pos, _ := p.program.Compiled.Position(code, ip)
+		e.Stack = append(e.Stack, Frame{Function: funcName, Position: pos})
+		return e
+	}
+	return p.errorAt(err, code, ip)
+}
+
+// Identifies a lint warning that has been written: the kind of warning
+// (its format) for a single instruction.
+type lintKey struct {
+	code   *compiler.Opcode // first opcode of the instruction's code block
+	ip     int
+	format string
+}
+
+// Write a lint warning for the instruction at ip in code, unless the same
+// kind of warning has already been written for that instruction. Source
+// positions are per statement, so they can't tell apart two uses in one
+// statement (as in print x, y). Keying on the format rather than the
+// message means a warning whose arguments vary per record, like a compared
+// value, is only written once.
+func (p *interp) lintWarnf(code []compiler.Opcode, ip int, format string, args ...interface{}) {
+	key := lintKey{&code[0], ip, format}
+	if p.lintWarned[key] {
+		return
+	}
+	p.lintWarned[key] = true
+	fmt.Fprintf(p.errorOutput, "%s: warning: %s\n", p.position(code, ip), fmt.Sprintf(format, args...))
+}
+
+// Warn about a read of an uninitialized scalar variable.
+func (p *interp) lintUninitialized(code []compiler.Opcode, ip int, scope resolver.Scope, index int) {
+	var name string
+	if scope == resolver.Global {
+		name = p.globalName(index)
+	} else {
+		_, f := p.program.Compiled.Position(code, ip)
+		if f != nil {
+			name = localName(f, index)
+		}
+	}
+	p.lintWarnf(code, ip, "reference to uninitialized variable %s", name)
+}
+
+// Return the name of the global scalar with the given index.
+func (p *interp) globalName(index int) string {
+	for name, i := range p.scalarIndexes {
+		if i == index {
+			return name
+		}
+	}
+	return ""
+}
+
+// Return the name of the local scalar with the given index in function f.
+func localName(f *compiler.Function, index int) string {
+	n := 0
+	for i, param := range f.Params {
+		if f.Arrays[i] {
+			continue
+		}
+		if n == index {
+			return param
+		}
+		n++
+	}
+	return ""
+}
+
+// Warn about a reference to a field past NF.
+func (p *interp) lintField(code []compiler.Opcode, ip int, index int) {
+	p.ensureFields()
+	if index > p.numFields {
+		p.lintWarnf(code, ip, "reference to field $%d past NF", index)
+	}
+}
+
+// Warn about a comparison that's done as a string comparison only because
+// one side is a string and the other is a number. Comparisons with
+// uninitialized values (such as x == "") are common and not reported.
+func (p *interp) lintCompare(code []compiler.Opcode, ip int, l value, lIsStr bool, r value, rIsStr bool) {
+	if lIsStr == rIsStr {
+		return
+	}
+	s, n := l, r
+	if rIsStr {
+		s, n = r, l
+	}
+	if n.typ == typeNull {
+		return
+	}
+	p.lintWarnf(code, ip, "comparison of string %q with number %s is done as a string comparison",
+		p.toString(s), p.toString(n))
+}
+
+// Warn if there are too many files and pipes open at once (usually
+// because the program is missing calls to close).
+func (p *interp) lintOpenStreams(code []compiler.Opcode, ip int) {
+	if len(p.inputStreams)+len(p.outputStreams)+len(p.coprocesses) > p.lintMaxFiles {
+		p.lintWarnf(code, ip, "more than %d files and pipes open at once (missing close?)", p.lintMaxFiles)
+	}
+}
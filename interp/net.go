@@ -0,0 +1,166 @@
+// Network I/O using Gawk-style "/inet/tcp/lport/rhost/rport" special files
+
+package interp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+)
+
+// Report whether name is a network special file, for example
+// "/inet/tcp/0/localhost/8080".
+func isNetworkName(name string) bool {
+	return strings.HasPrefix(name, "/inet/") ||
+		strings.HasPrefix(name, "/inet4/") ||
+		strings.HasPrefix(name, "/inet6/")
+}
+
+// Open the connection for a network special file. The name has the form
+// /inet/protocol/lport/rhost/rport, where protocol is "tcp" or "udp" (and
+// "/inet4" or "/inet6" force IPv4 or IPv6). If rhost and rport are given,
+// connect to that address (from local port lport, if it's not 0).
+// Otherwise listen on lport and use the first connection (TCP), or reply
+// to whoever sent the last packet (UDP).
+func (p *interp) openNetwork(name string) (Process, error) {
+	parts := strings.Split(name, "/")
+	if len(parts) != 6 || (parts[2] != "tcp" && parts[2] != "udp") {
+		return nil, newError("invalid network special file %q", name)
+	}
+	network := parts[2] + strings.TrimPrefix(parts[1], "inet")
+	lport, rhost, rport := parts[3], parts[4], parts[5]
+
+	ctx := context.Background()
+	if p.checkCtx {
+		ctx = p.ctx
+	}
+	switch {
+	case rhost != "" && rhost != "0" && rport != "" && rport != "0":
+		var dialer net.Dialer
+		if lport != "" && lport != "0" {
+			addr := net.JoinHostPort("", lport)
+			var err error
+			if parts[2] == "tcp" {
+				dialer.LocalAddr, err = net.ResolveTCPAddr(network, addr)
+			} else {
+				dialer.LocalAddr, err = net.ResolveUDPAddr(network, addr)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(rhost, rport))
+		if err != nil {
+			return nil, err
+		}
+		return &netProcess{conn: conn}, nil
+
+	case lport != "" && lport != "0":
+		addr := net.JoinHostPort("", lport)
+		if parts[2] == "udp" {
+			conn, err := net.ListenPacket(network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return &netProcess{conn: &udpServerConn{PacketConn: conn}}, nil
+		}
+		listener, err := net.Listen(network, addr)
+		if err != nil {
+			return nil, err
+		}
+		defer listener.Close()
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			// Stop waiting for a connection if the context is cancelled.
+			select {
+			case <-ctx.Done():
+				listener.Close()
+			case <-done:
+			}
+		}()
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+		return &netProcess{conn: conn}, nil
+
+	default:
+		return nil, newError("network special file %q needs a local port or a remote host and port", name)
+	}
+}
+
+// netProcess is a network connection used like a coprocess, so that
+// output (print >) and input (getline <) share the connection, and
+// close(name, "to") shuts down just the writing side.
+type netProcess struct {
+	conn io.ReadWriteCloser
+}
+
+func (p *netProcess) Stdin() io.WriteCloser { return netWriter{p.conn} }
+func (p *netProcess) Stdout() io.ReadCloser { return netReader{p.conn} }
+
+func (p *netProcess) Wait() (int, error) {
+	err := p.conn.Close()
+	if err != nil {
+		return -1, err
+	}
+	return 0, nil
+}
+
+type netWriter struct {
+	conn io.ReadWriteCloser
+}
+
+func (w netWriter) Write(p []byte) (int, error) {
+	return w.conn.Write(p)
+}
+
+func (w netWriter) Close() error {
+	if c, ok := w.conn.(interface{ CloseWrite() error }); ok {
+		return c.CloseWrite()
+	}
+	return nil
+}
+
+type netReader struct {
+	conn io.ReadWriteCloser
+}
+
+func (r netReader) Read(p []byte) (int, error) {
+	return r.conn.Read(p)
+}
+
+func (r netReader) Close() error {
+	if c, ok := r.conn.(interface{ CloseRead() error }); ok {
+		return c.CloseRead()
+	}
+	return nil
+}
+
+// udpServerConn is a listening UDP socket that sends its output to the
+// address the most recent packet was received from.
+type udpServerConn struct {
+	net.PacketConn
+	addr net.Addr
+}
+
+func (c *udpServerConn) Read(p []byte) (int, error) {
+	n, addr, err := c.ReadFrom(p)
+	if addr != nil {
+		c.addr = addr
+	}
+	return n, err
+}
+
+func (c *udpServerConn) Write(p []byte) (int, error) {
+	if c.addr == nil {
+		return 0, errors.New("can't write to UDP socket before receiving a packet")
+	}
+	return c.WriteTo(p, c.addr)
+}
@@ -5,6 +5,7 @@ package interp
 import (
 	"context"
 	"math"
+	"math/big"
 
 	"github.com/benhoyt/goawk/internal/resolver"
 	"github.com/benhoyt/goawk/parser"
@@ -99,6 +100,15 @@ func (p *interp) resetCore() {
 	for k := range p.commands {
 		delete(p.commands, k)
 	}
+	for k := range p.coprocesses {
+		delete(p.coprocesses, k)
+	}
+	for k := range p.streamModes {
+		delete(p.streamModes, k)
+	}
+
+	p.rowHeaderDone = false
+	p.outHeaderDone = false
 
 	p.sp = 0
 	p.localArrays = p.localArrays[:0]
@@ -132,17 +142,23 @@ func (p *interp) resetVars() {
 
 	// Reset special variables
 	p.convertFormat = "%.6g"
+	p.updateConvertedStrs()
 	p.outputFormat = "%.6g"
 	p.fieldSep = " "
 	p.fieldSepRegex = nil
 	p.recordSep = "\n"
 	p.recordSepRegex = nil
 	p.recordTerminator = ""
+	p.errno = ""
 	p.outputFieldSep = " "
 	p.outputRecordSep = "\n"
 	p.subscriptSep = "\x1c"
 	p.matchLength = 0
 	p.matchStart = 0
+	p.prec = defaultPrec
+	p.roundMode = big.ToNearestEven
+	p.precVar = null()
+	p.roundModeVar = null()
 }
 
 // ResetVars resets this interpreter's variables, setting scalar variables to
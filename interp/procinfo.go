@@ -0,0 +1,59 @@
+// The PROCINFO special array
+
+package interp
+
+import (
+	"os"
+	"runtime"
+
+	"github.com/benhoyt/goawk/internal/resolver"
+)
+
+// Version is the GoAWK version, available to AWK programs as
+// PROCINFO["version"].
+const Version = "v1.23.1"
+
+// Set up the informational elements of PROCINFO. These can be assigned to
+// by the AWK program, but that doesn't change how the interpreter behaves.
+func (p *interp) initProcinfo() {
+	p.setProcinfo("version", str(Version))
+	p.setProcinfo("platform", str(runtime.GOOS))
+	p.setProcinfo("pid", num(float64(os.Getpid())))
+	p.setProcinfo("ppid", num(float64(os.Getppid())))
+	p.setProcinfo("uid", num(float64(os.Getuid())))
+	p.setProcinfo("euid", num(float64(os.Geteuid())))
+	p.setProcinfo("gid", num(float64(os.Getgid())))
+	p.setProcinfo("egid", num(float64(os.Getegid())))
+	p.updateProcinfoModes()
+}
+
+// Update the PROCINFO elements that describe the input and output modes,
+// called when they change.
+func (p *interp) updateProcinfoModes() {
+	fieldSplitting := "FS"
+	switch p.inputMode {
+	case CSVMode:
+		fieldSplitting = "CSV"
+	case TSVMode:
+		fieldSplitting = "TSV"
+	}
+	p.setProcinfo("FS", str(fieldSplitting))
+	p.setProcinfo("INPUTMODE", str(inputModeString(p.inputMode, p.csvInputConfig)))
+	p.setProcinfo("OUTPUTMODE", str(outputModeString(p.outputMode, p.csvOutputConfig)))
+}
+
+func (p *interp) setProcinfo(key string, v value) {
+	if index, ok := p.arrayIndexes["PROCINFO"]; ok {
+		p.setArrayValue(resolver.Global, index, key, v)
+	}
+}
+
+// Return the PROCINFO array, or nil if the program uses PROCINFO as a
+// scalar variable.
+func (p *interp) procinfo() map[string]value {
+	index, ok := p.arrayIndexes["PROCINFO"]
+	if !ok {
+		return nil
+	}
+	return p.array(resolver.Global, index)
+}
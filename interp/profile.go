@@ -0,0 +1,198 @@
+// Execution profiling of AWK programs (Config.Profiling)
+
+package interp
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/benhoyt/goawk/internal/compiler"
+	"github.com/benhoyt/goawk/lexer"
+)
+
+// How often the profiler samples the currently-executing instruction.
+const profileSampleInterval = time.Millisecond
+
+// Profile is the execution profile of an AWK program, collected when
+// Config.Profiling is set. Counts are exact; times are estimated by
+// sampling the instruction being executed every millisecond, so they're
+// only meaningful for programs that run for a while.
+type Profile struct {
+	Lines     []LineProfile     // source lines that were executed, in order
+	Functions []FunctionProfile // user-defined functions, in order of definition
+
+	RegexCache  CacheStats // cache of dynamic regexes (Config.RegexCacheSize)
+	FormatCache CacheStats // cache of printf formats (Config.FormatCacheSize)
+}
+
+// CacheStats holds the number of hits and misses for one of the
+// interpreter's caches.
+type CacheStats struct {
+	Hits   int64
+	Misses int64
+}
+
+// LineProfile holds the execution profile of a single source line.
+type LineProfile struct {
+	Line         int           // line number in the program source
+	Count        int64         // number of times the line was executed
+	Instructions int64         // number of VM instructions executed
+	Time         time.Duration // estimated time spent executing the line
+}
+
+// FunctionProfile holds the execution profile of a user-defined function.
+type FunctionProfile struct {
+	Name         string
+	Position     lexer.Position // source position of the function name
+	Calls        int64          // number of times the function was called
+	Instructions int64          // number of VM instructions executed in it
+	Time         time.Duration  // estimated time spent in the function body
+}
+
+// Instruction counts and samples for a block of code (indexed by address).
+type profileCounter struct {
+	count   int64
+	samples int64
+}
+
+// Profile returns the execution profile of the most recent call to Execute,
+// or nil if Config.Profiling wasn't set.
+func (p *Interpreter) Profile() *Profile {
+	return p.interp.profile()
+}
+
+// Reset profiling state at the start of an execution.
+func (p *interp) resetProfile() {
+	p.profileBlocks = p.profileBlocks[:0]
+	p.profileCode = make(map[*compiler.Opcode][]profileCounter)
+	p.profileCalls = make([]int64, len(p.functions))
+	p.regexCache.hits, p.regexCache.misses = 0, 0
+	p.formatCache.hits, p.formatCache.misses = 0, 0
+	atomic.StoreInt32(&p.profileTick, 0)
+}
+
+// Start the goroutine that periodically tells the VM to take a sample,
+// and return a function that stops it.
+func (p *interp) startProfileSampler() (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(profileSampleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				atomic.StoreInt32(&p.profileTick, 1)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// Return the profile counters for the given code (which may be a sub-slice
+// of a block, for example the body of a for-in loop). Counters are cached
+// by the address of the code's first instruction, so the search for the
+// enclosing block only happens the first time code is executed.
+func (p *interp) profileCounters(code []compiler.Opcode) []profileCounter {
+	if len(code) == 0 {
+		return nil
+	}
+	counters, ok := p.profileCode[&code[0]]
+	if !ok {
+		index, block, offset := p.program.Compiled.Block(code)
+		if index >= 0 {
+			for len(p.profileBlocks) <= index {
+				p.profileBlocks = append(p.profileBlocks, nil)
+			}
+			if p.profileBlocks[index] == nil {
+				p.profileBlocks[index] = make([]profileCounter, len(block))
+			}
+			counters = p.profileBlocks[index][offset:]
+		}
+		p.profileCode[&code[0]] = counters
+	}
+	if counters == nil {
+		return nil
+	}
+	return counters[:len(code)]
+}
+
+// Count execution of the instruction at ip, and record a sample for it if
+// the sampler has ticked.
+func (p *interp) profileInstruction(counters []profileCounter, ip int) {
+	counters[ip].count++
+	if atomic.LoadInt32(&p.profileTick) != 0 {
+		atomic.StoreInt32(&p.profileTick, 0)
+		counters[ip].samples++
+	}
+}
+
+func (p *interp) profile() *Profile {
+	if !p.profiling {
+		return nil
+	}
+	lines := make(map[int]*LineProfile)
+	functions := make([]FunctionProfile, len(p.functions))
+	for i, f := range p.program.ResolvedProgram.Functions {
+		functions[i].Name = f.Name
+		functions[i].Position = f.Pos
+		functions[i].Calls = p.profileCalls[i]
+	}
+	p.program.Compiled.IterPositions(func(index int, f *compiler.Function, start, end int, pos lexer.Position) {
+		if index >= len(p.profileBlocks) || p.profileBlocks[index] == nil {
+			return // block never executed
+		}
+		counters := p.profileBlocks[index][start:end]
+		var instructions, samples int64
+		for _, c := range counters {
+			instructions += c.count
+			samples += c.samples
+		}
+		elapsed := time.Duration(samples) * profileSampleInterval
+		if f != nil {
+			fp := &functions[p.functionIndex(f)]
+			fp.Instructions += instructions
+			fp.Time += elapsed
+		}
+		if pos.Line == 0 || instructions == 0 {
+			return // no source position (for example, coverage code)
+		}
+		line := lines[pos.Line]
+		if line == nil {
+			line = &LineProfile{Line: pos.Line}
+			lines[pos.Line] = line
+		}
+		// The first instruction of each statement is executed once each
+		// time the statement is, so use the maximum for the line's count.
+		if counters[0].count > line.Count {
+			line.Count = counters[0].count
+		}
+		line.Instructions += instructions
+		line.Time += elapsed
+	})
+
+	profile := &Profile{
+		Functions:   functions,
+		RegexCache:  p.regexCache.stats(),
+		FormatCache: p.formatCache.stats(),
+	}
+	for _, line := range lines {
+		profile.Lines = append(profile.Lines, *line)
+	}
+	sort.Slice(profile.Lines, func(i, j int) bool {
+		return profile.Lines[i].Line < profile.Lines[j].Line
+	})
+	return profile
+}
+
+// Return the index of compiled function f in p.functions.
+func (p *interp) functionIndex(f *compiler.Function) int {
+	for i := range p.functions {
+		if &p.functions[i] == f {
+			return i
+		}
+	}
+	return -1
+}
@@ -18,10 +18,11 @@ const (
 	typeNumStr
 )
 
-// An AWK value (these are passed around by value)
+// An AWK value (these are passed around by value). Don't add fields: the Go
+// compiler keeps structs of up to four words in registers.
 type value struct {
 	typ valueType // Type of value
-	s   string    // String value (for typeStr and typeNumStr)
+	s   string    // String value (for typeStr and typeNumStr), or bignum (see bigNum)
 	n   float64   // Numeric value (for typeNum)
 }
 
@@ -99,7 +100,7 @@ func (v value) boolean() bool {
 		}
 		return f != 0
 	default: // typeNum, typeNull
-		return v.n != 0
+		return v.n != 0 || v.s != "" // v.s is a non-zero bignum (see bigNum)
 	}
 }
 
@@ -132,6 +133,9 @@ func parseFloat(s string) (float64, error) {
 // use floatFormat.
 func (v value) str(floatFormat string) string {
 	if v.typ == typeNum {
+		if v.s != "" {
+			return bigStr(v.s, floatFormat)
+		}
 		switch {
 		case math.IsNaN(v.n):
 			return "nan"
@@ -198,6 +202,19 @@ func parseFloatPrefix(s string) float64 {
 	if i+2 < len(s) && hasHexPrefix(s[i:]) {
 		return parseHexFloatPrefix(s, start, i+2)
 	}
+	end := decimalPrefixEnd(s, i)
+	if end < 0 {
+		return 0
+	}
+
+	floatStr := s[start:end]
+	f, _ := strconv.ParseFloat(floatStr, 64)
+	return f // Returns infinity in case of "value out of range" error
+}
+
+// Return the end of the decimal number (mantissa and optional exponent)
+// starting at s[i], or -1 if there are no mantissa digits.
+func decimalPrefixEnd(s string, i int) int {
 	gotDigit := false
 	for i < len(s) && isDigit(s[i]) {
 		gotDigit = true
@@ -211,7 +228,7 @@ func parseFloatPrefix(s string) float64 {
 		i++
 	}
 	if !gotDigit {
-		return 0
+		return -1
 	}
 
 	// Parse exponent ("1e" and similar are allowed, but ParseFloat
@@ -227,10 +244,7 @@ func parseFloatPrefix(s string) float64 {
 			end = i
 		}
 	}
-
-	floatStr := s[start:end]
-	f, _ := strconv.ParseFloat(floatStr, 64)
-	return f // Returns infinity in case of "value out of range" error
+	return end
 }
 
 func hasHexPrefix(s string) bool {
@@ -6,7 +6,6 @@ import (
 	"io"
 	"math"
 	"os"
-	"os/exec"
 	"strings"
 	"time"
 
@@ -28,14 +27,27 @@ import (
 // a single CallBuiltin -- that probably pushed it below a switch binary tree
 // branch threshold).
 func (p *interp) execute(code []compiler.Opcode) error {
+	// Context checks and profiling share a single per-instruction branch,
+	// so profiling doesn't slow down the loop when it's turned off.
+	var counters []profileCounter
+	if p.profiling {
+		counters = p.profileCounters(code)
+	}
+	slowPath := p.checkCtx || counters != nil
+
 	for ip := 0; ip < len(code); {
 		op := code[ip]
 		ip++
 
-		if p.checkCtx {
-			err := p.checkContext()
-			if err != nil {
-				return err
+		if slowPath {
+			if counters != nil {
+				p.profileInstruction(counters, ip-1)
+			}
+			if p.checkCtx {
+				err := p.checkContext()
+				if err != nil {
+					return err
+				}
 			}
 		}
 
@@ -43,7 +55,11 @@ func (p *interp) execute(code []compiler.Opcode) error {
 		case compiler.Num:
 			index := code[ip]
 			ip++
-			p.push(num(p.nums[index]))
+			if p.bignum {
+				p.push(p.bigNums[index])
+			} else {
+				p.push(num(p.nums[index]))
+			}
 
 		case compiler.Str:
 			index := code[ip]
@@ -63,12 +79,18 @@ func (p *interp) execute(code []compiler.Opcode) error {
 
 		case compiler.Field:
 			index := p.peekTop()
+			if p.lint {
+				p.lintField(code, ip-1, int(index.num()))
+			}
 			v := p.getField(int(index.num()))
 			p.replaceTop(v)
 
 		case compiler.FieldInt:
 			index := code[ip]
 			ip++
+			if p.lint {
+				p.lintField(code, ip-1, int(index))
+			}
 			v := p.getField(int(index))
 			p.push(v)
 
@@ -76,7 +98,7 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			fieldName := p.peekTop()
 			field, err := p.getFieldByName(p.toString(fieldName))
 			if err != nil {
-				return err
+				return p.errorAt(err, code, ip-1)
 			}
 			p.replaceTop(field)
 
@@ -86,18 +108,24 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			ip++
 			field, err := p.getFieldByName(fieldName)
 			if err != nil {
-				return err
+				return p.errorAt(err, code, ip-1)
 			}
 			p.push(field)
 
 		case compiler.Global:
 			index := code[ip]
 			ip++
+			if p.lint && p.globals[index].typ == typeNull {
+				p.lintUninitialized(code, ip-1, resolver.Global, int(index))
+			}
 			p.push(p.globals[index])
 
 		case compiler.Local:
 			index := code[ip]
 			ip++
+			if p.lint && p.frame[index].typ == typeNull {
+				p.lintUninitialized(code, ip-1, resolver.Local, int(index))
+			}
 			p.push(p.frame[index])
 
 		case compiler.Special:
@@ -141,7 +169,18 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			right, index := p.popTwo()
 			err := p.setField(int(index.num()), p.toString(right))
 			if err != nil {
-				return err
+				return p.errorAt(err, code, ip-1)
+			}
+
+		case compiler.AssignFieldByName:
+			right, name := p.popTwo()
+			index, err := p.assignFieldIndex(p.toString(name))
+			if err != nil {
+				return p.errorAt(err, code, ip-1)
+			}
+			err = p.setField(index, p.toString(right))
+			if err != nil {
+				return p.errorAt(err, code, ip-1)
 			}
 
 		case compiler.AssignGlobal:
@@ -159,7 +198,7 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			ip++
 			err := p.setSpecial(int(index), p.pop())
 			if err != nil {
-				return err
+				return p.errorAt(err, code, ip-1)
 			}
 
 		case compiler.AssignArrayGlobal:
@@ -198,31 +237,44 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			ip++
 			index := int(p.pop().num())
 			v := p.getField(index)
-			err := p.setField(index, p.toString(num(v.num()+float64(amount))))
+			err := p.setField(index, p.toString(p.incr(v, float64(amount))))
+			if err != nil {
+				return p.errorAt(err, code, ip-1)
+			}
+
+		case compiler.IncrFieldByName:
+			amount := code[ip]
+			ip++
+			index, err := p.assignFieldIndex(p.toString(p.pop()))
+			if err != nil {
+				return p.errorAt(err, code, ip-1)
+			}
+			v := p.getField(index)
+			err = p.setField(index, p.toString(p.incr(v, float64(amount))))
 			if err != nil {
-				return err
+				return p.errorAt(err, code, ip-1)
 			}
 
 		case compiler.IncrGlobal:
 			amount := code[ip]
 			index := code[ip+1]
 			ip += 2
-			p.globals[index] = num(p.globals[index].num() + float64(amount))
+			p.globals[index] = p.incr(p.globals[index], float64(amount))
 
 		case compiler.IncrLocal:
 			amount := code[ip]
 			index := code[ip+1]
 			ip += 2
-			p.frame[index] = num(p.frame[index].num() + float64(amount))
+			p.frame[index] = p.incr(p.frame[index], float64(amount))
 
 		case compiler.IncrSpecial:
 			amount := code[ip]
 			index := int(code[ip+1])
 			ip += 2
 			v := p.getSpecial(index)
-			err := p.setSpecial(index, num(v.num()+float64(amount)))
+			err := p.setSpecial(index, p.incr(v, float64(amount)))
 			if err != nil {
-				return err
+				return p.errorAt(err, code, ip-1)
 			}
 
 		case compiler.IncrArrayGlobal:
@@ -231,7 +283,7 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			ip += 2
 			array := p.arrays[arrayIndex]
 			index := p.toString(p.pop())
-			array[index] = num(array[index].num() + float64(amount))
+			array[index] = p.incr(array[index], float64(amount))
 
 		case compiler.IncrArrayLocal:
 			amount := code[ip]
@@ -239,7 +291,7 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			ip += 2
 			array := p.localArray(int(arrayIndex))
 			index := p.toString(p.pop())
-			array[index] = num(array[index].num() + float64(amount))
+			array[index] = p.incr(array[index], float64(amount))
 
 		case compiler.AugAssignField:
 			operation := compiler.AugOp(code[ip])
@@ -249,11 +301,29 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			field := p.getField(index)
 			v, err := p.augAssignOp(operation, field, right)
 			if err != nil {
-				return err
+				return p.errorAt(err, code, ip-1)
+			}
+			err = p.setField(index, p.toString(v))
+			if err != nil {
+				return p.errorAt(err, code, ip-1)
+			}
+
+		case compiler.AugAssignFieldByName:
+			operation := compiler.AugOp(code[ip])
+			ip++
+			right, name := p.popTwo()
+			index, err := p.assignFieldIndex(p.toString(name))
+			if err != nil {
+				return p.errorAt(err, code, ip-1)
+			}
+			field := p.getField(index)
+			v, err := p.augAssignOp(operation, field, right)
+			if err != nil {
+				return p.errorAt(err, code, ip-1)
 			}
 			err = p.setField(index, p.toString(v))
 			if err != nil {
-				return err
+				return p.errorAt(err, code, ip-1)
 			}
 
 		case compiler.AugAssignGlobal:
@@ -262,7 +332,7 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			ip += 2
 			v, err := p.augAssignOp(operation, p.globals[index], p.pop())
 			if err != nil {
-				return err
+				return p.errorAt(err, code, ip-1)
 			}
 			p.globals[index] = v
 
@@ -272,7 +342,7 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			ip += 2
 			v, err := p.augAssignOp(operation, p.frame[index], p.pop())
 			if err != nil {
-				return err
+				return p.errorAt(err, code, ip-1)
 			}
 			p.frame[index] = v
 
@@ -282,11 +352,11 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			ip += 2
 			v, err := p.augAssignOp(operation, p.getSpecial(index), p.pop())
 			if err != nil {
-				return err
+				return p.errorAt(err, code, ip-1)
 			}
 			err = p.setSpecial(index, v)
 			if err != nil {
-				return err
+				return p.errorAt(err, code, ip-1)
 			}
 
 		case compiler.AugAssignArrayGlobal:
@@ -297,7 +367,7 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			index := p.toString(p.pop())
 			v, err := p.augAssignOp(operation, array[index], p.pop())
 			if err != nil {
-				return err
+				return p.errorAt(err, code, ip-1)
 			}
 			array[index] = v
 
@@ -310,7 +380,7 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			index := p.toString(indexVal)
 			v, err := p.augAssignOp(operation, array[index], right)
 			if err != nil {
-				return err
+				return p.errorAt(err, code, ip-1)
 			}
 			array[index] = v
 
@@ -321,6 +391,12 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			re := p.regexes[index]
 			p.push(boolean(re.MatchString(p.line)))
 
+		case compiler.RegexLiteral:
+			// Same as Regex, but for a simple regex like /foo/
+			index := code[ip]
+			ip++
+			p.push(boolean(p.literals[index].MatchString(p.line)))
+
 		case compiler.IndexMulti:
 			numValues := int(code[ip])
 			ip++
@@ -333,33 +409,72 @@ func (p *interp) execute(code []compiler.Opcode) error {
 
 		case compiler.Add:
 			l, r := p.peekPop()
-			p.replaceTop(num(l.num() + r.num()))
+			if p.bignum {
+				v, _ := p.bigArith(compiler.AugOpAdd, l, r)
+				p.replaceTop(v)
+			} else {
+				p.replaceTop(num(l.num() + r.num()))
+			}
 
 		case compiler.Subtract:
 			l, r := p.peekPop()
-			p.replaceTop(num(l.num() - r.num()))
+			if p.bignum {
+				v, _ := p.bigArith(compiler.AugOpSub, l, r)
+				p.replaceTop(v)
+			} else {
+				p.replaceTop(num(l.num() - r.num()))
+			}
 
 		case compiler.Multiply:
 			l, r := p.peekPop()
-			p.replaceTop(num(l.num() * r.num()))
+			if p.bignum {
+				v, _ := p.bigArith(compiler.AugOpMul, l, r)
+				p.replaceTop(v)
+			} else {
+				p.replaceTop(num(l.num() * r.num()))
+			}
 
 		case compiler.Divide:
 			l, r := p.peekPop()
+			if p.bignum {
+				v, err := p.bigArith(compiler.AugOpDiv, l, r)
+				if err != nil {
+					return p.errorAt(err, code, ip-1)
+				}
+				p.replaceTop(v)
+				break
+			}
 			rf := r.num()
 			if rf == 0.0 {
-				return newError("division by zero")
+				return p.errorAt(newError("division by zero"), code, ip-1)
 			}
 			p.replaceTop(num(l.num() / rf))
 
 		case compiler.Power:
 			l, r := p.peekPop()
-			p.replaceTop(num(math.Pow(l.num(), r.num())))
+			if p.lint && l.num() == 0 && r.num() < 0 {
+				p.lintWarnf(code, ip-1, "division by zero in exponentiation")
+			}
+			if p.bignum {
+				v, _ := p.bigArith(compiler.AugOpPow, l, r)
+				p.replaceTop(v)
+			} else {
+				p.replaceTop(num(math.Pow(l.num(), r.num())))
+			}
 
 		case compiler.Modulo:
 			l, r := p.peekPop()
+			if p.bignum {
+				v, err := p.bigArith(compiler.AugOpMod, l, r)
+				if err != nil {
+					return p.errorAt(err, code, ip-1)
+				}
+				p.replaceTop(v)
+				break
+			}
 			rf := r.num()
 			if rf == 0.0 {
-				return newError("division by zero in mod")
+				return p.errorAt(newError("division by zero in mod"), code, ip-1)
 			}
 			p.replaceTop(num(math.Mod(l.num(), rf)))
 
@@ -368,8 +483,14 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			ln, lIsStr := l.isTrueStr()
 			rn, rIsStr := r.isTrueStr()
 			if lIsStr || rIsStr {
+				if p.lint {
+					p.lintCompare(code, ip-1, l, lIsStr, r, rIsStr)
+				}
 				p.replaceTop(boolean(p.toString(l) == p.toString(r)))
 			} else {
+				if p.bignum {
+					ln, rn = p.bigCompare(l, r)
+				}
 				p.replaceTop(boolean(ln == rn))
 			}
 
@@ -378,8 +499,14 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			ln, lIsStr := l.isTrueStr()
 			rn, rIsStr := r.isTrueStr()
 			if lIsStr || rIsStr {
+				if p.lint {
+					p.lintCompare(code, ip-1, l, lIsStr, r, rIsStr)
+				}
 				p.replaceTop(boolean(p.toString(l) != p.toString(r)))
 			} else {
+				if p.bignum {
+					ln, rn = p.bigCompare(l, r)
+				}
 				p.replaceTop(boolean(ln != rn))
 			}
 
@@ -388,8 +515,14 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			ln, lIsStr := l.isTrueStr()
 			rn, rIsStr := r.isTrueStr()
 			if lIsStr || rIsStr {
+				if p.lint {
+					p.lintCompare(code, ip-1, l, lIsStr, r, rIsStr)
+				}
 				p.replaceTop(boolean(p.toString(l) < p.toString(r)))
 			} else {
+				if p.bignum {
+					ln, rn = p.bigCompare(l, r)
+				}
 				p.replaceTop(boolean(ln < rn))
 			}
 
@@ -398,8 +531,14 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			ln, lIsStr := l.isTrueStr()
 			rn, rIsStr := r.isTrueStr()
 			if lIsStr || rIsStr {
+				if p.lint {
+					p.lintCompare(code, ip-1, l, lIsStr, r, rIsStr)
+				}
 				p.replaceTop(boolean(p.toString(l) > p.toString(r)))
 			} else {
+				if p.bignum {
+					ln, rn = p.bigCompare(l, r)
+				}
 				p.replaceTop(boolean(ln > rn))
 			}
 
@@ -408,8 +547,14 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			ln, lIsStr := l.isTrueStr()
 			rn, rIsStr := r.isTrueStr()
 			if lIsStr || rIsStr {
+				if p.lint {
+					p.lintCompare(code, ip-1, l, lIsStr, r, rIsStr)
+				}
 				p.replaceTop(boolean(p.toString(l) <= p.toString(r)))
 			} else {
+				if p.bignum {
+					ln, rn = p.bigCompare(l, r)
+				}
 				p.replaceTop(boolean(ln <= rn))
 			}
 
@@ -418,8 +563,14 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			ln, lIsStr := l.isTrueStr()
 			rn, rIsStr := r.isTrueStr()
 			if lIsStr || rIsStr {
+				if p.lint {
+					p.lintCompare(code, ip-1, l, lIsStr, r, rIsStr)
+				}
 				p.replaceTop(boolean(p.toString(l) >= p.toString(r)))
 			} else {
+				if p.bignum {
+					ln, rn = p.bigCompare(l, r)
+				}
 				p.replaceTop(boolean(ln >= rn))
 			}
 
@@ -442,7 +593,7 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			l, r := p.peekPop()
 			re, err := p.compileRegex(p.toString(r))
 			if err != nil {
-				return err
+				return p.errorAt(err, code, ip-1)
 			}
 			matched := re.MatchString(p.toString(l))
 			p.replaceTop(boolean(matched))
@@ -451,19 +602,39 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			l, r := p.peekPop()
 			re, err := p.compileRegex(p.toString(r))
 			if err != nil {
-				return err
+				return p.errorAt(err, code, ip-1)
 			}
 			matched := re.MatchString(p.toString(l))
 			p.replaceTop(boolean(!matched))
 
+		case compiler.MatchLiteral:
+			index := code[ip]
+			ip++
+			matched := p.literals[index].MatchString(p.toString(p.peekTop()))
+			p.replaceTop(boolean(matched))
+
+		case compiler.NotMatchLiteral:
+			index := code[ip]
+			ip++
+			matched := p.literals[index].MatchString(p.toString(p.peekTop()))
+			p.replaceTop(boolean(!matched))
+
 		case compiler.Not:
 			p.replaceTop(boolean(!p.peekTop().boolean()))
 
 		case compiler.UnaryMinus:
-			p.replaceTop(num(-p.peekTop().num()))
+			if p.bignum {
+				p.replaceTop(p.bigNeg(p.peekTop()))
+			} else {
+				p.replaceTop(num(-p.peekTop().num()))
+			}
 
 		case compiler.UnaryPlus:
-			p.replaceTop(num(p.peekTop().num()))
+			if p.bignum {
+				p.replaceTop(p.bigPlus(p.peekTop()))
+			} else {
+				p.replaceTop(num(p.peekTop().num()))
+			}
 
 		case compiler.Boolean:
 			p.replaceTop(boolean(p.peekTop().boolean()))
@@ -496,8 +667,14 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			rn, rIsStr := r.isTrueStr()
 			var b bool
 			if lIsStr || rIsStr {
+				if p.lint {
+					p.lintCompare(code, ip-1, l, lIsStr, r, rIsStr)
+				}
 				b = p.toString(l) == p.toString(r)
 			} else {
+				if p.bignum {
+					ln, rn = p.bigCompare(l, r)
+				}
 				b = ln == rn
 			}
 			if b {
@@ -512,8 +689,14 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			rn, rIsStr := r.isTrueStr()
 			var b bool
 			if lIsStr || rIsStr {
+				if p.lint {
+					p.lintCompare(code, ip-1, l, lIsStr, r, rIsStr)
+				}
 				b = p.toString(l) != p.toString(r)
 			} else {
+				if p.bignum {
+					ln, rn = p.bigCompare(l, r)
+				}
 				b = ln != rn
 			}
 			if b {
@@ -528,8 +711,14 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			rn, rIsStr := r.isTrueStr()
 			var b bool
 			if lIsStr || rIsStr {
+				if p.lint {
+					p.lintCompare(code, ip-1, l, lIsStr, r, rIsStr)
+				}
 				b = p.toString(l) < p.toString(r)
 			} else {
+				if p.bignum {
+					ln, rn = p.bigCompare(l, r)
+				}
 				b = ln < rn
 			}
 			if b {
@@ -544,8 +733,14 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			rn, rIsStr := r.isTrueStr()
 			var b bool
 			if lIsStr || rIsStr {
+				if p.lint {
+					p.lintCompare(code, ip-1, l, lIsStr, r, rIsStr)
+				}
 				b = p.toString(l) > p.toString(r)
 			} else {
+				if p.bignum {
+					ln, rn = p.bigCompare(l, r)
+				}
 				b = ln > rn
 			}
 			if b {
@@ -560,8 +755,14 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			rn, rIsStr := r.isTrueStr()
 			var b bool
 			if lIsStr || rIsStr {
+				if p.lint {
+					p.lintCompare(code, ip-1, l, lIsStr, r, rIsStr)
+				}
 				b = p.toString(l) <= p.toString(r)
 			} else {
+				if p.bignum {
+					ln, rn = p.bigCompare(l, r)
+				}
 				b = ln <= rn
 			}
 			if b {
@@ -576,8 +777,14 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			rn, rIsStr := r.isTrueStr()
 			var b bool
 			if lIsStr || rIsStr {
+				if p.lint {
+					p.lintCompare(code, ip-1, l, lIsStr, r, rIsStr)
+				}
 				b = p.toString(l) >= p.toString(r)
 			} else {
+				if p.bignum {
+					ln, rn = p.bigCompare(l, r)
+				}
 				b = ln >= rn
 			}
 			if b {
@@ -613,7 +820,7 @@ func (p *interp) execute(code []compiler.Opcode) error {
 				default: // resolver.Special
 					err := p.setSpecial(int(varIndex), str(index))
 					if err != nil {
-						return err
+						return p.errorAt(err, code, ip-1)
 					}
 				}
 				err := p.execute(loopCode)
@@ -621,7 +828,7 @@ func (p *interp) execute(code []compiler.Opcode) error {
 					break
 				}
 				if err != nil {
-					return err
+					return p.errorAt(err, code, ip-1)
 				}
 			}
 			ip += int(offset)
@@ -634,7 +841,7 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			ip++
 			err := p.callBuiltin(builtinOp)
 			if err != nil {
-				return err
+				return p.errorAt(err, code, ip-1)
 			}
 
 		case compiler.CallLengthArray:
@@ -651,7 +858,7 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			s := p.toString(p.peekTop())
 			n, err := p.split(s, resolver.Scope(arrayScope), int(arrayIndex), p.fieldSep)
 			if err != nil {
-				return err
+				return p.errorAt(err, code, ip-1)
 			}
 			p.replaceTop(num(float64(n)))
 
@@ -662,17 +869,31 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			s, fieldSep := p.peekPop()
 			n, err := p.split(p.toString(s), resolver.Scope(arrayScope), int(arrayIndex), p.toString(fieldSep))
 			if err != nil {
-				return err
+				return p.errorAt(err, code, ip-1)
 			}
 			p.replaceTop(num(float64(n)))
 
+		case compiler.CallPrintrow:
+			arrayScope := code[ip]
+			arrayIndex := code[ip+1]
+			fieldsScope := code[ip+2]
+			fieldsIndex := code[ip+3]
+			ip += 4
+			array := p.array(resolver.Scope(arrayScope), int(arrayIndex))
+			fields := p.array(resolver.Scope(fieldsScope), int(fieldsIndex))
+			err := p.printrow(p.output, array, fields)
+			if err != nil {
+				return p.errorAt(err, code, ip-1)
+			}
+			p.push(null())
+
 		case compiler.CallSprintf:
 			numArgs := code[ip]
 			ip++
 			args := p.popSlice(int(numArgs))
 			s, err := p.sprintf(p.toString(args[0]), args[1:])
 			if err != nil {
-				return err
+				return p.errorAt(err, code, ip-1)
 			}
 			p.push(str(s))
 
@@ -683,7 +904,7 @@ func (p *interp) execute(code []compiler.Opcode) error {
 
 			f := p.program.Compiled.Functions[funcIndex]
 			if p.callDepth >= maxCallDepth {
-				return newError("calling %q exceeded maximum call depth of %d", f.Name, maxCallDepth)
+				return p.errorAt(newError("calling %q exceeded maximum call depth of %d", f.Name, maxCallDepth), code, ip-1)
 			}
 
 			// Set up frame for scalar arguments
@@ -706,6 +927,9 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			p.localArrays = append(p.localArrays, arrays)
 
 			// Execute the function!
+			if p.profiling {
+				p.profileCalls[funcIndex]++
+			}
 			p.callDepth++
 			err := p.execute(f.Body)
 			p.callDepth--
@@ -719,7 +943,7 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			if r, ok := err.(returnValue); ok {
 				p.push(r.Value)
 			} else if err != nil {
-				return err
+				return p.callError(err, f.Name, code, ip-1)
 			} else {
 				p.push(null())
 			}
@@ -732,7 +956,7 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			args := p.popSlice(numArgs)
 			r, err := p.callNative(funcIndex, args)
 			if err != nil {
-				return err
+				return p.errorAt(err, code, ip-1)
 			}
 			p.push(r)
 
@@ -754,29 +978,22 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			ip += 2
 
 			args := p.popSlice(int(numArgs))
-
-			// Determine what output stream to write to.
-			output := p.output
-			if redirect != lexer.ILLEGAL {
-				var err error
-				dest := p.pop()
-				output, err = p.getOutputStream(redirect, dest)
-				if err != nil {
-					return err
-				}
+			output, err := p.printOutput(redirect, code, ip-1)
+			if err != nil {
+				return p.errorAt(err, code, ip-1)
 			}
 
 			if numArgs > 0 {
 				err := p.printArgs(output, args)
 				if err != nil {
-					return err
+					return p.errorAt(err, code, ip-1)
 				}
 			} else {
 				// "print" with no arguments prints the raw value of $0,
 				// regardless of output mode.
 				err := p.printLine(output, p.line)
 				if err != nil {
-					return err
+					return p.errorAt(err, code, ip-1)
 				}
 			}
 
@@ -788,7 +1005,7 @@ func (p *interp) execute(code []compiler.Opcode) error {
 			args := p.popSlice(int(numArgs))
 			s, err := p.sprintf(p.toString(args[0]), args[1:])
 			if err != nil {
-				return err
+				return p.errorAt(err, code, ip-1)
 			}
 
 			output := p.output
@@ -796,12 +1013,15 @@ func (p *interp) execute(code []compiler.Opcode) error {
 				dest := p.pop()
 				output, err = p.getOutputStream(redirect, dest)
 				if err != nil {
-					return err
+					return p.errorAt(err, code, ip-1)
+				}
+				if p.lint {
+					p.lintOpenStreams(code, ip-1)
 				}
 			}
 			err = writeOutput(output, s)
 			if err != nil {
-				return err
+				return p.errorAt(err, code, ip-1)
 			}
 
 		case compiler.Getline:
@@ -810,10 +1030,13 @@ func (p *interp) execute(code []compiler.Opcode) error {
 
 			ret, line, err := p.getline(redirect)
 			if err != nil {
-				return err
+				return p.errorAt(err, code, ip-1)
+			}
+			if p.lint {
+				p.lintOpenStreams(code, ip-1)
 			}
 			if ret == 1 {
-				p.setLine(line, false)
+				p.setLineFromStream(line, p.getlineStream)
 			}
 			p.push(num(ret))
 
@@ -823,15 +1046,39 @@ func (p *interp) execute(code []compiler.Opcode) error {
 
 			ret, line, err := p.getline(redirect)
 			if err != nil {
-				return err
+				return p.errorAt(err, code, ip-1)
+			}
+			if p.lint {
+				p.lintOpenStreams(code, ip-1)
+			}
+			if ret == 1 {
+				p.setLineFromStream(line, p.getlineStream)
+			}
+			p.push(num(ret))
+
+		case compiler.GetlineFieldByName:
+			redirect := lexer.Token(code[ip])
+			ip++
+
+			ret, line, err := p.getline(redirect)
+			if err != nil {
+				return p.errorAt(err, code, ip-1)
 			}
+			if p.lint {
+				p.lintOpenStreams(code, ip-1)
+			}
+			name := p.toString(p.peekTop())
 			if ret == 1 {
-				err := p.setField(0, line)
+				index, err := p.assignFieldIndex(name)
 				if err != nil {
-					return err
+					return p.errorAt(err, code, ip-1)
+				}
+				err = p.setField(index, line)
+				if err != nil {
+					return p.errorAt(err, code, ip-1)
 				}
 			}
-			p.push(num(ret))
+			p.replaceTop(num(ret))
 
 		case compiler.GetlineGlobal:
 			redirect := lexer.Token(code[ip])
@@ -840,7 +1087,10 @@ func (p *interp) execute(code []compiler.Opcode) error {
 
 			ret, line, err := p.getline(redirect)
 			if err != nil {
-				return err
+				return p.errorAt(err, code, ip-1)
+			}
+			if p.lint {
+				p.lintOpenStreams(code, ip-1)
 			}
 			if ret == 1 {
 				p.globals[index] = numStr(line)
@@ -854,7 +1104,10 @@ func (p *interp) execute(code []compiler.Opcode) error {
 
 			ret, line, err := p.getline(redirect)
 			if err != nil {
-				return err
+				return p.errorAt(err, code, ip-1)
+			}
+			if p.lint {
+				p.lintOpenStreams(code, ip-1)
 			}
 			if ret == 1 {
 				p.frame[index] = numStr(line)
@@ -868,12 +1121,15 @@ func (p *interp) execute(code []compiler.Opcode) error {
 
 			ret, line, err := p.getline(redirect)
 			if err != nil {
-				return err
+				return p.errorAt(err, code, ip-1)
+			}
+			if p.lint {
+				p.lintOpenStreams(code, ip-1)
 			}
 			if ret == 1 {
 				err := p.setSpecial(int(index), numStr(line))
 				if err != nil {
-					return err
+					return p.errorAt(err, code, ip-1)
 				}
 			}
 			p.push(num(ret))
@@ -886,7 +1142,10 @@ func (p *interp) execute(code []compiler.Opcode) error {
 
 			ret, line, err := p.getline(redirect)
 			if err != nil {
-				return err
+				return p.errorAt(err, code, ip-1)
+			}
+			if p.lint {
+				p.lintOpenStreams(code, ip-1)
 			}
 			index := p.toString(p.peekTop())
 			if ret == 1 {
@@ -894,12 +1153,79 @@ func (p *interp) execute(code []compiler.Opcode) error {
 				array[index] = numStr(line)
 			}
 			p.replaceTop(num(ret))
+
+		case compiler.FieldIntEqualsNum:
+			index := code[ip]
+			numIndex := code[ip+1]
+			ip += 2
+			if p.lint {
+				p.lintField(code, ip-1, int(index))
+			}
+			l := p.getField(int(index))
+			r := num(p.nums[numIndex])
+			ln, lIsStr := l.isTrueStr()
+			if lIsStr {
+				if p.lint {
+					p.lintCompare(code, ip-1, l, lIsStr, r, false)
+				}
+				p.push(boolean(p.toString(l) == p.toString(r)))
+			} else {
+				p.push(boolean(ln == r.n))
+			}
+
+		case compiler.FieldIntEqualsStr:
+			index := code[ip]
+			strIndex := code[ip+1]
+			ip += 2
+			if p.lint {
+				p.lintField(code, ip-1, int(index))
+			}
+			l := p.getField(int(index))
+			if p.lint {
+				_, lIsStr := l.isTrueStr()
+				p.lintCompare(code, ip-1, l, lIsStr, str(p.strs[strIndex]), true)
+			}
+			p.push(boolean(p.toString(l) == p.strs[strIndex]))
+
+		case compiler.PrintField:
+			index := code[ip]
+			redirect := lexer.Token(code[ip+1])
+			ip += 2
+			if p.lint {
+				p.lintField(code, ip-1, int(index))
+			}
+			args := [1]value{p.getField(int(index))}
+			output, err := p.printOutput(redirect, code, ip-1)
+			if err != nil {
+				return p.errorAt(err, code, ip-1)
+			}
+			err = p.printArgs(output, args[:])
+			if err != nil {
+				return p.errorAt(err, code, ip-1)
+			}
 		}
 	}
 
 	return nil
 }
 
+// Determine the output stream for print: the redirect destination (popped
+// from the stack) if there is one, otherwise standard output.
+func (p *interp) printOutput(redirect lexer.Token, code []compiler.Opcode, ip int) (io.Writer, error) {
+	if redirect == lexer.ILLEGAL {
+		return p.output, p.printOutputHeader()
+	}
+	dest := p.pop()
+	output, err := p.getOutputStream(redirect, dest)
+	if err != nil {
+		return nil, err
+	}
+	if p.lint {
+		p.lintOpenStreams(code, ip)
+	}
+	return output, nil
+}
+
 func (p *interp) callBuiltin(builtinOp compiler.BuiltinOp) error {
 	switch builtinOp {
 	case compiler.BuiltinAtan2:
@@ -908,32 +1234,15 @@ func (p *interp) callBuiltin(builtinOp compiler.BuiltinOp) error {
 
 	case compiler.BuiltinClose:
 		name := p.toString(p.peekTop())
-		var c io.Closer = p.inputStreams[name]
-		if c != nil {
-			// Close input stream
-			delete(p.inputStreams, name)
-			err := c.Close()
-			if err != nil {
-				p.replaceTop(num(-1))
-			} else {
-				p.replaceTop(num(0))
-			}
-		} else {
-			c = p.outputStreams[name]
-			if c != nil {
-				// Close output stream
-				delete(p.outputStreams, name)
-				err := c.Close()
-				if err != nil {
-					p.replaceTop(num(-1))
-				} else {
-					p.replaceTop(num(0))
-				}
-			} else {
-				// Nothing to close
-				p.replaceTop(num(-1))
-			}
+		p.replaceTop(num(p.closeStream(name, "")))
+
+	case compiler.BuiltinCloseHow:
+		how := p.toString(p.pop())
+		if how != "to" && how != "from" {
+			return newError(`close: second argument must be "to" or "from", not %q`, how)
 		}
+		name := p.toString(p.peekTop())
+		p.replaceTop(num(p.closeStream(name, how)))
 
 	case compiler.BuiltinCos:
 		p.replaceTop(num(math.Cos(p.peekTop().num())))
@@ -980,7 +1289,11 @@ func (p *interp) callBuiltin(builtinOp compiler.BuiltinOp) error {
 		p.replaceTop(num(float64(index + 1)))
 
 	case compiler.BuiltinInt:
-		p.replaceTop(num(float64(int(p.peekTop().num()))))
+		if p.bignum {
+			p.replaceTop(p.bigTrunc(p.peekTop()))
+		} else {
+			p.replaceTop(num(float64(int(p.peekTop().num()))))
+		}
 
 	case compiler.BuiltinLength:
 		p.push(num(float64(len(p.line))))
@@ -1017,7 +1330,11 @@ func (p *interp) callBuiltin(builtinOp compiler.BuiltinOp) error {
 		p.replaceTop(num(math.Sin(p.peekTop().num())))
 
 	case compiler.BuiltinSqrt:
-		p.replaceTop(num(math.Sqrt(p.peekTop().num())))
+		if p.bignum {
+			p.replaceTop(p.bigSqrt(p.peekTop()))
+		} else {
+			p.replaceTop(num(math.Sqrt(p.peekTop().num())))
+		}
 
 	case compiler.BuiltinSrand:
 		prevSeed := p.randSeed
@@ -1076,25 +1393,27 @@ func (p *interp) callBuiltin(builtinOp compiler.BuiltinOp) error {
 			return newError("can't call system() due to NoExec")
 		}
 		cmdline := p.toString(p.peekTop())
-		cmd := p.execShell(cmdline)
-		cmd.Stdin = p.stdin
-		cmd.Stdout = p.output
-		cmd.Stderr = p.errorOutput
 		_ = p.flushAll() // ensure synchronization
-		err := cmd.Run()
-		ret := 0.0
+		process, err := p.startCommand(&Command{
+			Line:   cmdline,
+			Stdin:  p.stdin,
+			Stdout: p.output,
+			Stderr: p.errorOutput,
+		})
+		status := 0
+		if err == nil {
+			status, err = process.Wait()
+		}
+		// A killed command reports an exit status rather than an error,
+		// so check for cancellation whatever Wait returned.
+		if p.checkCtx && p.ctx.Err() != nil {
+			return p.ctx.Err()
+		}
 		if err != nil {
-			if p.checkCtx && p.ctx.Err() != nil {
-				return p.ctx.Err()
-			}
-			if exitErr, ok := err.(*exec.ExitError); ok {
-				ret = float64(exitErr.ProcessState.ExitCode())
-			} else {
-				p.printErrorf("%v\n", err)
-				ret = -1
-			}
+			p.printErrorf("%v\n", err)
 		}
-		p.replaceTop(num(ret))
+		status = p.setCommandStatus(status, err)
+		p.replaceTop(num(float64(status)))
 
 	case compiler.BuiltinTolower:
 		p.replaceTop(str(strings.ToLower(p.toString(p.peekTop()))))
@@ -1194,6 +1513,7 @@ func (p *interp) peekSlice(n int) []value {
 // of a line, and returns the result. If the result is 1 (success in AWK), the
 // caller will set the target to the returned string.
 func (p *interp) getline(redirect lexer.Token) (float64, string, error) {
+	p.getlineStream = nil
 	switch redirect {
 	case lexer.PIPE: // redirect from command
 		name := p.toString(p.pop())
@@ -1201,8 +1521,26 @@ func (p *interp) getline(redirect lexer.Token) (float64, string, error) {
 		if err != nil {
 			return 0, "", err
 		}
+		p.getlineStream = p.streamModes[name]
 		if !scanner.Scan() {
 			if err := scanner.Err(); err != nil {
+				p.errno = err.Error()
+				return -1, "", nil
+			}
+			return 0, "", nil
+		}
+		return 1, scanner.Text(), nil
+
+	case lexer.PIPE_AMP: // read from coprocess
+		name := p.toString(p.pop())
+		scanner, err := p.getInputScannerCoprocess(name)
+		if err != nil {
+			return 0, "", err
+		}
+		p.getlineStream = p.streamModes[name]
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				p.errno = err.Error()
 				return -1, "", nil
 			}
 			return 0, "", nil
@@ -1220,8 +1558,10 @@ func (p *interp) getline(redirect lexer.Token) (float64, string, error) {
 			}
 			return 0, "", err
 		}
+		p.getlineStream = p.streamModes[name]
 		if !scanner.Scan() {
 			if err := scanner.Err(); err != nil {
+				p.errno = err.Error()
 				return -1, "", nil
 			}
 			return 0, "", nil
@@ -1236,34 +1576,49 @@ func (p *interp) getline(redirect lexer.Token) (float64, string, error) {
 			return 0, "", nil
 		}
 		if err != nil {
+			p.errno = errnoString(err)
 			return -1, "", nil
 		}
 		return 1, line, nil
 	}
 }
 
+// Add amount to v (for the increment and decrement instructions).
+func (p *interp) incr(v value, amount float64) value {
+	if p.bignum {
+		return p.bigAdd(v, amount)
+	}
+	return num(v.num() + amount)
+}
+
 // Perform augmented assignment operation.
 func (p *interp) augAssignOp(op compiler.AugOp, l, r value) (value, error) {
+	if p.bignum {
+		return p.bigArith(op, l, r)
+	}
+	return floatArith(op, l.num(), r.num())
+}
+
+// Perform arithmetic operation using float64.
+func floatArith(op compiler.AugOp, l, r float64) (value, error) {
 	switch op {
 	case compiler.AugOpAdd:
-		return num(l.num() + r.num()), nil
+		return num(l + r), nil
 	case compiler.AugOpSub:
-		return num(l.num() - r.num()), nil
+		return num(l - r), nil
 	case compiler.AugOpMul:
-		return num(l.num() * r.num()), nil
+		return num(l * r), nil
 	case compiler.AugOpDiv:
-		rf := r.num()
-		if rf == 0.0 {
+		if r == 0.0 {
 			return null(), newError("division by zero")
 		}
-		return num(l.num() / rf), nil
+		return num(l / r), nil
 	case compiler.AugOpPow:
-		return num(math.Pow(l.num(), r.num())), nil
+		return num(math.Pow(l, r)), nil
 	default: // AugOpMod
-		rf := r.num()
-		if rf == 0.0 {
+		if r == 0.0 {
 			return null(), newError("division by zero in mod")
 		}
-		return num(math.Mod(l.num(), rf)), nil
+		return num(math.Mod(l, r)), nil
 	}
 }
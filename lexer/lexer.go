@@ -279,7 +279,16 @@ func (l *Lexer) scan() (Position, Token, string) {
 			return l.pos, ILLEGAL, "unexpected char after '&'"
 		}
 	case '|':
-		tok = l.choice('|', PIPE, OR)
+		switch l.ch {
+		case '|':
+			l.next()
+			tok = OR
+		case '&':
+			l.next()
+			tok = PIPE_AMP
+		default:
+			tok = PIPE
+		}
 	default:
 		tok = ILLEGAL
 		val = "unexpected char"
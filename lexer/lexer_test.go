@@ -204,6 +204,7 @@ func TestKeywordToken(t *testing.T) {
 		{"print", PRINT},
 		{"split", F_SPLIT},
 		{"BEGIN", BEGIN},
+		{"ENDFILE", ENDFILE},
 		{"foo", ILLEGAL},
 		{"GoAWK", ILLEGAL},
 	}
@@ -220,10 +221,10 @@ func TestKeywordToken(t *testing.T) {
 func TestAllTokens(t *testing.T) {
 	input := "# comment line\n" +
 		"+ += && = : , -- /\n/= $ @ == >= > >> ++ { [ < ( #\n" +
-		"<= ~ % %= * *= !~ ! != | || ^ ^= ** **= ? } ] ) ; - -= " +
-		"BEGIN break continue delete do else END exit " +
+		"<= ~ % %= * *= !~ ! != | |& || ^ ^= ** **= ? } ] ) ; - -= " +
+		"BEGIN BEGINFILE break continue delete do else END ENDFILE exit " +
 		"for function getline if in next nextfile print printf return while " +
-		"atan2 close cos exp fflush gsub index int length log match rand " +
+		"atan2 close cos exp fflush gsub index int length log match printrow rand " +
 		"sin split sprintf sqrt srand sub substr system tolower toupper " +
 		"x \"str\\n\" 1234\n" +
 		"` ."
@@ -243,10 +244,10 @@ func TestAllTokens(t *testing.T) {
 
 	expected := "<newline> " +
 		"+ += && = : , -- / <newline> /= $ @ == >= > >> ++ { [ < ( <newline> " +
-		"<= ~ % %= * *= !~ ! != | || ^ ^= ^ ^= ? } ] ) ; - -= " +
-		"BEGIN break continue delete do else END exit " +
+		"<= ~ % %= * *= !~ ! != | |& || ^ ^= ^ ^= ? } ] ) ; - -= " +
+		"BEGIN BEGINFILE break continue delete do else END ENDFILE exit " +
 		"for function getline if in next nextfile print printf return while " +
-		"atan2 close cos exp fflush gsub index int length log match rand " +
+		"atan2 close cos exp fflush gsub index int length log match printrow rand " +
 		"sin split sprintf sqrt srand sub substr system tolower toupper " +
 		"name string number <newline> " +
 		"<illegal> <illegal> EOF"
@@ -44,6 +44,7 @@ const (
 	NOT_EQUALS
 	OR
 	PIPE
+	PIPE_AMP
 	POW
 	POW_ASSIGN
 	QUESTION
@@ -57,12 +58,14 @@ const (
 	// Keywords
 
 	BEGIN
+	BEGINFILE
 	BREAK
 	CONTINUE
 	DELETE
 	DO
 	ELSE
 	END
+	ENDFILE
 	EXIT
 	FOR
 	FUNCTION
@@ -89,6 +92,7 @@ const (
 	F_LENGTH
 	F_LOG
 	F_MATCH
+	F_PRINTROW
 	F_RAND
 	F_SIN
 	F_SPLIT
@@ -114,48 +118,51 @@ const (
 )
 
 var keywordTokens = map[string]Token{
-	"BEGIN":    BEGIN,
-	"break":    BREAK,
-	"continue": CONTINUE,
-	"delete":   DELETE,
-	"do":       DO,
-	"else":     ELSE,
-	"END":      END,
-	"exit":     EXIT,
-	"for":      FOR,
-	"function": FUNCTION,
-	"getline":  GETLINE,
-	"if":       IF,
-	"in":       IN,
-	"next":     NEXT,
-	"nextfile": NEXTFILE,
-	"print":    PRINT,
-	"printf":   PRINTF,
-	"return":   RETURN,
-	"while":    WHILE,
+	"BEGIN":     BEGIN,
+	"BEGINFILE": BEGINFILE,
+	"break":     BREAK,
+	"continue":  CONTINUE,
+	"delete":    DELETE,
+	"do":        DO,
+	"else":      ELSE,
+	"END":       END,
+	"ENDFILE":   ENDFILE,
+	"exit":      EXIT,
+	"for":       FOR,
+	"function":  FUNCTION,
+	"getline":   GETLINE,
+	"if":        IF,
+	"in":        IN,
+	"next":      NEXT,
+	"nextfile":  NEXTFILE,
+	"print":     PRINT,
+	"printf":    PRINTF,
+	"return":    RETURN,
+	"while":     WHILE,
 
-	"atan2":   F_ATAN2,
-	"close":   F_CLOSE,
-	"cos":     F_COS,
-	"exp":     F_EXP,
-	"fflush":  F_FFLUSH,
-	"gsub":    F_GSUB,
-	"index":   F_INDEX,
-	"int":     F_INT,
-	"length":  F_LENGTH,
-	"log":     F_LOG,
-	"match":   F_MATCH,
-	"rand":    F_RAND,
-	"sin":     F_SIN,
-	"split":   F_SPLIT,
-	"sprintf": F_SPRINTF,
-	"sqrt":    F_SQRT,
-	"srand":   F_SRAND,
-	"sub":     F_SUB,
-	"substr":  F_SUBSTR,
-	"system":  F_SYSTEM,
-	"tolower": F_TOLOWER,
-	"toupper": F_TOUPPER,
+	"atan2":    F_ATAN2,
+	"close":    F_CLOSE,
+	"cos":      F_COS,
+	"exp":      F_EXP,
+	"fflush":   F_FFLUSH,
+	"gsub":     F_GSUB,
+	"index":    F_INDEX,
+	"int":      F_INT,
+	"length":   F_LENGTH,
+	"log":      F_LOG,
+	"match":    F_MATCH,
+	"printrow": F_PRINTROW,
+	"rand":     F_RAND,
+	"sin":      F_SIN,
+	"split":    F_SPLIT,
+	"sprintf":  F_SPRINTF,
+	"sqrt":     F_SQRT,
+	"srand":    F_SRAND,
+	"sub":      F_SUB,
+	"substr":   F_SUBSTR,
+	"system":   F_SYSTEM,
+	"tolower":  F_TOLOWER,
+	"toupper":  F_TOUPPER,
 }
 
 // KeywordToken returns the token associated with the given keyword
@@ -201,6 +208,7 @@ var tokenNames = map[Token]string{
 	NOT_EQUALS: "!=",
 	OR:         "||",
 	PIPE:       "|",
+	PIPE_AMP:   "|&",
 	POW:        "^",
 	POW_ASSIGN: "^=",
 	QUESTION:   "?",
@@ -211,48 +219,51 @@ var tokenNames = map[Token]string{
 	SUB:        "-",
 	SUB_ASSIGN: "-=",
 
-	BEGIN:    "BEGIN",
-	BREAK:    "break",
-	CONTINUE: "continue",
-	DELETE:   "delete",
-	DO:       "do",
-	ELSE:     "else",
-	END:      "END",
-	EXIT:     "exit",
-	FOR:      "for",
-	FUNCTION: "function",
-	GETLINE:  "getline",
-	IF:       "if",
-	IN:       "in",
-	NEXT:     "next",
-	NEXTFILE: "nextfile",
-	PRINT:    "print",
-	PRINTF:   "printf",
-	RETURN:   "return",
-	WHILE:    "while",
+	BEGIN:     "BEGIN",
+	BEGINFILE: "BEGINFILE",
+	BREAK:     "break",
+	CONTINUE:  "continue",
+	DELETE:    "delete",
+	DO:        "do",
+	ELSE:      "else",
+	END:       "END",
+	ENDFILE:   "ENDFILE",
+	EXIT:      "exit",
+	FOR:       "for",
+	FUNCTION:  "function",
+	GETLINE:   "getline",
+	IF:        "if",
+	IN:        "in",
+	NEXT:      "next",
+	NEXTFILE:  "nextfile",
+	PRINT:     "print",
+	PRINTF:    "printf",
+	RETURN:    "return",
+	WHILE:     "while",
 
-	F_ATAN2:   "atan2",
-	F_CLOSE:   "close",
-	F_COS:     "cos",
-	F_EXP:     "exp",
-	F_FFLUSH:  "fflush",
-	F_GSUB:    "gsub",
-	F_INDEX:   "index",
-	F_INT:     "int",
-	F_LENGTH:  "length",
-	F_LOG:     "log",
-	F_MATCH:   "match",
-	F_RAND:    "rand",
-	F_SIN:     "sin",
-	F_SPLIT:   "split",
-	F_SPRINTF: "sprintf",
-	F_SQRT:    "sqrt",
-	F_SRAND:   "srand",
-	F_SUB:     "sub",
-	F_SUBSTR:  "substr",
-	F_SYSTEM:  "system",
-	F_TOLOWER: "tolower",
-	F_TOUPPER: "toupper",
+	F_ATAN2:    "atan2",
+	F_CLOSE:    "close",
+	F_COS:      "cos",
+	F_EXP:      "exp",
+	F_FFLUSH:   "fflush",
+	F_GSUB:     "gsub",
+	F_INDEX:    "index",
+	F_INT:      "int",
+	F_LENGTH:   "length",
+	F_LOG:      "log",
+	F_MATCH:    "match",
+	F_PRINTROW: "printrow",
+	F_RAND:     "rand",
+	F_SIN:      "sin",
+	F_SPLIT:    "split",
+	F_SPRINTF:  "sprintf",
+	F_SQRT:     "sqrt",
+	F_SRAND:    "srand",
+	F_SUB:      "sub",
+	F_SUBSTR:   "substr",
+	F_SYSTEM:   "system",
+	F_TOLOWER:  "tolower",
+	F_TOUPPER:  "toupper",
 
 	NAME:   "name",
 	NUMBER: "number",
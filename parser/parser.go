@@ -44,6 +44,11 @@ type ParserConfig struct {
 	// Map of named Go functions to allow calling from AWK. See docs
 	// on interp.Config.Funcs for details.
 	Funcs map[string]interface{}
+
+	// Disable the compiler's peephole optimizations (constant folding,
+	// superinstructions, and so on), for example to inspect the
+	// unoptimized instructions with Program.Disassemble
+	NoOptimize bool
 }
 
 func (c *ParserConfig) toResolverConfig() *resolver.Config {
@@ -88,7 +93,7 @@ func ParseProgram(src []byte, config *ParserConfig) (prog *Program, err error) {
 	prog.ResolvedProgram = *resolver.Resolve(astProg, config.toResolverConfig())
 
 	// Compile to virtual machine code
-	prog.Compiled, err = compiler.Compile(&prog.ResolvedProgram)
+	prog.Compiled, err = compiler.Compile(&prog.ResolvedProgram, config == nil || !config.NoOptimize)
 	return prog, err
 }
 
@@ -125,6 +130,7 @@ type parser struct {
 
 	// Parsing state
 	inAction  bool   // true if parsing an action (false in BEGIN or END)
+	fileBlock Token  // BEGINFILE or ENDFILE if parsing one, else ILLEGAL
 	funcName  string // function name if parsing a func, else ""
 	loopDepth int    // current loop depth (0 if not in any loops)
 
@@ -162,6 +168,16 @@ func (p *parser) program() *ast.Program {
 		case BEGIN:
 			p.next()
 			prog.Begin = append(prog.Begin, p.stmtsBrace())
+		case BEGINFILE:
+			p.fileBlock = p.tok
+			p.next()
+			prog.BeginFile = append(prog.BeginFile, p.stmtsBrace())
+			p.fileBlock = ILLEGAL
+		case ENDFILE:
+			p.fileBlock = p.tok
+			p.next()
+			prog.EndFile = append(prog.EndFile, p.stmtsBrace())
+			p.fileBlock = ILLEGAL
 		case END:
 			p.next()
 			prog.End = append(prog.End, p.stmtsBrace())
@@ -172,15 +188,20 @@ func (p *parser) program() *ast.Program {
 			p.inAction = true
 			// Allow empty pattern, normal pattern, or range pattern
 			pattern := []ast.Expr{}
+			var patternPos, patternEnd []Position
 			if !p.matches(LBRACE, EOF) {
+				patternPos = append(patternPos, p.pos)
 				pattern = append(pattern, p.expr())
+				patternEnd = append(patternEnd, p.pos)
 			}
 			if !p.matches(LBRACE, EOF, NEWLINE, SEMICOLON) {
 				p.commaNewlines()
+				patternPos = append(patternPos, p.pos)
 				pattern = append(pattern, p.expr())
+				patternEnd = append(patternEnd, p.pos)
 			}
 			// Or an empty action (equivalent to { print $0 })
-			action := &ast.Action{pattern, nil}
+			action := &ast.Action{pattern, nil, patternPos, patternEnd}
 			if p.tok == LBRACE {
 				action.Stmts = p.stmtsBrace()
 			} else {
@@ -243,7 +264,7 @@ func (p *parser) simpleStmt() ast.Stmt {
 		}
 		redirect := ILLEGAL
 		var dest ast.Expr
-		if p.matches(GREATER, APPEND, PIPE) {
+		if p.matches(GREATER, APPEND, PIPE, PIPE_AMP) {
 			redirect = p.tok
 			p.next()
 			dest = p.expr()
@@ -378,11 +399,12 @@ func (p *parser) stmt() ast.Stmt {
 		p.next()
 		p.optionalNewlines()
 		body := p.loopStmts()
+		whilePos := p.pos
 		p.expect(WHILE)
 		p.expect(LPAREN)
 		cond := p.expr()
 		p.expect(RPAREN)
-		s = &ast.DoWhileStmt{body, cond, startPos, p.pos}
+		s = &ast.DoWhileStmt{body, cond, startPos, p.pos, whilePos}
 	case BREAK:
 		if p.loopDepth == 0 {
 			panic(p.errorf("break must be inside a loop body"))
@@ -396,13 +418,19 @@ func (p *parser) stmt() ast.Stmt {
 		p.next()
 		s = &ast.ContinueStmt{startPos, p.pos}
 	case NEXT:
+		if p.fileBlock != ILLEGAL {
+			panic(p.errorf("next can't be inside %s", p.fileBlock))
+		}
 		if !p.inAction && p.funcName == "" {
 			panic(p.errorf("next can't be inside BEGIN or END"))
 		}
 		p.next()
 		s = &ast.NextStmt{startPos, p.pos}
 	case NEXTFILE:
-		if !p.inAction && p.funcName == "" {
+		if p.fileBlock == ENDFILE {
+			panic(p.errorf("nextfile can't be inside ENDFILE"))
+		}
+		if !p.inAction && p.fileBlock != BEGINFILE && p.funcName == "" {
 			panic(p.errorf("nextfile can't be inside BEGIN or END"))
 		}
 		p.next()
@@ -499,7 +527,7 @@ func (p *parser) function() *ast.Function {
 func (p *parser) exprList(parse func() ast.Expr) []ast.Expr {
 	exprs := []ast.Expr{}
 	first := true
-	for !p.matches(NEWLINE, SEMICOLON, RBRACE, RBRACKET, RPAREN, GREATER, PIPE, APPEND) {
+	for !p.matches(NEWLINE, SEMICOLON, RBRACE, RBRACKET, RPAREN, GREATER, PIPE, PIPE_AMP, APPEND) {
 		if !first {
 			p.commaNewlines()
 		}
@@ -520,16 +548,18 @@ func (p *parser) exprList(parse func() ast.Expr) []ast.Expr {
 func (p *parser) expr() ast.Expr      { return p.getLine() }
 func (p *parser) printExpr() ast.Expr { return p._assign(p.printCond) }
 
-// Parse an "expr | getline [lvalue]" expression:
+// Parse an "expr | getline [lvalue]" or "expr |& getline [lvalue]"
+// expression:
 //
-//	assign [PIPE GETLINE [lvalue]]
+//	assign [(PIPE | PIPE_AMP) GETLINE [lvalue]]
 func (p *parser) getLine() ast.Expr {
 	expr := p._assign(p.cond)
-	if p.tok == PIPE {
+	if p.matches(PIPE, PIPE_AMP) {
+		coprocess := p.tok == PIPE_AMP
 		p.next()
 		p.expect(GETLINE)
 		target := p.optionalLValue()
-		return &ast.GetlineExpr{expr, target, nil}
+		return &ast.GetlineExpr{expr, target, nil, coprocess}
 	}
 	return expr
 }
@@ -538,16 +568,12 @@ func (p *parser) getLine() ast.Expr {
 //
 //	lvalue [assign_op assign]
 //
-// An lvalue is a variable name, an array[expr] index expression, or
-// an $expr field expression.
+// An lvalue is a variable name, an array[expr] index expression, an
+// $expr field expression, or an @expr named field expression.
 func (p *parser) _assign(higher func() ast.Expr) ast.Expr {
 	leftPos := p.pos
 	expr := higher()
 	if p.matches(ASSIGN, ADD_ASSIGN, DIV_ASSIGN, MOD_ASSIGN, MUL_ASSIGN, POW_ASSIGN, SUB_ASSIGN) {
-		_, isNamedField := expr.(*ast.NamedFieldExpr)
-		if isNamedField {
-			panic(p.errorf("assigning @ expression not supported"))
-		}
 		op := p.tok
 		p.next()
 		right := p._assign(higher)
@@ -599,15 +625,17 @@ func (p *parser) cond() ast.Expr      { return p._cond(p.or) }
 func (p *parser) printCond() ast.Expr { return p._cond(p.printOr) }
 
 func (p *parser) _cond(higher func() ast.Expr) ast.Expr {
+	condPos := p.pos
 	expr := higher()
 	if p.tok == QUESTION {
+		condEnd := p.pos
 		p.next()
 		p.optionalNewlines()
 		t := p.expr()
 		p.expect(COLON)
 		p.optionalNewlines()
 		f := p.expr()
-		return &ast.CondExpr{expr, t, f}
+		return &ast.CondExpr{expr, t, f, condPos, condEnd}
 	}
 	return expr
 }
@@ -720,7 +748,7 @@ func (p *parser) primary() ast.Expr {
 		s := strings.TrimRight(p.val, "eE")
 		n, _ := strconv.ParseFloat(s, 64)
 		p.next()
-		return &ast.NumExpr{n}
+		return &ast.NumExpr{n, s}
 	case STRING:
 		s := p.val
 		p.next()
@@ -789,6 +817,7 @@ func (p *parser) primary() ast.Expr {
 			return p.multiExpr(exprs, parenPos)
 		}
 	case GETLINE:
+		getlinePos := p.pos
 		p.next()
 		target := p.optionalLValue()
 		var file ast.Expr
@@ -796,7 +825,11 @@ func (p *parser) primary() ast.Expr {
 			p.next()
 			file = p.primary()
 		}
-		return &ast.GetlineExpr{nil, target, file}
+		if file == nil && p.fileBlock != ILLEGAL {
+			// Reading the next record would start the next file
+			panic(ast.PosErrorf(getlinePos, "getline without redirection can't be inside %s", p.fileBlock))
+		}
+		return &ast.GetlineExpr{nil, target, file, false}
 	// Below is the parsing of all the builtin function calls. We
 	// could unify these but several of them have special handling
 	// (array/lvalue/regex params, optional arguments, and so on).
@@ -833,6 +866,18 @@ func (p *parser) primary() ast.Expr {
 		}
 		p.expect(RPAREN)
 		return &ast.CallExpr{F_SPLIT, args}
+	case F_PRINTROW:
+		p.next()
+		p.expect(LPAREN)
+		name, namePos := p.expectName()
+		args := []ast.Expr{&ast.VarExpr{name, namePos}}
+		if p.tok == COMMA {
+			p.commaNewlines()
+			fieldsName, fieldsPos := p.expectName()
+			args = append(args, &ast.VarExpr{fieldsName, fieldsPos})
+		}
+		p.expect(RPAREN)
+		return &ast.CallExpr{F_PRINTROW, args}
 	case F_MATCH:
 		p.next()
 		p.expect(LPAREN)
@@ -899,7 +944,18 @@ func (p *parser) primary() ast.Expr {
 		}
 		p.expect(RPAREN)
 		return &ast.CallExpr{F_FFLUSH, args}
-	case F_COS, F_SIN, F_EXP, F_LOG, F_SQRT, F_INT, F_TOLOWER, F_TOUPPER, F_SYSTEM, F_CLOSE:
+	case F_CLOSE:
+		// close(name) or close(name, "to"|"from") for a coprocess
+		p.next()
+		p.expect(LPAREN)
+		args := []ast.Expr{p.expr()}
+		if p.tok == COMMA {
+			p.commaNewlines()
+			args = append(args, p.expr())
+		}
+		p.expect(RPAREN)
+		return &ast.CallExpr{F_CLOSE, args}
+	case F_COS, F_SIN, F_EXP, F_LOG, F_SQRT, F_INT, F_TOLOWER, F_TOUPPER, F_SYSTEM:
 		// Simple 1-argument functions
 		op := p.tok
 		p.next()
@@ -945,6 +1001,9 @@ func (p *parser) optionalLValue() ast.Expr {
 	case DOLLAR:
 		p.next()
 		return &ast.FieldExpr{p.primary()}
+	case AT:
+		p.next()
+		return &ast.NamedFieldExpr{p.primary()}
 	default:
 		return nil
 	}
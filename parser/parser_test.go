@@ -28,6 +28,12 @@ BEGIN {
     print "begin two"
 }
 
+BEGINFILE {
+    if (ERRNO != "") {
+        nextfile
+    }
+}
+
 {
     print "empty pattern"
 }
@@ -39,6 +45,7 @@ $0 {
     print "x" >"file"
     print "x" >>"append"
     print "y" |"prog"
+    print "z" |&"coprocess"
     delete a
     delete a[k]
     if (c) {
@@ -69,6 +76,8 @@ $0 {
     "cmd" |getline x
     "cmd" |getline a[1]
     "cmd" |getline $1
+    "cmd" |&getline
+    "cmd" |&getline x
     getline
     getline x
     (getline x + 1)
@@ -131,6 +140,8 @@ $0 {
     split(s, a)
     split(s, a, regex)
     match(s, regex)
+    printrow(a)
+    printrow(a, fields)
     rand()
     srand()
     srand(1)
@@ -149,6 +160,7 @@ $0 {
     toupper("foo")
     system("ls")
     close("file")
+    close("coprocess", "to")
     atan2(x, y)
     index(haystack, needle)
     {
@@ -163,6 +175,10 @@ $0 {
 
 ($1 == "foo")
 
+ENDFILE {
+    print "endfile", FNR
+}
+
 END {
     print "end one"
 }
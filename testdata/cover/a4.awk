@@ -0,0 +1,7 @@
+function f(x) {
+  if (x > 1)
+    return "big"
+  return "small"
+}
+function g() { print "never" }
+BEGIN { print f(5) }
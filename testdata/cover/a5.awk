@@ -0,0 +1,13 @@
+function f(x) {
+  if (x > 1)
+    return "big"
+  return x ? "one" : "small"
+}
+BEGIN {
+  print f(1), f(2)
+  i = 0
+  while (i < 2) i++
+  do { i-- } while (i > 0)
+  for (j = 0; j < 1; j++) ;
+}
+$1 == "x", /end/ { print }
@@ -0,0 +1,32 @@
+BEGIN {
+    __COVER[2]++
+    print f(1), f(2)
+    i = 0
+    while (i < 2 ? ++__COVER_BRANCH[1] : !++__COVER_BRANCH[2]) {
+        __COVER[1]++
+        i++
+    }
+    __COVER[4]++
+    do {
+        __COVER[3]++
+        i--
+    } while (i > 0 ? ++__COVER_BRANCH[3] : !++__COVER_BRANCH[4])
+    __COVER[5]++
+    for (j = 0; j < 1 ? ++__COVER_BRANCH[5] : !++__COVER_BRANCH[6]; j++) {
+    }
+}
+
+$1 == "x" ? ++__COVER_BRANCH[7] : !++__COVER_BRANCH[8], /end/ ? ++__COVER_BRANCH[9] : !++__COVER_BRANCH[10] {
+    __COVER[6]++
+    print 
+}
+
+function f(x) {
+    __COVER[8]++
+    if (x > 1 ? ++__COVER_BRANCH[11] : !++__COVER_BRANCH[12]) {
+        __COVER[7]++
+        return "big"
+    }
+    __COVER[9]++
+    return (x ? ++__COVER_BRANCH[13] : !++__COVER_BRANCH[14]) ? "one" : "small"
+}
@@ -0,0 +1,3 @@
+function div(a, b) {
+    return a / b
+}
@@ -0,0 +1,3 @@
+BEGIN {
+    print div(1, 0)
+}